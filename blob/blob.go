@@ -0,0 +1,275 @@
+// Package blob stores large payloads off-chain, committed to by blob transactions.
+package blob
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// blobs are stored off-chain in the blobs directory of a data directory, named by the hex-encoded sha256 of their contents
+// a blob transaction commits to the hash and size, so a blob can be checked against the chain
+// uploads are written in chunks to a partial file, which is only renamed once its hash matches
+// chunks of the same blob are written one at a time, and partial files that stop growing are expired
+
+// largest chunk accepted in a single upload request
+const BLOB_CHUNK_SIZE int64 = 1 << 20
+
+// a partial upload that hasn't been written to for this long is discarded
+const BLOB_UPLOAD_EXPIRY time.Duration = 24 * time.Hour
+
+// the directory of the blob store, relative to the root of a data directory
+const BLOBS_DIR string = "blobs"
+
+// returned when an upload declares a blob larger than the store accepts
+var ErrBlobTooLarge = errors.New("blob is larger than the store accepts")
+
+// the blobs stored in a data directory
+type Store struct {
+	dir      string
+	max_size uint64 // largest blob that can be uploaded
+
+	lock    sync.Mutex
+	uploads map[string]*upload_lock_t // locks of the blobs being written, by hex-encoded hash
+}
+
+// serializes the writes to one blob, and is removed from the store once nobody holds or waits for it
+type upload_lock_t struct {
+	lock  sync.Mutex
+	users int
+}
+
+// returns the blob store of the data directory dir, accepting uploads of blobs up to max_size bytes
+func NewStore(dir string, max_size uint64) *Store {
+	return &Store{dir: path.Join(dir, BLOBS_DIR), max_size: max_size, uploads: make(map[string]*upload_lock_t)}
+}
+
+// waits until nobody else is writing the blob, returning a function that releases it
+func (store *Store) lockUpload(hash []byte) func() {
+	key := hex.EncodeToString(hash)
+	store.lock.Lock()
+	upload, ok := store.uploads[key]
+	if !ok {
+		upload = &upload_lock_t{}
+		store.uploads[key] = upload
+	}
+	upload.users += 1
+	store.lock.Unlock()
+
+	upload.lock.Lock()
+	return func() {
+		upload.lock.Unlock()
+		store.lock.Lock()
+		upload.users -= 1
+		if upload.users == 0 {
+			delete(store.uploads, key)
+		}
+		store.lock.Unlock()
+	}
+}
+
+// returns the path of a stored blob
+func (store *Store) blobPath(hash []byte) string {
+	return path.Join(store.dir, hex.EncodeToString(hash))
+}
+
+// returns the path of a blob that is still being uploaded
+func (store *Store) partialBlobPath(hash []byte) string {
+	return store.blobPath(hash) + ".part"
+}
+
+// creates the blobs directory if it doesn't exist
+func (store *Store) makeBlobsDir() error {
+	if _, err := os.Stat(store.dir); os.IsNotExist(err) {
+		return os.MkdirAll(store.dir, 0755)
+	}
+	return nil
+}
+
+// checks that r contains exactly size bytes with the given hash
+func VerifyBlob(r io.Reader, hash []byte, size uint64) error {
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return err
+	}
+	if uint64(n) != size {
+		return fmt.Errorf("blob has %d bytes, expected %d", n, size)
+	}
+	if !bytes.Equal(h.Sum(nil), hash) {
+		return errors.New("blob doesn't match its hash")
+	}
+	return nil
+}
+
+// hashes the contents of a file, returning its hash and size
+func HashBlobFile(fname string) (hash []byte, size uint64, err error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return nil, 0, err
+	}
+	return h.Sum(nil), uint64(n), nil
+}
+
+// returns true if the blob is in the local store
+func (store *Store) HasBlob(hash []byte) bool {
+	_, err := os.Stat(store.blobPath(hash))
+	return err == nil
+}
+
+// opens a blob from the local store
+func (store *Store) OpenBlob(hash []byte) (*os.File, error) {
+	return os.Open(store.blobPath(hash))
+}
+
+// returns how many bytes of a blob have been uploaded so far
+func (store *Store) BlobUploadOffset(hash []byte) (int64, error) {
+	if store.HasBlob(hash) {
+		info, err := os.Stat(store.blobPath(hash))
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	}
+	info, err := os.Stat(store.partialBlobPath(hash))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// writes a chunk of a blob that starts at offset
+// chunks must be written in order, so offset must equal the number of bytes already uploaded
+// a partial upload that has expired is discarded, so the blob must be uploaded again from the start
+// once size bytes have been written, the blob is verified against its hash and moved into the store
+// returns true if the blob is complete
+func (store *Store) WriteBlobChunk(hash []byte, size uint64, offset int64, chunk io.Reader) (bool, error) {
+	if len(hash) != sha256.Size {
+		return false, errors.New("invalid blob hash")
+	}
+	if size > store.max_size {
+		return false, fmt.Errorf("%w: %d bytes declared, at most %d allowed", ErrBlobTooLarge, size, store.max_size)
+	}
+	unlock := store.lockUpload(hash)
+	defer unlock()
+	if store.HasBlob(hash) {
+		return true, nil
+	}
+	if err := store.makeBlobsDir(); err != nil {
+		return false, err
+	}
+	if _, err := store.expireUpload(hash, time.Now().Add(-BLOB_UPLOAD_EXPIRY)); err != nil {
+		return false, err
+	}
+
+	current, err := store.BlobUploadOffset(hash)
+	if err != nil {
+		return false, err
+	}
+	if offset != current {
+		return false, fmt.Errorf("chunk starts at %d, but %d bytes have been uploaded", offset, current)
+	}
+
+	f, err := os.OpenFile(store.partialBlobPath(hash), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return false, err
+	}
+	n, err := io.Copy(f, io.LimitReader(chunk, BLOB_CHUNK_SIZE))
+	f.Close()
+	if err != nil {
+		return false, err
+	}
+	if uint64(offset+n) > size {
+		os.Remove(store.partialBlobPath(hash))
+		return false, errors.New("blob is larger than its declared size")
+	}
+	if uint64(offset+n) < size {
+		return false, nil
+	}
+
+	// the upload is complete, so check it before adding it to the store
+	f, err = os.Open(store.partialBlobPath(hash))
+	if err != nil {
+		return false, err
+	}
+	err = VerifyBlob(f, hash, size)
+	f.Close()
+	if err != nil {
+		os.Remove(store.partialBlobPath(hash))
+		return false, err
+	}
+	return true, os.Rename(store.partialBlobPath(hash), store.blobPath(hash))
+}
+
+// removes the partial upload of a blob if it was last written before cutoff, returning true if it was removed
+// the caller must hold the blob's upload lock
+func (store *Store) expireUpload(hash []byte, cutoff time.Time) (bool, error) {
+	info, err := os.Stat(store.partialBlobPath(hash))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if info.ModTime().After(cutoff) {
+		return false, nil
+	}
+	return true, os.Remove(store.partialBlobPath(hash))
+}
+
+// removes the partial uploads that were last written before cutoff, usually BLOB_UPLOAD_EXPIRY ago
+// returns the number of uploads that were removed
+func (store *Store) ExpireUploads(cutoff time.Time) (int, error) {
+	entries, err := os.ReadDir(store.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".part")
+		if !ok || e.IsDir() {
+			continue
+		}
+		hash, err := hex.DecodeString(name)
+		if err != nil || len(hash) != sha256.Size {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+
+		// the upload may have been written to since the directory was read
+		unlock := store.lockUpload(hash)
+		expired, err := store.expireUpload(hash, cutoff)
+		unlock()
+		if err != nil {
+			return count, err
+		}
+		if expired {
+			count += 1
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,130 @@
+package blob
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBlobChunkVerification(t *testing.T) {
+	content := []byte("the real blob")
+	hash := sha256.Sum256(content)
+	store := NewStore(t.TempDir(), 1<<20)
+
+	_, err := store.WriteBlobChunk(hash[:], uint64(len(content)), 0, bytes.NewReader([]byte("a fake blob!!")))
+	if err == nil {
+		t.Errorf("blob that doesn't match its hash was stored")
+	}
+	if store.HasBlob(hash[:]) {
+		t.Errorf("mismatched blob is in the store")
+	}
+
+	_, err = store.WriteBlobChunk(hash[:], uint64(len(content)), 5, bytes.NewReader(content[5:]))
+	if err == nil {
+		t.Errorf("chunk at the wrong offset was accepted")
+	}
+
+	complete, err := store.WriteBlobChunk(hash[:], uint64(len(content)), 0, bytes.NewReader(content))
+	if err != nil || !complete {
+		t.Errorf("error storing blob (%v)", err)
+	}
+}
+
+func TestBlobUploadLimits(t *testing.T) {
+	store := NewStore(t.TempDir(), 100)
+	content := bytes.Repeat([]byte("x"), 101)
+	hash := sha256.Sum256(content)
+	if _, err := store.WriteBlobChunk(hash[:], uint64(len(content)), 0, bytes.NewReader(content)); !errors.Is(err, ErrBlobTooLarge) {
+		t.Errorf("blob larger than the store accepts wasn't refused (%v)", err)
+	}
+	if offset, _ := store.BlobUploadOffset(hash[:]); offset != 0 {
+		t.Errorf("%d bytes of a refused blob were stored", offset)
+	}
+}
+
+// a chunk that arrives a byte at a time, like a slow upload
+type slow_reader_t struct {
+	r io.Reader
+}
+
+func (sr slow_reader_t) Read(p []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+	return sr.r.Read(p[:min(len(p), 1)])
+}
+
+func TestBlobConcurrentChunks(t *testing.T) {
+	store := NewStore(t.TempDir(), 1<<20)
+	content := []byte("a blob uploaded in two chunks")
+	hash := sha256.Sum256(content)
+
+	// the same first chunk is sent several times at once, only one of them may be appended
+	var wg sync.WaitGroup
+	written := make(chan bool, 8)
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := store.WriteBlobChunk(hash[:], uint64(len(content)), 0, slow_reader_t{bytes.NewReader(content[:10])})
+			written <- err == nil
+		}()
+	}
+	wg.Wait()
+	close(written)
+	count := 0
+	for ok := range written {
+		if ok {
+			count += 1
+		}
+	}
+	if offset, _ := store.BlobUploadOffset(hash[:]); count != 1 || offset != 10 {
+		t.Errorf("%d copies of the first chunk were accepted, leaving %d bytes", count, offset)
+	}
+	if len(store.uploads) != 0 {
+		t.Errorf("%d upload locks were left behind", len(store.uploads))
+	}
+
+	complete, err := store.WriteBlobChunk(hash[:], uint64(len(content)), 10, bytes.NewReader(content[10:]))
+	if err != nil || !complete {
+		t.Errorf("error completing blob (%v)", err)
+	}
+}
+
+func TestBlobUploadExpiry(t *testing.T) {
+	store := NewStore(t.TempDir(), 1<<20)
+	content := []byte("an abandoned upload")
+	hash := sha256.Sum256(content)
+	if _, err := store.WriteBlobChunk(hash[:], uint64(len(content)), 0, bytes.NewReader(content[:5])); err != nil {
+		t.Fatalf("error writing chunk (%s)", err)
+	}
+
+	// a recent upload is kept
+	if n, err := store.ExpireUploads(time.Now().Add(-BLOB_UPLOAD_EXPIRY)); n != 0 || err != nil {
+		t.Errorf("recent upload was expired (%d, %v)", n, err)
+	}
+
+	// an upload that stopped long ago can't be resumed, and is removed
+	stale := time.Now().Add(-2 * BLOB_UPLOAD_EXPIRY)
+	if err := os.Chtimes(store.partialBlobPath(hash[:]), stale, stale); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.WriteBlobChunk(hash[:], uint64(len(content)), 5, bytes.NewReader(content[5:])); err == nil {
+		t.Errorf("expired upload was resumed")
+	}
+	if _, err := store.WriteBlobChunk(hash[:], uint64(len(content)), 0, bytes.NewReader(content[:5])); err != nil {
+		t.Fatalf("error restarting upload (%s)", err)
+	}
+	if err := os.Chtimes(store.partialBlobPath(hash[:]), stale, stale); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := store.ExpireUploads(time.Now().Add(-BLOB_UPLOAD_EXPIRY)); n != 1 || err != nil {
+		t.Errorf("stale upload wasn't expired (%d, %v)", n, err)
+	}
+	if offset, _ := store.BlobUploadOffset(hash[:]); offset != 0 {
+		t.Errorf("expired upload still has %d bytes", offset)
+	}
+}
@@ -0,0 +1,482 @@
+// Package block encodes, signs and verifies the blocks of a chain.
+package block
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"reddchain/identity"
+	"reddchain/transaction"
+
+	_ "crypto/sha256"
+)
+
+// constants related to block formatting
+const (
+	TIMESTAMP_SIZE     uint8  = 8
+	HASH_SIZE          uint8  = 32
+	SIGNATURE_MAX_SIZE uint16 = 65535 // signatures are length-prefixed with two bytes
+
+	// the largest encoding of a block: its header with the largest validator and signature, then its transaction
+	BLOCK_MAX_SIZE int = int(TIMESTAMP_SIZE) + 2*int(HASH_SIZE) + 1 + int(identity.PUBKEY_MAX_SIZE) + 2 + int(SIGNATURE_MAX_SIZE) + int(transaction.TX_MAX_SIZE)
+)
+
+// returns the current unix time, as used for block timestamps
+func GetCurrentTimestamp() int64 {
+	return time.Now().UTC().Unix()
+}
+
+// returned when a block's transaction data has been discarded
+var ErrPruned = errors.New("block payload has been pruned")
+
+// the block struct
+type Block struct {
+	timestamp        [TIMESTAMP_SIZE]byte
+	prev_hash        [HASH_SIZE]byte         // hash of previous block
+	state_root       [HASH_SIZE]byte         // merkle root of the validator state after this block
+	hash             [HASH_SIZE]byte         // hash of entire block, including signature
+	signed_hash      [HASH_SIZE]byte         // hash corresponding to the signature
+	validator_length uint8                   // length of validator (variable, depends on the key algorithm)
+	validator        []byte                  // validator public key
+	signature_length uint16                  // length of signature (variable, multisignatures hold several)
+	signature        []byte                  // signature corresponding to validator's public key
+	tx               transaction.Transaction // data included in block
+	payload_hash     [HASH_SIZE]byte         // hash of tx.data, kept after the data is pruned
+	pruned           bool                    // true if tx.data has been discarded
+}
+
+// create a new block
+func NewBlock(timestamp int64, prev_hash []byte, state_root []byte, tx transaction.Transaction, signer identity.Signer) (block Block, err error) {
+	binary.BigEndian.PutUint64(block.timestamp[:], uint64(timestamp))
+	n := copy(block.prev_hash[:], prev_hash)
+	if n != len(prev_hash) {
+		s := fmt.Sprintf("length of prev_hash (%d) was too long for block.validator (%d)", len(prev_hash), n)
+		return block, errors.New(s)
+	}
+	n = copy(block.state_root[:], state_root)
+	if n != len(state_root) {
+		s := fmt.Sprintf("length of state_root (%d) was too long for block.state_root (%d)", len(state_root), n)
+		return block, errors.New(s)
+	}
+
+	block.tx = tx
+	pubbytes := signer.GetPubBytes()
+	if err := identity.ValidValidatorKey(pubbytes); err != nil {
+		return block, err
+	}
+	block.validator = append([]byte(nil), pubbytes...)
+	block.validator_length = uint8(len(pubbytes))
+
+	sig, err := signer.Sign(block.ComputeSignedHash())
+	if err != nil {
+		return block, err
+	}
+	if len(sig) > int(SIGNATURE_MAX_SIZE) {
+		return block, errors.New("signature too long")
+	}
+	block.signature = sig
+	block.signature_length = uint16(len(block.signature))
+	block.ComputeBlockHash()
+
+	_, err = block.Verify()
+	if err != nil {
+		return block, err
+	}
+
+	return block, nil
+}
+
+// creates a block from its parts and an existing signature, verifying it
+func Assemble(timestamp int64, prev_hash []byte, state_root []byte, tx transaction.Transaction, validator []byte, signature []byte) (block Block, err error) {
+	if len(prev_hash) != int(HASH_SIZE) || len(state_root) != int(HASH_SIZE) {
+		return block, errors.New("block hashes have the wrong length")
+	}
+	if len(validator) == 0 || len(validator) > int(identity.PUBKEY_MAX_SIZE) {
+		return block, errors.New("validator has the wrong length")
+	}
+	if len(signature) > int(SIGNATURE_MAX_SIZE) {
+		return block, errors.New("signature too long")
+	}
+	binary.BigEndian.PutUint64(block.timestamp[:], uint64(timestamp))
+	copy(block.prev_hash[:], prev_hash)
+	copy(block.state_root[:], state_root)
+	block.validator = validator
+	block.validator_length = uint8(len(validator))
+	block.signature = signature
+	block.signature_length = uint16(len(signature))
+	block.tx = tx
+	block.ComputeSignedHash()
+	block.ComputeBlockHash()
+	_, err = block.Verify()
+	return block, err
+}
+
+// compute the hash of the transaction data
+// once a block is pruned, the stored payload hash stands in for the data
+func (block *Block) ComputePayloadHash() []byte {
+	if !block.pruned {
+		hash := crypto.SHA256.New()
+		hash.Write(block.tx.Data())
+		copy(block.payload_hash[:], hash.Sum(nil))
+	}
+	return block.payload_hash[:]
+}
+
+// compute the hash that will be signed
+// blocks sign the hash of their transaction data so they can be verified after pruning
+func (block *Block) ComputeSignedHash() []byte {
+	hash := crypto.SHA256.New()
+	hash.Write(block.timestamp[:])
+	hash.Write(block.prev_hash[:])
+	hash.Write(block.state_root[:])
+	hash.Write([]byte{block.validator_length})
+	hash.Write(block.validator)
+	hash.Write([]byte{byte(block.tx.Type())})
+	hash.Write(block.ComputePayloadHash())
+	copy(block.signed_hash[:], hash.Sum(nil))
+	return block.signed_hash[:]
+}
+
+// compute the block hash
+// the hash covers the header, so it doesn't change when the block is pruned
+func (block *Block) ComputeBlockHash() []byte {
+	hash := crypto.SHA256.New()
+	hash.Write(block.MarshalHeader())
+	copy(block.hash[:], hash.Sum(nil))
+	return block.hash[:]
+}
+
+// verify the validity of a block
+// transaction portion must be less than TX_MAX_SIZE
+// also checks for a valid signature
+func (block *Block) Verify() (bool, error) {
+
+	// verify data
+	if block.pruned && block.IsGenesis() {
+		return false, errors.New("genesis block can't be pruned")
+	}
+	if !block.pruned && len(block.tx.Marshal()) >= int(transaction.TX_MAX_SIZE) {
+		return false, errors.New("block data too long")
+	}
+
+	// verify signature
+	if int(block.validator_length) != len(block.validator) {
+		return false, errors.New("validator length doesn't match the validator")
+	}
+	err := identity.VerifyValidatorSignature(block.validator, block.ComputeSignedHash(), block.signature)
+	if err != nil {
+		return false, err
+	}
+
+	// check if valid transaction type
+	if block.tx.Type() > transaction.Revocation {
+		return false, errors.New("invalid transaction type")
+	}
+
+	return true, nil
+}
+
+// returns the hash of the block
+func (block *Block) GetHash() []byte {
+	return block.hash[:]
+}
+
+// returns the block's timestamp in seconds since the unix epoch
+func (block *Block) GetTimestamp() int64 {
+	return int64(binary.BigEndian.Uint64(block.timestamp[:]))
+}
+
+// returns the state root committed to by the block
+func (block *Block) GetStateRoot() []byte {
+	return block.state_root[:]
+}
+
+// returns the hash of the previous block
+func (block *Block) GetPrevHash() []byte {
+	return block.prev_hash[:]
+}
+
+// returns the validator's public key or multisig identifier
+func (block *Block) GetValidator() []byte {
+	return block.validator
+}
+
+// returns the validator's signature
+func (block *Block) GetSignature() []byte {
+	return block.signature
+}
+
+// returns the block's transaction, whose data is nil if the block has been pruned
+func (block *Block) GetTx() transaction.Transaction {
+	return block.tx
+}
+
+// returns the type of the block's transaction
+func (block *Block) GetTxType() transaction.Type {
+	return block.tx.Type()
+}
+
+// returns the hash of the transaction data, which is kept after pruning
+func (block *Block) GetPayloadHash() []byte {
+	return block.ComputePayloadHash()
+}
+
+// discards the block's transaction data, keeping its hash
+func (block *Block) Prune() {
+	block.ComputePayloadHash()
+	block.pruned = true
+	block.tx = transaction.New(block.tx.Type(), nil)
+}
+
+// returns true if the block's transaction data has been pruned
+func (block *Block) IsPruned() bool {
+	return block.pruned
+}
+
+// returns the block's transaction data, or ErrPruned if it has been discarded
+func (block *Block) GetPayload() ([]byte, error) {
+	if block.pruned {
+		return nil, ErrPruned
+	}
+	return block.tx.Data(), nil
+}
+
+// returns true if the block has no predecessor
+func (block *Block) IsGenesis() bool {
+	return block.prev_hash == [HASH_SIZE]byte{}
+}
+
+// returns the validator public key as a hex-encoded string
+func (block *Block) GetValidatorString() string {
+	return hex.EncodeToString(block.validator)
+}
+
+// returns a short fingerprint of the validator public key
+func (block *Block) GetValidatorFingerprint() string {
+	return identity.Fingerprint(block.validator)
+}
+
+// prints information about the block
+func (block *Block) Print() {
+	fmt.Printf("Block %x\r\n", block.hash)
+	fmt.Printf("  timestamp:  %x\r\n", block.timestamp)
+	fmt.Printf("  prev_hash:  %x\r\n", block.prev_hash)
+	fmt.Printf("  state_root: %x\r\n", block.state_root)
+	fmt.Printf("  validator:  %s\r\n", block.GetValidatorFingerprint())
+	fmt.Printf("  sig_length: %x\r\n", block.signature_length)
+	fmt.Printf("  signature:  %x\r\n", block.signature)
+	if block.pruned {
+		fmt.Printf("  data:       pruned (type %x, hash %x)\r\n", block.tx.Type(), block.payload_hash)
+	} else {
+		fmt.Printf("  data:       %x\r\n", block.tx.Marshal())
+	}
+}
+
+// a block as encoded in json
+type Info struct {
+	Hash        string `json:"hash"`
+	Timestamp   int64  `json:"timestamp"`
+	PrevHash    string `json:"prev_hash"`
+	StateRoot   string `json:"state_root"`
+	Validator   string `json:"validator"` // hex-encoded public key or multisig identifier
+	Fingerprint string `json:"fingerprint"`
+	Signature   string `json:"signature"`
+	TxType      string `json:"tx_type"`
+	PayloadHash string `json:"payload_hash"`
+	Pruned      bool   `json:"pruned,omitempty"`
+
+	Tx *transaction.Info `json:"tx,omitempty"` // nil once the block is pruned
+}
+
+// returns the decoded fields of the block
+func (block *Block) Info() Info {
+	info := Info{
+		Hash:        hex.EncodeToString(block.hash[:]),
+		Timestamp:   block.GetTimestamp(),
+		PrevHash:    hex.EncodeToString(block.prev_hash[:]),
+		StateRoot:   hex.EncodeToString(block.state_root[:]),
+		Validator:   hex.EncodeToString(block.validator),
+		Fingerprint: block.GetValidatorFingerprint(),
+		Signature:   hex.EncodeToString(block.signature),
+		TxType:      block.tx.Type().String(),
+		PayloadHash: hex.EncodeToString(block.payload_hash[:]),
+		Pruned:      block.pruned,
+	}
+	if !block.pruned {
+		tx := block.tx.Info()
+		info.Tx = &tx
+	}
+	return info
+}
+
+// the fields shared by the full and header encodings of a block
+func (block *Block) marshalSigned() []byte {
+	var d []byte
+	d = append(d, block.timestamp[:]...)
+	d = append(d, block.prev_hash[:]...)
+	d = append(d, block.state_root[:]...)
+	d = append(d, block.validator_length)
+	d = append(d, block.validator...)
+	d = binary.BigEndian.AppendUint16(d, block.signature_length)
+	d = append(d, block.signature[:]...)
+	return d
+}
+
+// creates a binary representation of the block's data
+// pruned blocks can't be marshaled in full, so they have no transaction data
+func (block *Block) Marshal() []byte {
+	d := block.marshalSigned()
+	d = append(d, block.tx.Marshal()...)
+	return d
+}
+
+// creates a binary representation of the block's header
+// the transaction data is replaced by its type and hash
+func (block *Block) MarshalHeader() []byte {
+	d := block.marshalSigned()
+	d = append(d, byte(block.tx.Type()))
+	d = append(d, block.ComputePayloadHash()...)
+	return d
+}
+
+// save block to a file in dir, named by its hash
+func (block *Block) Save(dir string) (bool, error) {
+	// create blocks directory if it doesn't exist
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	_, err := block.Verify()
+	if err != nil {
+		return false, err
+	}
+
+	hashhex := hex.EncodeToString(block.hash[:])
+	if block.pruned {
+		fname := path.Join(dir, hashhex+".hdr")
+		err = os.WriteFile(fname, block.MarshalHeader(), 0777)
+	} else {
+		fname := path.Join(dir, hashhex+".dat")
+		err = os.WriteFile(fname, block.Marshal(), 0777)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func getBounds(offset int, length int) (int, int) {
+	return offset, offset + length
+}
+
+// parses the fields shared by the full and header encodings of a block
+// returns the remaining data
+func unmarshalSigned(data []byte) (block Block, rest []byte, err error) {
+
+	// fixed-size fields plus the validator length
+	header_size := int(TIMESTAMP_SIZE) + 2*int(HASH_SIZE) + 1
+	if len(data) < header_size {
+		return block, nil, errors.New("block data too short")
+	}
+
+	var i, j int
+	i, j = getBounds(0, int(TIMESTAMP_SIZE))
+	copy(block.timestamp[:], data[i:j])
+	i, j = getBounds(j, int(HASH_SIZE))
+	copy(block.prev_hash[:], data[i:j])
+	i, j = getBounds(j, int(HASH_SIZE))
+	copy(block.state_root[:], data[i:j])
+	i, j = getBounds(j, 1)
+	block.validator_length = data[i]
+	i, j = getBounds(j, int(block.validator_length))
+	if j+2 > len(data) {
+		return block, nil, errors.New("block data too short")
+	}
+	block.validator = data[i:j]
+	i, j = getBounds(j, 2)
+	block.signature_length = binary.BigEndian.Uint16(data[i:j])
+	i, j = getBounds(j, int(block.signature_length))
+	if j >= len(data) {
+		return block, nil, errors.New("block data too short")
+	}
+	block.signature = data[i:j]
+	return block, data[j:], nil
+}
+
+func Unmarshal(data []byte) (block Block, err error) {
+
+	block, rest, err := unmarshalSigned(data)
+	if err != nil {
+		return block, err
+	}
+	err = block.tx.Unmarshal(rest)
+	if err != nil {
+		return block, err
+	}
+
+	block.ComputeSignedHash()
+	block.ComputeBlockHash()
+	_, err = block.Verify()
+	return block, err
+
+}
+
+// parses a block header, producing a pruned block
+func UnmarshalHeader(data []byte) (block Block, err error) {
+
+	block, rest, err := unmarshalSigned(data)
+	if err != nil {
+		return block, err
+	}
+	if len(rest) != 1+int(HASH_SIZE) {
+		return block, errors.New("block header has the wrong length")
+	}
+	block.tx = transaction.New(transaction.Type(rest[0]), nil)
+	copy(block.payload_hash[:], rest[1:])
+	block.pruned = true
+
+	block.ComputeSignedHash()
+	block.ComputeBlockHash()
+	_, err = block.Verify()
+	return block, err
+
+}
+
+// loads the block from a file in dir
+// if only the block's header is stored, a pruned block is returned
+func LoadBlock(dir string, hash []byte) (block Block, err error) {
+
+	hashhex := hex.EncodeToString(hash)
+	fname := path.Join(dir, hashhex+".dat")
+	data, err := os.ReadFile(fname)
+	if errors.Is(err, os.ErrNotExist) {
+		data, err = os.ReadFile(path.Join(dir, hashhex+".hdr"))
+		if err != nil {
+			return block, err
+		}
+		block, err = UnmarshalHeader(data)
+	} else if err == nil {
+		block, err = Unmarshal(data)
+	}
+	if err != nil {
+		return block, err
+	}
+
+	// a block file must hold the block it's named after
+	if !bytes.Equal(block.hash[:], hash) {
+		return Block{}, fmt.Errorf("file for block %s holds block %x", hashhex, block.hash)
+	}
+	return block, nil
+
+}
@@ -0,0 +1,97 @@
+package block
+
+import (
+	"bytes"
+	"testing"
+
+	"reddchain/identity/identitytest"
+	"reddchain/transaction"
+)
+
+func TestBlockCreation(t *testing.T) {
+	id := identitytest.Identity("main")
+
+	tx0 := transaction.NewTx_Entry([]byte("The first block."))
+	block0, err := NewBlock(GetCurrentTimestamp(), make([]byte, HASH_SIZE), make([]byte, HASH_SIZE), tx0, id)
+	if err != nil {
+		t.Fatalf("error creating block (%s)", err)
+	}
+
+	tx1 := transaction.NewTx_Entry([]byte("I added a block!"))
+	block1, err := NewBlock(GetCurrentTimestamp(), block0.hash[:], block0.state_root[:], tx1, id)
+	if err != nil {
+		t.Errorf("verification failed (%s)", err)
+	}
+
+	tx2 := transaction.NewTx_Entry([]byte("Yet another block."))
+	for i := 0; i < 2; i++ {
+		_, err := NewBlock(GetCurrentTimestamp(), block1.hash[:], block1.state_root[:], tx2, id)
+		if err != nil {
+			t.Errorf("verification failed (%s)", err)
+		}
+	}
+
+	// a block reassembled from its parts and signature is the same block
+	assembled, err := Assemble(block1.GetTimestamp(), block1.GetPrevHash(), block1.GetStateRoot(), block1.GetTx(), block1.GetValidator(), block1.GetSignature())
+	if err != nil || !bytes.Equal(assembled.GetHash(), block1.GetHash()) {
+		t.Errorf("reassembled block differs (%v)", err)
+	}
+	if _, err := Assemble(block1.GetTimestamp()+1, block1.GetPrevHash(), block1.GetStateRoot(), block1.GetTx(), block1.GetValidator(), block1.GetSignature()); err == nil {
+		t.Errorf("block was assembled with a signature over different contents")
+	}
+}
+
+func TestBlockSaving(t *testing.T) {
+	id := identitytest.Identity("main")
+
+	tx1 := transaction.NewTx_Entry([]byte("Saved."))
+	block1, err := NewBlock(GetCurrentTimestamp(), make([]byte, HASH_SIZE), make([]byte, HASH_SIZE), tx1, id)
+	if err != nil {
+		t.Errorf("error creating block (%s)", err)
+	}
+	_, err = block1.Verify()
+	if err != nil {
+		t.Errorf("error verifying block (%s)", err)
+	}
+	dir := t.TempDir()
+	_, err = block1.Save(dir)
+	if err != nil {
+		t.Errorf("error saving block (%s)", err)
+	}
+	block_loaded, err := LoadBlock(dir, block1.GetHash())
+	if err != nil {
+		block1.Print()
+		block_loaded.Print()
+		t.Errorf("error loading block %x (%s)", block1.GetHash(), err)
+	}
+	_, err = block_loaded.Verify()
+	if err != nil {
+		t.Errorf("verification failed after loading block %x (%s)", block1.GetHash(), err)
+	}
+
+}
+
+func TestBlockMalformed(t *testing.T) {
+	id := identitytest.Identity("main")
+	blk, err := NewBlock(GetCurrentTimestamp(), bytes.Repeat([]byte{1}, int(HASH_SIZE)), make([]byte, HASH_SIZE), transaction.NewTx_Entry([]byte("x")), id)
+	if err != nil {
+		t.Fatalf("error creating block (%s)", err)
+	}
+
+	// a block whose validator length runs past the end of the data is rejected
+	data := blk.Marshal()
+	data[int(TIMESTAMP_SIZE)+2*int(HASH_SIZE)] = 255
+	if _, err := Unmarshal(data); err == nil {
+		t.Errorf("block with a bad validator length was parsed")
+	}
+
+	// the payload hash is signed, so it can't be swapped out of a pruned header
+	header := blk.MarshalHeader()
+	if _, err := UnmarshalHeader(header); err != nil {
+		t.Fatalf("error parsing header (%s)", err)
+	}
+	header[len(header)-1] ^= 0x01
+	if _, err := UnmarshalHeader(header); err == nil {
+		t.Errorf("header with a modified payload hash passed verification")
+	}
+}
@@ -0,0 +1,53 @@
+package chain
+
+import (
+	"errors"
+	"fmt"
+
+	"reddchain/identity"
+)
+
+// a validator can register an alias on-chain with a transaction.Alias transaction, and is then shown by it instead of its fingerprint
+// aliases are unique within a chain, and registering a new alias replaces the validator's old one
+
+// returned when a block registers an alias that another validator already holds
+var ErrDuplicateAlias = errors.New("alias is already registered")
+
+// returns the alias registered by validator, or "" if it has none
+func (bc *Blockchain) GetAlias(validator string) string {
+	return bc.names[validator]
+}
+
+// returns the validator that registered alias, or "" if nobody has
+func (bc *Blockchain) LookupAlias(alias string) string {
+	return bc.aliases[alias]
+}
+
+// returns the name a validator is displayed by: its alias if it has one, otherwise its fingerprint
+func (bc *Blockchain) ValidatorName(validator string) string {
+	if alias := bc.GetAlias(validator); alias != "" {
+		return alias
+	}
+	return identity.FingerprintHex(validator)
+}
+
+// checks that validator can register alias
+func (bc *Blockchain) checkAlias(validator string, alias string) error {
+	if owner, ok := bc.aliases[alias]; ok && owner != validator {
+		return fmt.Errorf("%w: %s is held by %s", ErrDuplicateAlias, alias, identity.FingerprintHex(owner))
+	}
+	return nil
+}
+
+// registers alias for validator, replacing its old alias
+func (bc *Blockchain) setAlias(validator string, alias string) {
+	if bc.aliases == nil {
+		bc.aliases = make(map[string]string)
+		bc.names = make(map[string]string)
+	}
+	if old, ok := bc.names[validator]; ok {
+		delete(bc.aliases, old)
+	}
+	bc.aliases[alias] = validator
+	bc.names[validator] = alias
+}
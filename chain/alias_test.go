@@ -0,0 +1,69 @@
+package chain
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"reddchain/identity"
+	"reddchain/identity/identitytest"
+	"reddchain/transaction"
+)
+
+func TestAliases(t *testing.T) {
+	id_main := identitytest.Identity("main")
+	id_bar := identitytest.Identity("bar")
+	main_key := hex.EncodeToString(id_main.GetPubBytes())
+	bc := newTestChain(t, "aliases", id_main)
+
+	blk := newTestBlock(t, &bc, transaction.NewTx_Permission(10, id_bar.GetPubBytes()), id_main)
+	if _, err := bc.AppendBlock(blk); err != nil {
+		t.Fatalf("error delegating (%s)", err)
+	}
+	if bc.ValidatorName(main_key) != identity.Fingerprint(id_main.GetPubBytes()) {
+		t.Errorf("validator without an alias isn't shown by its fingerprint")
+	}
+
+	blk = newTestBlock(t, &bc, transaction.NewTx_Alias("acme-ops"), id_main)
+	if _, err := bc.AppendBlock(blk); err != nil {
+		t.Fatalf("error registering alias (%s)", err)
+	}
+	if bc.ValidatorName(main_key) != "acme-ops" || bc.LookupAlias("acme-ops") != main_key {
+		t.Errorf("alias wasn't registered")
+	}
+
+	// another validator can't take the alias
+	blk = newTestBlock(t, &bc, transaction.NewTx_Alias("acme-ops"), id_bar)
+	if _, err := bc.AppendBlock(blk); err == nil {
+		t.Errorf("alias was registered by two validators")
+	}
+
+	// a new alias replaces the old one, which can then be taken
+	blk = newTestBlock(t, &bc, transaction.NewTx_Alias("acme-core"), id_main)
+	if _, err := bc.AppendBlock(blk); err != nil {
+		t.Fatalf("error replacing alias (%s)", err)
+	}
+	blk = newTestBlock(t, &bc, transaction.NewTx_Alias("acme-ops"), id_bar)
+	if _, err := bc.AppendBlock(blk); err != nil {
+		t.Errorf("error registering a released alias (%s)", err)
+	}
+
+	// aliases are rebuilt when the chain is replayed
+	var nc Blockchain
+	if err := nc.Init(bc.GetGenesisBlock()); err != nil {
+		t.Fatalf("error initializing chain (%s)", err)
+	}
+	for _, b := range bc.blocks[1:] {
+		if _, err := nc.AppendBlock(b); err != nil {
+			t.Fatalf("error replaying chain (%s)", err)
+		}
+	}
+	if nc.ValidatorName(main_key) != "acme-core" || nc.ValidatorName(hex.EncodeToString(id_bar.GetPubBytes())) != "acme-ops" {
+		t.Errorf("aliases changed after replaying the chain")
+	}
+
+	for _, alias := range []string{"", "Acme", "acme ops", identity.Fingerprint(id_bar.GetPubBytes())} {
+		if err := identity.ValidAlias(alias); err == nil {
+			t.Errorf("invalid alias %q was accepted", alias)
+		}
+	}
+}
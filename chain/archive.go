@@ -0,0 +1,216 @@
+package chain
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"reddchain/block"
+)
+
+// a chain archive holds an entire chain in a single file
+//
+//	magic       8 bytes   ARCHIVE_MAGIC
+//	version     1 byte    ARCHIVE_VERSION
+//	genesis     32 bytes  hash of the genesis block
+//	label_len   2 bytes   length of the chain label
+//	label       variable
+//	count       8 bytes   number of blocks, including the genesis block
+//	blocks      count times a 4 byte length followed by the marshaled block, in height order
+//	checksum    32 bytes  sha256 of everything before it
+//
+// all integers are big endian
+const (
+	ARCHIVE_MAGIC          string = "REDDARCH"
+	ARCHIVE_VERSION        uint8  = 1
+	ARCHIVE_MAX_BLOCK_SIZE uint32 = uint32(block.BLOCK_MAX_SIZE)
+)
+
+// writes the entire chain to w as an archive
+func (bc *Blockchain) Export(w io.Writer) error {
+	checksum := sha256.New()
+	bw := bufio.NewWriter(w)
+	mw := io.MultiWriter(bw, checksum)
+
+	var header []byte
+	header = append(header, []byte(ARCHIVE_MAGIC)...)
+	header = append(header, ARCHIVE_VERSION)
+	header = append(header, bc.GetGenesisHash()...)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(bc.label)))
+	header = append(header, []byte(bc.label)...)
+	header = binary.BigEndian.AppendUint64(header, uint64(len(bc.blocks)))
+	if _, err := mw.Write(header); err != nil {
+		return err
+	}
+
+	for i, blk := range bc.blocks {
+		if blk.IsPruned() {
+			return fmt.Errorf("block %d (%x): %w", i, blk.GetHash(), block.ErrPruned)
+		}
+		data := blk.Marshal()
+		length := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+		if _, err := mw.Write(length); err != nil {
+			return err
+		}
+		if _, err := mw.Write(data); err != nil {
+			return err
+		}
+	}
+
+	if _, err := bw.Write(checksum.Sum(nil)); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// reads exactly len(b) bytes, adding them to the checksum
+func readArchive(r io.Reader, checksum hash.Hash, b []byte) error {
+	if _, err := io.ReadFull(r, b); err != nil {
+		return fmt.Errorf("archive truncated (%w)", err)
+	}
+	checksum.Write(b)
+	return nil
+}
+
+// reads a chain from an archive
+// every block is verified by appending it to a new chain built on the archive's genesis block
+func ImportChain(r io.Reader) (bc Blockchain, err error) {
+	br := bufio.NewReader(r)
+	checksum := sha256.New()
+
+	magic := make([]byte, len(ARCHIVE_MAGIC))
+	if err = readArchive(br, checksum, magic); err != nil {
+		return bc, err
+	}
+	if string(magic) != ARCHIVE_MAGIC {
+		return bc, errors.New("not a chain archive")
+	}
+
+	version := make([]byte, 1)
+	if err = readArchive(br, checksum, version); err != nil {
+		return bc, err
+	}
+	if version[0] != ARCHIVE_VERSION {
+		return bc, fmt.Errorf("unsupported archive version %d", version[0])
+	}
+
+	genesis_hash := make([]byte, block.HASH_SIZE)
+	if err = readArchive(br, checksum, genesis_hash); err != nil {
+		return bc, err
+	}
+
+	label_len := make([]byte, 2)
+	if err = readArchive(br, checksum, label_len); err != nil {
+		return bc, err
+	}
+	label := make([]byte, binary.BigEndian.Uint16(label_len))
+	if err = readArchive(br, checksum, label); err != nil {
+		return bc, err
+	}
+
+	count_bytes := make([]byte, 8)
+	if err = readArchive(br, checksum, count_bytes); err != nil {
+		return bc, err
+	}
+	count := binary.BigEndian.Uint64(count_bytes)
+	if count == 0 {
+		return bc, errors.New("archive contains no blocks")
+	}
+
+	length := make([]byte, 4)
+	for i := uint64(0); i < count; i++ {
+		if err = readArchive(br, checksum, length); err != nil {
+			return bc, err
+		}
+		n := binary.BigEndian.Uint32(length)
+		if n > ARCHIVE_MAX_BLOCK_SIZE {
+			return bc, fmt.Errorf("block %d is too large (%d bytes)", i, n)
+		}
+		data := make([]byte, n)
+		if err = readArchive(br, checksum, data); err != nil {
+			return bc, err
+		}
+
+		blk, err := block.Unmarshal(data)
+		if err != nil {
+			return bc, fmt.Errorf("block %d: %w", i, err)
+		}
+
+		if i == 0 {
+			if !bytes.Equal(blk.GetHash(), genesis_hash) {
+				return bc, errors.New("first block doesn't match the archive's genesis hash")
+			}
+			if err = bc.Init(blk); err != nil {
+				return bc, err
+			}
+			if bc.label != string(label) {
+				return bc, fmt.Errorf("archive for chain %s contains the genesis block of chain %s", label, bc.label)
+			}
+		} else if _, err = bc.AppendBlock(blk); err != nil {
+			return bc, &VerifyError{Height: int(i), Hash: blk.GetHash(), Err: err}
+		}
+	}
+
+	expected := checksum.Sum(nil)
+	actual := make([]byte, len(expected))
+	if _, err = io.ReadFull(br, actual); err != nil {
+		return bc, fmt.Errorf("archive checksum missing (%w)", err)
+	}
+	if !bytes.Equal(expected, actual) {
+		return bc, errors.New("archive checksum doesn't match")
+	}
+
+	return bc, nil
+}
+
+// exports the chain with the given label from the data directory dir to a file
+func ExportChainFile(dir string, label string, fname string) error {
+	bc, err := LoadChain(dir, label)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = bc.Export(f)
+	if err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// imports a chain from a file and replaces the chain with the same label in the data directory dir
+// the local chain is only replaced if the archive verifies and shares its genesis block
+func ImportChainFile(dir string, fname string) (bc Blockchain, err error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return bc, err
+	}
+	defer f.Close()
+
+	bc, err = ImportChain(f)
+	if err != nil {
+		return bc, err
+	}
+
+	local, err := LoadChain(dir, bc.label)
+	if err == nil {
+		if !bytes.Equal(local.GetGenesisHash(), bc.GetGenesisHash()) {
+			return bc, fmt.Errorf("local chain %s has a different genesis block", bc.label)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return bc, err
+	}
+
+	return bc, bc.Save(dir)
+}
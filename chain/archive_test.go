@@ -0,0 +1,107 @@
+package chain
+
+import (
+	"bytes"
+	"testing"
+
+	"reddchain/block"
+	"reddchain/identity"
+	"reddchain/identity/identitytest"
+	"reddchain/transaction"
+)
+
+func TestArchiveRoundTrip(t *testing.T) {
+	bc := newTestChain(t, "archive", identitytest.Identity("main"),
+		transaction.NewTx_Entry([]byte("first")),
+		transaction.NewTx_Permission(5, identitytest.Identity("bar").GetPubBytes()),
+		transaction.NewTx_Entry([]byte("third")))
+
+	var buf bytes.Buffer
+	if err := bc.Export(&buf); err != nil {
+		t.Fatalf("error exporting chain (%s)", err)
+	}
+
+	imported, err := ImportChain(&buf)
+	if err != nil {
+		t.Fatalf("error importing chain (%s)", err)
+	}
+	if imported.label != bc.label {
+		t.Errorf("imported label %s doesn't match %s", imported.label, bc.label)
+	}
+	if len(imported.blocks) != len(bc.blocks) {
+		t.Errorf("imported %d blocks, expected %d", len(imported.blocks), len(bc.blocks))
+	}
+	if !bytes.Equal(imported.GetTipHash(), bc.GetTipHash()) {
+		t.Errorf("imported tip %x doesn't match %x", imported.GetTipHash(), bc.GetTipHash())
+	}
+	if !bytes.Equal(imported.GetStateRoot(), bc.GetStateRoot()) {
+		t.Errorf("imported state doesn't match")
+	}
+}
+
+func TestArchiveCorruption(t *testing.T) {
+	bc := newTestChain(t, "archive", identitytest.Identity("main"), transaction.NewTx_Entry([]byte("first")), transaction.NewTx_Entry([]byte("second")))
+
+	var buf bytes.Buffer
+	if err := bc.Export(&buf); err != nil {
+		t.Fatalf("error exporting chain (%s)", err)
+	}
+	archive := buf.Bytes()
+
+	// flip a bit in the last block's transaction data
+	corrupt := append([]byte{}, archive...)
+	corrupt[len(corrupt)-int(block.HASH_SIZE)-1] ^= 0x01
+	if _, err := ImportChain(bytes.NewReader(corrupt)); err == nil {
+		t.Errorf("archive with a corrupted block was imported")
+	}
+
+	// flip a bit in the checksum
+	corrupt = append([]byte{}, archive...)
+	corrupt[len(corrupt)-1] ^= 0x01
+	if _, err := ImportChain(bytes.NewReader(corrupt)); err == nil {
+		t.Errorf("archive with a bad checksum was imported")
+	}
+
+	// cut the archive short
+	if _, err := ImportChain(bytes.NewReader(archive[:len(archive)/2])); err == nil {
+		t.Errorf("truncated archive was imported")
+	}
+}
+
+func TestArchiveLargeBlock(t *testing.T) {
+	id := identitytest.Identity("main")
+	var officers []identity.Signer
+	var keys [][]byte
+	for i := 0; i < int(identity.MULTISIG_MAX_KEYS); i++ {
+		officer := identitytest.NewIdentity(t, identity.ALGORITHM_P384)
+		officers = append(officers, officer)
+		keys = append(keys, officer.GetPubBytes())
+	}
+	policy, err := identity.NewMultisigPolicy(identity.MULTISIG_MAX_KEYS, keys)
+	if err != nil {
+		t.Fatalf("error creating policy (%s)", err)
+	}
+	signer, err := identity.NewMultisigSigner(policy, officers)
+	if err != nil {
+		t.Fatalf("error creating multisig signer (%s)", err)
+	}
+
+	// a multisig block with the largest transaction the chain accepts
+	bc := newTestChain(t, "archive-large", id, transaction.NewTx_Multisig(policy), transaction.NewTx_Permission(1, policy.ID()))
+	large := newTestBlock(t, &bc, transaction.NewTx_Entry(make([]byte, transaction.TX_MAX_SIZE-2)), signer)
+	if _, err := bc.AppendBlock(large); err != nil {
+		t.Fatalf("error appending large block (%s)", err)
+	}
+
+	var buf bytes.Buffer
+	if err := bc.Export(&buf); err != nil {
+		t.Fatalf("error exporting chain (%s)", err)
+	}
+	imported, err := ImportChain(&buf)
+	if err != nil {
+		t.Fatalf("error importing chain with a %d byte block (%s)", len(large.Marshal()), err)
+	}
+	if !bytes.Equal(imported.GetTipHash(), large.GetHash()) {
+		t.Errorf("imported tip %x doesn't match %x", imported.GetTipHash(), large.GetHash())
+	}
+}
@@ -0,0 +1,130 @@
+package chain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"reddchain/block"
+)
+
+// VerifyError reports the first block of a chain that failed verification
+type VerifyError struct {
+	Height int // height of the block, or -1 if the chain is broken before the block could be placed
+	Hash   []byte
+	Err    error
+}
+
+func (e *VerifyError) Error() string {
+	if e.Height < 0 {
+		return fmt.Sprintf("block %x: %s", e.Hash, e.Err)
+	}
+	return fmt.Sprintf("block %d (%x): %s", e.Height, e.Hash, e.Err)
+}
+
+func (e *VerifyError) Unwrap() error {
+	return e.Err
+}
+
+// reads the hashes of the genesis and tip blocks of a saved chain
+func readIndex(dir string, label string) (genesis_hash []byte, tip_hash []byte, err error) {
+	data, err := os.ReadFile(path.Join(dir, BLOCKCHAIN_DIR, label+".json"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	d := make(map[string][]byte)
+	err = json.Unmarshal(data, &d)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(d["genesis"]) != int(block.HASH_SIZE) || len(d["tip"]) != int(block.HASH_SIZE) {
+		return nil, nil, fmt.Errorf("index of chain %s is missing the genesis or tip hash", label)
+	}
+	return d["genesis"], d["tip"], nil
+}
+
+// loads the blocks of a saved chain, genesis first, by following prev_hash back from the tip
+// the blocks' signatures are checked as they are loaded, but not the rules of the chain
+func loadBlocks(dir string, label string) ([]block.Block, error) {
+	genesis_hash, hash, err := readIndex(dir, label)
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks []block.Block
+	for {
+		blk, err := block.LoadBlock(path.Join(dir, BLOCKS_DIR), hash)
+		if err != nil && len(blocks) == 0 {
+			return nil, &VerifyError{Height: -1, Hash: hash, Err: fmt.Errorf("tip of the chain: %w", err)}
+		} else if err != nil {
+			child := blocks[len(blocks)-1]
+			return nil, &VerifyError{Height: -1, Hash: hash, Err: fmt.Errorf("previous block of %x: %w", child.GetHash(), err)}
+		}
+		blocks = append(blocks, blk)
+		if bytes.Equal(hash, genesis_hash) {
+			break
+		}
+		if blk.IsGenesis() {
+			return nil, &VerifyError{Height: -1, Hash: hash, Err: errors.New("chain leads to a genesis block other than the one in its index")}
+		}
+		hash = blk.GetPrevHash()
+	}
+
+	i := 0
+	j := len(blocks) - 1
+	for i < j {
+		blocks[i], blocks[j] = blocks[j], blocks[i]
+		i += 1
+		j -= 1
+	}
+	return blocks, nil
+}
+
+// checks a chain saved in the data directory dir offline, without a server
+// every block is loaded and replayed as LoadChain does, re-checking signatures, linkage and permissions,
+// then the genesis block is compared with the chain's genesis file and pruned blocks with their cold copies,
+// where those exist
+// if the chain fails, the error is a *VerifyError for the first failing block whenever one can be named
+func VerifyChain(dir string, label string) (bc Blockchain, err error) {
+	bc, err = LoadChain(dir, label)
+	if err != nil {
+		return bc, err
+	}
+
+	genesis := bc.GetGenesisBlock()
+	gf, err := LoadGenesisFile(dir, label)
+	if err == nil {
+		var blk block.Block
+		blk, err = gf.Block()
+		if err == nil && !bytes.Equal(blk.GetHash(), genesis.GetHash()) {
+			err = fmt.Errorf("doesn't match the genesis file in %s", path.Join(dir, GENESIS_DIR))
+		}
+	} else if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	if err != nil {
+		return bc, &VerifyError{Height: 0, Hash: genesis.GetHash(), Err: err}
+	}
+
+	for i, blk := range bc.blocks {
+		if !blk.IsPruned() {
+			continue
+		}
+		cold, err := LoadColdBlock(dir, blk.GetHash())
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err == nil && !bytes.Equal(cold.GetPayloadHash(), blk.GetPayloadHash()) {
+			err = errors.New("payload hash doesn't match the pruned block")
+		}
+		if err != nil {
+			return bc, &VerifyError{Height: i, Hash: blk.GetHash(), Err: fmt.Errorf("cold copy: %w", err)}
+		}
+	}
+
+	return bc, nil
+}
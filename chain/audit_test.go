@@ -0,0 +1,89 @@
+package chain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path"
+	"testing"
+
+	"reddchain/block"
+	"reddchain/identity/identitytest"
+	"reddchain/transaction"
+)
+
+// saves a chain of entries minted by the main identity to a temporary data directory
+func newAuditTestChain(t *testing.T, label string) Blockchain {
+	var txs []transaction.Transaction
+	for _, entry := range []string{"one", "two", "three"} {
+		txs = append(txs, transaction.NewTx_Entry([]byte(label+entry)))
+	}
+	bc := newTestChain(t, label, identitytest.Identity("main"), txs...)
+	if err := bc.Save(t.TempDir()); err != nil {
+		t.Fatalf("error saving chain (%s)", err)
+	}
+	return bc
+}
+
+func blockFile(dir string, blk block.Block) string {
+	return path.Join(dir, BLOCKS_DIR, hex.EncodeToString(blk.GetHash())+".dat")
+}
+
+func TestVerifyChain(t *testing.T) {
+	bc := newAuditTestChain(t, "audit")
+	loaded, err := VerifyChain(bc.dir, "audit")
+	if err != nil {
+		t.Fatalf("error verifying chain (%s)", err)
+	}
+	if loaded.Height() != bc.Height() {
+		t.Errorf("verified chain has height %d, expected %d", loaded.Height(), bc.Height())
+	}
+
+	// a block signed by a validator without an allowance
+	blk := newTestBlock(t, &bc, transaction.NewTx_Entry([]byte("intruder")), identitytest.Identity("bar"))
+	bc.blocks = append(bc.blocks, blk)
+	if err := bc.saveBlock(blk); err != nil {
+		t.Fatalf("error saving tip (%s)", err)
+	}
+	_, err = VerifyChain(bc.dir, "audit")
+	var verr *VerifyError
+	if !errors.As(err, &verr) || verr.Height != 4 || !errors.Is(err, ErrNotAuthorized) {
+		t.Errorf("unauthorized block at height 4 wasn't reported, got %v", err)
+	}
+}
+
+func TestVerifyChainTampered(t *testing.T) {
+	bc := newAuditTestChain(t, "tampered")
+
+	// swap the contents of a block file for a different, validly signed block
+	middle := bc.blocks[2]
+	other := bc.blocks[1]
+	if err := os.WriteFile(blockFile(bc.dir, middle), other.Marshal(), 0777); err != nil {
+		t.Fatal(err)
+	}
+	_, err := VerifyChain(bc.dir, "tampered")
+	var verr *VerifyError
+	if !errors.As(err, &verr) || !bytes.Equal(verr.Hash, middle.GetHash()) {
+		t.Errorf("swapped block file wasn't reported, got %v", err)
+	}
+
+	// flip a bit of the signed data
+	data := middle.Marshal()
+	data[0] ^= 0x01
+	if err := os.WriteFile(blockFile(bc.dir, middle), data, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyChain(bc.dir, "tampered"); !errors.As(err, &verr) {
+		t.Errorf("corrupted block wasn't reported, got %v", err)
+	}
+
+	// remove the block
+	if err := os.Remove(blockFile(bc.dir, middle)); err != nil {
+		t.Fatal(err)
+	}
+	_, err = VerifyChain(bc.dir, "tampered")
+	if !errors.As(err, &verr) || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing block wasn't reported, got %v", err)
+	}
+}
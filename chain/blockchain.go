@@ -0,0 +1,371 @@
+// Package chain validates blocks against a chain's genesis, validator state and certificates, and stores chains on disk.
+package chain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"reddchain/block"
+	"reddchain/identity"
+	"reddchain/transaction"
+)
+
+// the layout of a data directory, relative to its root
+const (
+	BLOCKS_DIR     string = "blocks"      // blocks, named by their hashes
+	BLOCKCHAIN_DIR string = "blockchains" // the genesis and tip hashes of each chain
+	COLD_DIR       string = "cold"        // full copies of pruned blocks
+	GENESIS_DIR    string = "genesis"     // genesis files, named by chain id
+)
+
+// the chain used when none is named
+const MAIN_CHAIN_NAME string = "main"
+
+// an allowance that is never used up
+const UNLIMITED_ALLOWANCE uint32 = 4294967295
+
+type Blockchain struct {
+	label      string
+	blocks     []block.Block
+	validators map[string]uint32 // validators and how many blocks they are allowed to mint
+	aliases    map[string]string // registered aliases and the validators they name
+	names      map[string]string // validators and their registered aliases
+	certs      *cert_state_t     // validator certificates, nil unless the chain is certificate-bound
+	consensus  ConsensusParams
+	dir        string // the data directory the chain is saved in, empty until it's saved or loaded
+}
+
+// returned when a block doesn't build on the chain's tip, usually because another block was appended first
+var ErrStaleTip = errors.New("candidate block doesn't contain hash of previous block")
+
+// returned when a valid block couldn't be saved, in which case it isn't appended
+var ErrNotSaved = errors.New("block couldn't be saved")
+
+// returned when a block doesn't fit the chain's rules
+var (
+	ErrTxTooLarge     = errors.New("transaction is larger than the chain's limit")
+	ErrWrongStateRoot = errors.New("candidate block has the wrong state root")
+)
+
+// returns true if label can be used to name a chain, see identity.ValidLabel
+func ValidChainLabel(label string) bool {
+	return identity.ValidLabel(label)
+}
+
+// initialize the blockchain with a genesis block
+// the chain's label, validators and consensus parameters come from the block's specification
+func (bc *Blockchain) Init(genesis block.Block) error {
+	spec, err := ParseGenesisBlock(genesis)
+	if err != nil {
+		return err
+	}
+	bc.label = spec.ChainID
+	bc.blocks = []block.Block{genesis}
+	bc.validators = spec.State()
+	bc.aliases = make(map[string]string)
+	bc.names = make(map[string]string)
+	bc.certs, err = newCertState(&spec)
+	if err != nil {
+		return err
+	}
+	bc.consensus = spec.Consensus
+	return nil
+}
+
+// appends a block to the chain if the block is valid
+func (bc *Blockchain) AppendBlock(blk block.Block) (bool, error) {
+	return bc.appendBlock(blk, nil)
+}
+
+// appends a block to a chain that was already saved if the block is valid
+// the block and the new tip are written before the chain changes, so a block that can't be saved isn't appended
+// a valid block that couldn't be saved is reported with ErrNotSaved
+func (bc *Blockchain) AppendAndSave(blk block.Block) (bool, error) {
+	if bc.dir == "" {
+		return false, fmt.Errorf("%w: chain %s hasn't been saved", ErrNotSaved, bc.label)
+	}
+	return bc.appendBlock(blk, bc.saveBlock)
+}
+
+// appends a block if it's valid, calling save first if it isn't nil
+func (bc *Blockchain) appendBlock(blk block.Block, save func(block.Block) error) (bool, error) {
+	_, err := blk.Verify()
+	if err != nil {
+		return false, err
+	}
+	tx := blk.GetTx()
+	if !blk.IsPruned() && len(tx.Data()) > int(bc.consensus.MaxTxSize) {
+		return false, fmt.Errorf("%w of %d bytes", ErrTxTooLarge, bc.consensus.MaxTxSize)
+	}
+
+	// check that block hashes actually form a chain
+	if !bytes.Equal(blk.GetPrevHash(), bc.blocks[len(bc.blocks)-1].ComputeBlockHash()) {
+		return false, fmt.Errorf("%w\r\n  candidate prev_hash %x\r\n  hash of prev        %x\r\n", ErrStaleTip, blk.GetPrevHash(), bc.blocks[len(bc.blocks)-1].ComputeBlockHash())
+	}
+
+	// apply the transaction to the validator state
+	validator := blk.GetValidatorString()
+	next, err := ApplyTx(bc.validators, validator, tx)
+	if err != nil {
+		return false, err
+	}
+
+	// aliases must be unique across the chain
+	var alias string
+	if blk.GetTxType() == transaction.Alias {
+		alias, _ = tx.ParseTx_Alias()
+		if err := bc.checkAlias(validator, alias); err != nil {
+			return false, err
+		}
+	}
+
+	// in a certificate-bound chain, the signers' certificates must be valid when the block is minted
+	tip := bc.GetTip()
+	certs, err := bc.certs.ApplyBlock(&blk, tip.GetTimestamp())
+	if err != nil {
+		return false, err
+	}
+
+	// check that the block commits to the state we arrived at
+	root := StateRoot(next)
+	if !bytes.Equal(blk.GetStateRoot(), root) {
+		return false, fmt.Errorf("%w\r\n  candidate state_root %x\r\n  computed state_root  %x\r\n", ErrWrongStateRoot, blk.GetStateRoot(), root)
+	}
+
+	// the saved chain must never skip a block, so the block is saved before it's added
+	if save != nil {
+		if err := save(blk); err != nil {
+			return false, fmt.Errorf("%w (%w)", ErrNotSaved, err)
+		}
+	}
+
+	// add the block to the blockchain
+	bc.validators = next
+	bc.certs = certs
+	if blk.GetTxType() == transaction.Alias {
+		bc.setAlias(validator, alias)
+	}
+	bc.blocks = append(bc.blocks, blk)
+	return true, nil
+}
+
+// verifies the validitity of the chain
+// basically rebuilds a new chain and checks if it hits any errors
+func (bc *Blockchain) Verify() (bool, error) {
+	var nc Blockchain
+
+	err := nc.Init(bc.GetGenesisBlock())
+	if err != nil {
+		return false, err
+	}
+	for i, blk := range bc.blocks {
+		if i > 0 {
+			_, err := nc.AppendBlock(blk)
+			if err != nil {
+				return false, &VerifyError{Height: i, Hash: blk.GetHash(), Err: err}
+			}
+		}
+	}
+	return true, nil
+}
+
+// returns the state root for a block minted by validator containing tx
+// if the validator isn't allowed to mint it, an error is returned
+func (bc *Blockchain) NextStateRoot(validator []byte, tx transaction.Transaction) ([]byte, error) {
+	next, err := ApplyTx(bc.validators, hex.EncodeToString(validator), tx)
+	if err != nil {
+		return nil, err
+	}
+	return StateRoot(next), nil
+}
+
+// returns the merkle root of the current validator state
+func (bc *Blockchain) GetStateRoot() []byte {
+	return StateRoot(bc.validators)
+}
+
+// returns a copy of the current validator state
+func (bc *Blockchain) GetValidators() map[string]uint32 {
+	return copyState(bc.validators)
+}
+
+// a validator with its fingerprint and alias
+type ValidatorInfo struct {
+	Fingerprint string `json:"fingerprint"`
+	Alias       string `json:"alias,omitempty"`
+	PubKey      string `json:"pubkey"` // hex-encoded public key or multisig identifier
+	Allowance   uint32 `json:"allowance"`
+	Unlimited   bool   `json:"unlimited,omitempty"`
+}
+
+// returns the validators with their fingerprints and aliases, sorted by public key
+func (bc *Blockchain) ValidatorInfos() []ValidatorInfo {
+	list := []ValidatorInfo{}
+	for _, v := range SortedValidators(bc.validators) {
+		list = append(list, ValidatorInfo{
+			Fingerprint: identity.FingerprintHex(v),
+			Alias:       bc.GetAlias(v),
+			PubKey:      v,
+			Allowance:   bc.validators[v],
+			Unlimited:   IsUnlimited(bc.validators[v]),
+		})
+	}
+	return list
+}
+
+// saves all of the blocks in the blockchain to files in the data directory dir, named by their hashes
+func (bc *Blockchain) SaveBlocks(dir string) error {
+	for _, blk := range bc.blocks {
+		_, err := blk.Save(path.Join(dir, BLOCKS_DIR))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// returns the label the chain is saved under
+func (bc *Blockchain) Label() string {
+	return bc.label
+}
+
+// returns the data directory the chain is saved in, or "" if it's only in memory
+func (bc *Blockchain) Dir() string {
+	return bc.dir
+}
+
+// returns the height of the tip, the genesis block being at height 0
+func (bc *Blockchain) Height() int {
+	return len(bc.blocks) - 1
+}
+
+// returns the block at the tip of the blockchain
+func (bc *Blockchain) GetTip() block.Block {
+	return bc.blocks[len(bc.blocks)-1]
+}
+
+// gets the hash of the block at the tip of the blockchain
+func (bc *Blockchain) GetTipHash() []byte {
+	return bc.blocks[len(bc.blocks)-1].GetHash()
+}
+
+// returns the block with the given hash and its height
+func (bc *Blockchain) GetBlock(hash []byte) (block.Block, int, error) {
+	for i, blk := range bc.blocks {
+		if bytes.Equal(blk.GetHash(), hash) {
+			return blk, i, nil
+		}
+	}
+	return block.Block{}, -1, errors.New("block not found")
+}
+
+// returns the block at the given height
+func (bc *Blockchain) GetBlockAt(height int) (block.Block, error) {
+	if height < 0 || height >= len(bc.blocks) {
+		return block.Block{}, errors.New("block not found")
+	}
+	return bc.blocks[height], nil
+}
+
+// returns the genesis block
+func (bc *Blockchain) GetGenesisBlock() block.Block {
+	return bc.blocks[0]
+}
+
+// returns the hash of the genesis block
+func (bc *Blockchain) GetGenesisHash() []byte {
+	return bc.blocks[0].GetHash()
+}
+
+// saves the entire blockchain to the data directory dir
+// first verifies the chain
+// if verified, then all of the blocks are saved to files
+// then saves a file that contains the hashes of the tip and genesis blocks, so it never points at a missing block
+// later calls to AppendAndSave save to the same directory
+func (bc *Blockchain) Save(dir string) error {
+	if _, err := bc.Verify(); err != nil { // only save the chain if it's valid
+		return err
+	}
+	if err := bc.SaveBlocks(dir); err != nil { // to reconstruct chain later
+		return err
+	}
+	bc.dir = dir
+	return bc.saveIndex(bc.GetTipHash())
+}
+
+// saves a block to the chain's directory and makes it the saved tip
+func (bc *Blockchain) saveBlock(blk block.Block) error {
+	if _, err := blk.Save(path.Join(bc.dir, BLOCKS_DIR)); err != nil {
+		return err
+	}
+	return bc.saveIndex(blk.GetHash())
+}
+
+// saves the file that contains the hashes of the genesis block and tip
+func (bc *Blockchain) saveIndex(tip []byte) error {
+	index_dir := path.Join(bc.dir, BLOCKCHAIN_DIR)
+	if _, err := os.Stat(index_dir); os.IsNotExist(err) {
+		err := os.MkdirAll(index_dir, 0755)
+		if err != nil {
+			return err
+		}
+	}
+
+	d := make(map[string][]byte)
+	d["genesis"] = bc.GetGenesisHash()
+	d["tip"] = tip
+	data, err := json.MarshalIndent(d, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	fname := path.Join(index_dir, bc.label+".json")
+	return os.WriteFile(fname, data, 0777)
+
+}
+
+// prints every block in the blockchain, along with validator information
+func (bc *Blockchain) Print() {
+	fmt.Println("Blocks")
+	for i, blk := range bc.blocks {
+		fmt.Printf("%d ", i)
+		blk.Print()
+		fmt.Println("")
+	}
+
+	fmt.Println("Validators")
+	for _, v := range SortedValidators(bc.validators) {
+		c := bc.validators[v]
+		fmt.Printf("%-20s %s\r\n", bc.ValidatorName(v), FormatAllowance(c, true))
+	}
+}
+
+// loads a chain saved in the data directory dir, rebuilding its state by replaying every block
+// a block that fails is reported as a *VerifyError
+func LoadChain(dir string, label string) (bc Blockchain, err error) {
+	blocks, err := loadBlocks(dir, label)
+	if err != nil {
+		return bc, err
+	}
+
+	err = bc.Init(blocks[0])
+	if err != nil {
+		return bc, &VerifyError{Height: 0, Hash: blocks[0].GetHash(), Err: err}
+	}
+	if bc.label != label {
+		return bc, fmt.Errorf("chain %s has the genesis block of chain %s", label, bc.label)
+	}
+	for i, blk := range blocks[1:] {
+		_, err = bc.AppendBlock(blk)
+		if err != nil {
+			return bc, &VerifyError{Height: i + 1, Hash: blk.GetHash(), Err: err}
+		}
+	}
+	bc.dir = dir
+	return bc, nil
+}
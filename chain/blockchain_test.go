@@ -0,0 +1,306 @@
+package chain
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"reddchain/block"
+	"reddchain/identity"
+	"reddchain/identity/identitytest"
+	"reddchain/transaction"
+)
+
+// creates a chain from a specification whose only genesis validator is id
+// other packages' tests use chaintest, which can't be imported here
+func newSpecTestChain(t *testing.T, spec GenesisSpec, id identity.Signer) (bc Blockchain) {
+	gf, err := SignGenesis(GenesisFile{Spec: spec}, id)
+	if err != nil {
+		t.Fatalf("error signing genesis (%s)", err)
+	}
+	genesis, err := gf.Block()
+	if err != nil {
+		t.Fatalf("error creating genesis block (%s)", err)
+	}
+	if err := bc.Init(genesis); err != nil {
+		t.Fatalf("error initializing chain (%s)", err)
+	}
+	return bc
+}
+
+// creates a chain whose only genesis validator is id, then appends a block minted by id for each of txs
+func newTestChain(t *testing.T, label string, id identity.Signer, txs ...transaction.Transaction) Blockchain {
+	bc := newSpecTestChain(t, NewGenesisSpec(label, id), id)
+	for _, tx := range txs {
+		if _, err := bc.AppendBlock(newTestBlock(t, &bc, tx, id)); err != nil {
+			t.Fatalf("error appending block (%s)", err)
+		}
+	}
+	return bc
+}
+
+// creates a block on top of the chain's tip, committing to the resulting state
+func newTestBlock(t *testing.T, bc *Blockchain, tx transaction.Transaction, id identity.Signer) block.Block {
+	state_root, err := bc.NextStateRoot(id.GetPubBytes(), tx)
+	if err != nil {
+		state_root = bc.GetStateRoot() // let AppendBlock reject it
+	}
+	blk, err := block.NewBlock(block.GetCurrentTimestamp(), bc.GetTipHash(), state_root, tx, id)
+	if err != nil {
+		t.Fatalf("error creating block (%s)", err)
+	}
+	return blk
+}
+
+func TestBlockchain_NewChain(t *testing.T) {
+	id := identitytest.Identity("main")
+
+	bc1 := newTestChain(t, "test", id)
+
+	tx1 := transaction.NewTx_Entry([]byte("hello!"))
+	blk1 := newTestBlock(t, &bc1, tx1, id)
+
+	_, err := bc1.AppendBlock(blk1)
+	if err != nil {
+		bc1.Print()
+		t.Errorf("error appending first block (%s)", err)
+	}
+
+	_, err = bc1.AppendBlock(blk1) // this should throw an error because prev_hash won't match
+	if err == nil {
+		bc1.Print()
+		t.Errorf("error appending this block (should be invalid) (%s)", err)
+	}
+
+	tx2 := transaction.NewTx_Entry([]byte("hey."))
+	blk2 := newTestBlock(t, &bc1, tx2, id)
+
+	_, err = bc1.AppendBlock(blk2)
+	if err != nil {
+		bc1.Print()
+		t.Errorf("error appending second block (%s)", err)
+	}
+
+	_, err = bc1.Verify()
+	if err != nil {
+		bc1.Print()
+		t.Errorf("error verifying blockchain (%s)", err)
+	}
+
+	err = bc1.Save(t.TempDir())
+	if err != nil {
+		bc1.Print()
+		t.Errorf("error saving blockchain (%s)", err)
+	}
+}
+
+func TestBlockchainDelegation(t *testing.T) {
+	id_main := identitytest.Identity("main")
+	id_bar := identitytest.Identity("bar")
+	id_foo := identitytest.Identity("foo")
+
+	bc1 := newTestChain(t, "bar", id_main)
+
+	tx1 := transaction.NewTx_Permission(100, id_bar.GetPubBytes())
+	blk1 := newTestBlock(t, &bc1, tx1, id_main)
+	_, err := bc1.AppendBlock(blk1)
+	if err != nil {
+		bc1.Print()
+		t.Errorf("error appending first block to blockchain (%s)", err)
+	}
+
+	tx2 := transaction.NewTx_Permission(200, id_foo.GetPubBytes())
+	blk2i := newTestBlock(t, &bc1, tx2, id_bar)
+	_, err = bc1.AppendBlock(blk2i)
+	if err == nil {
+		bc1.Print()
+		t.Errorf("this should result in an error because bar can't delegate 200 blocks, but you allowed it to happen")
+	}
+
+	blk2 := newTestBlock(t, &bc1, tx2, id_main)
+	_, err = bc1.AppendBlock(blk2)
+	if err != nil {
+		bc1.Print()
+		t.Errorf("error appending second block to blockchain (%s)", err)
+	}
+
+	tx3 := transaction.NewTx_Permission(50, id_foo.GetPubBytes())
+	blk3 := newTestBlock(t, &bc1, tx3, id_bar)
+	_, err = bc1.AppendBlock(blk3)
+	if err != nil {
+		bc1.Print()
+		t.Errorf("error appending second block to blockchain (%s)", err)
+	}
+
+}
+
+func TestBlockchainLoad(t *testing.T) {
+	id := identitytest.Identity("main")
+	dir := t.TempDir()
+	saved := newTestChain(t, "test", id, transaction.NewTx_Entry([]byte("hello!")), transaction.NewTx_Entry([]byte("hey.")))
+	if err := saved.Save(dir); err != nil {
+		t.Fatalf("error saving chain (%s)", err)
+	}
+
+	bc, err := LoadChain(dir, "test")
+	if err != nil {
+		t.Errorf("error loading chain (%s)", err)
+	}
+	tip := bc.GetTip()
+	if !bytes.Equal(bc.GetStateRoot(), tip.GetStateRoot()) {
+		t.Errorf("state of loaded chain doesn't match the state root of its tip")
+	}
+}
+
+func TestBlockchainSaveErrors(t *testing.T) {
+	id := identitytest.Identity("main")
+	bc := newTestChain(t, "save-errors", id)
+	if _, err := bc.AppendBlock(newTestBlock(t, &bc, transaction.NewTx_Entry([]byte("saved")), id)); err != nil {
+		t.Fatalf("error appending block (%s)", err)
+	}
+
+	// blocks that can't be written leave no index behind
+	dir := t.TempDir()
+	if err := os.WriteFile(path.Join(dir, BLOCKS_DIR), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.Save(dir); err == nil {
+		t.Errorf("chain was saved without its blocks")
+	}
+	if _, err := os.Stat(path.Join(dir, BLOCKCHAIN_DIR, "save-errors.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("index was written without the blocks (%v)", err)
+	}
+
+	// an invalid chain isn't saved
+	invalid := bc
+	invalid.blocks = append(invalid.blocks[:len(invalid.blocks):len(invalid.blocks)], newTestBlock(t, &bc, transaction.NewTx_Entry([]byte("intruder")), identitytest.Identity("bar")))
+	var verr *VerifyError
+	if err := invalid.Save(t.TempDir()); !errors.As(err, &verr) || verr.Height != 2 {
+		t.Errorf("invalid chain returned %v", err)
+	}
+}
+
+func TestBlockchainAppendAndSave(t *testing.T) {
+	id := identitytest.Identity("main")
+	dir := t.TempDir()
+	bc := newTestChain(t, "append-save", id)
+	if err := bc.Save(dir); err != nil {
+		t.Fatalf("error saving chain (%s)", err)
+	}
+
+	// a block that can't be written isn't appended
+	blocks_dir := path.Join(dir, BLOCKS_DIR)
+	if err := os.Rename(blocks_dir, blocks_dir+".saved"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(blocks_dir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	blk := newTestBlock(t, &bc, transaction.NewTx_Entry([]byte("unsaved")), id)
+	if _, err := bc.AppendAndSave(blk); !errors.Is(err, ErrNotSaved) {
+		t.Errorf("block that couldn't be saved returned %v", err)
+	}
+	if bc.Height() != 0 {
+		t.Errorf("block that couldn't be saved was appended")
+	}
+
+	// once it can be written, the saved chain loads with it
+	if err := os.Remove(blocks_dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(blocks_dir+".saved", blocks_dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bc.AppendAndSave(blk); err != nil {
+		t.Fatalf("error appending block (%s)", err)
+	}
+	loaded, err := LoadChain(dir, "append-save")
+	if err != nil || !bytes.Equal(loaded.GetTipHash(), blk.GetHash()) {
+		t.Errorf("saved chain doesn't end with the appended block (%v)", err)
+	}
+}
+
+func TestBlockchainStateRoot(t *testing.T) {
+	id_main := identitytest.Identity("main")
+	id_bar := identitytest.Identity("bar")
+
+	bc1 := newTestChain(t, "state", id_main)
+
+	tx1 := transaction.NewTx_Permission(10, id_bar.GetPubBytes())
+	blk1 := newTestBlock(t, &bc1, tx1, id_main)
+	_, err := bc1.AppendBlock(blk1)
+	if err != nil {
+		t.Fatalf("error appending first block (%s)", err)
+	}
+	if !bytes.Equal(bc1.GetStateRoot(), blk1.GetStateRoot()) {
+		t.Errorf("state root of chain doesn't match the state root of its tip")
+	}
+
+	// a block committing to the pre-block state should be rejected
+	tx2 := transaction.NewTx_Entry([]byte("stale state"))
+	blk2, err := block.NewBlock(block.GetCurrentTimestamp(), bc1.GetTipHash(), bc1.GetStateRoot(), tx2, id_bar)
+	if err != nil {
+		t.Fatalf("error creating second block (%s)", err)
+	}
+	_, err = bc1.AppendBlock(blk2)
+	if err == nil {
+		t.Errorf("block with the wrong state root was appended")
+	}
+
+	// two chains that diverge in state should be detected at the diverging block
+	bc2 := newTestChain(t, "state", id_main)
+	tx1b := transaction.NewTx_Permission(11, id_bar.GetPubBytes())
+	state_root, err := bc2.NextStateRoot(id_main.GetPubBytes(), tx1b)
+	if err != nil {
+		t.Fatalf("error computing state root (%s)", err)
+	}
+	forged, err := block.NewBlock(block.GetCurrentTimestamp(), bc2.GetTipHash(), state_root, tx1, id_main)
+	if err != nil {
+		t.Fatalf("error creating forged block (%s)", err)
+	}
+	_, err = bc2.AppendBlock(forged)
+	if err == nil {
+		t.Errorf("block whose state root doesn't match its transaction was appended")
+	}
+}
+
+func TestBlockchainAlgorithms(t *testing.T) {
+	for _, algorithm := range identity.ALGORITHMS {
+		id := identitytest.NewIdentity(t, algorithm)
+		bc := newTestChain(t, "algorithm-"+algorithm, id)
+		blk := newTestBlock(t, &bc, transaction.NewTx_Entry([]byte("signed with "+algorithm)), id)
+		if _, err := bc.AppendBlock(blk); err != nil {
+			t.Errorf("error appending %s block (%s)", algorithm, err)
+		}
+	}
+}
+
+func TestBlockchainMixedAlgorithms(t *testing.T) {
+	id_p384 := identitytest.NewIdentity(t, identity.ALGORITHM_P384)
+	id_ed25519 := identitytest.NewIdentity(t, identity.ALGORITHM_ED25519)
+	bc := newTestChain(t, "algorithm-mixed", id_p384)
+
+	blk := newTestBlock(t, &bc, transaction.NewTx_Permission(2, id_ed25519.GetPubBytes()), id_p384)
+	if _, err := bc.AppendBlock(blk); err != nil {
+		t.Fatalf("error delegating to an ed25519 validator (%s)", err)
+	}
+	blk = newTestBlock(t, &bc, transaction.NewTx_Entry([]byte("from ed25519")), id_ed25519)
+	if _, err := bc.AppendBlock(blk); err != nil {
+		t.Errorf("error appending block from an ed25519 validator (%s)", err)
+	}
+}
+func TestValidChainLabel(t *testing.T) {
+	for _, label := range []string{"main", "acme-ops", "chain_2"} {
+		if !ValidChainLabel(label) {
+			t.Errorf("%q should be a valid label", label)
+		}
+	}
+	for _, label := range []string{"", "../main", "Main", "a/b", strings.Repeat("a", 65)} {
+		if ValidChainLabel(label) {
+			t.Errorf("%q should be an invalid label", label)
+		}
+	}
+}
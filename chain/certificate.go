@@ -0,0 +1,279 @@
+package chain
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"reddchain/block"
+	"reddchain/identity"
+	"reddchain/transaction"
+)
+
+// a chain whose genesis names trusted root CAs is certificate-bound:
+// every block must be signed by keys with certificates that chain to one of the roots,
+// that are valid at the block's timestamp, and that haven't been revoked
+// genesis validators present their certificates in the genesis specification,
+// later validators register theirs with a transaction.Certificate transaction,
+// and a CA revokes the certificates it issued with a transaction.Revocation transaction carrying a CRL it signed
+// the CA is a trusted root, or an intermediate CA of a registered certificate chain that is itself still valid,
+// and revoking an intermediate CA also revokes every certificate issued below it
+// block timestamps can't go backwards in a certificate-bound chain, so an expired certificate can't be used by backdating
+
+// returned when a block's signers don't have valid certificates on a certificate-bound chain
+var (
+	ErrInvalidCertificate = errors.New("certificate isn't valid")
+	ErrRevokedCertificate = errors.New("certificate has been revoked")
+)
+
+// the certificate state of a certificate-bound chain
+type cert_state_t struct {
+	roots   []*x509.Certificate
+	certs   map[string][]*x509.Certificate // validator keys and their certificate chains, leaf first
+	revoked map[string]bool                // revoked certificates, keyed by revocationKey
+}
+
+// identifies a certificate by its issuer and serial number
+func revocationKey(issuer []byte, serial string) string {
+	return hex.EncodeToString(issuer) + ":" + serial
+}
+
+// parses one or more PEM-encoded certificates
+func parseCertificatesPEM(data []byte) (certs []*x509.Certificate, err error) {
+	for {
+		var blk *pem.Block
+		blk, data = pem.Decode(data)
+		if blk == nil {
+			break
+		}
+		if blk.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(blk.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no PEM certificates found")
+	}
+	return certs, nil
+}
+
+// creates the certificate state for a specification
+// returns nil if the specification doesn't name any trusted CAs
+func newCertState(spec *GenesisSpec) (*cert_state_t, error) {
+	if len(spec.TrustedCAs) == 0 {
+		for _, v := range spec.Validators {
+			if v.Certificate != "" {
+				return nil, errors.New("genesis validators have certificates, but no trusted CAs are named")
+			}
+		}
+		return nil, nil
+	}
+
+	cs := &cert_state_t{certs: make(map[string][]*x509.Certificate), revoked: make(map[string]bool)}
+	for i, p := range spec.TrustedCAs {
+		roots, err := parseCertificatesPEM([]byte(p))
+		if err != nil || len(roots) != 1 {
+			return nil, fmt.Errorf("trusted CA %d isn't a single PEM certificate", i)
+		}
+		if !roots[0].IsCA {
+			return nil, fmt.Errorf("trusted CA %d (%s) isn't a CA certificate", i, roots[0].Subject)
+		}
+		cs.roots = append(cs.roots, roots[0])
+	}
+
+	at := time.Unix(spec.Timestamp, 0)
+	for _, v := range spec.Validators {
+		if v.Certificate == "" {
+			return nil, fmt.Errorf("genesis validator %s has no certificate", identity.FingerprintHex(v.PubKey))
+		}
+		chain, err := parseCertificatesPEM([]byte(v.Certificate))
+		if err != nil {
+			return nil, fmt.Errorf("genesis validator %s: %w", identity.FingerprintHex(v.PubKey), err)
+		}
+		pub, _ := hex.DecodeString(v.PubKey)
+		if err := cs.verifyChain(chain, pub, at); err != nil {
+			return nil, fmt.Errorf("genesis validator %s: %w", identity.FingerprintHex(v.PubKey), err)
+		}
+		cs.certs[v.PubKey] = chain
+	}
+	return cs, nil
+}
+
+// returns a copy of the certificate state that can be modified
+func (cs *cert_state_t) copy() *cert_state_t {
+	c := &cert_state_t{roots: cs.roots, certs: make(map[string][]*x509.Certificate), revoked: make(map[string]bool)}
+	for k, v := range cs.certs {
+		c.certs[k] = v
+	}
+	for k, v := range cs.revoked {
+		c.revoked[k] = v
+	}
+	return c
+}
+
+// checks that a certificate chain certifies pub, leads to a trusted root, is valid at the given time and isn't revoked
+func (cs *cert_state_t) verifyChain(chain []*x509.Certificate, pub []byte, at time.Time) error {
+	leaf := chain[0]
+	leaf_pub, err := x509.MarshalPKIXPublicKey(leaf.PublicKey)
+	if err != nil || !bytes.Equal(leaf_pub, pub) {
+		return fmt.Errorf("%w: it's for a different key", ErrInvalidCertificate)
+	}
+	return cs.verifyCertificate(leaf, chain[1:], at)
+}
+
+// checks that cert leads to a trusted root through the given intermediates, is valid at the given time,
+// and that no certificate on any of the paths to a root has been revoked
+func (cs *cert_state_t) verifyCertificate(cert *x509.Certificate, intermediates []*x509.Certificate, at time.Time) error {
+	opts := x509.VerifyOptions{
+		Roots:         x509.NewCertPool(),
+		Intermediates: x509.NewCertPool(),
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	for _, root := range cs.roots {
+		opts.Roots.AddCert(root)
+	}
+	for _, c := range intermediates {
+		opts.Intermediates.AddCert(c)
+	}
+	verified, err := cert.Verify(opts)
+	if err != nil {
+		return fmt.Errorf("%w at %s (%w)", ErrInvalidCertificate, at.UTC().Format(time.RFC3339), err)
+	}
+
+	for _, path := range verified {
+		for _, c := range path {
+			if cs.revoked[revocationKey(c.RawIssuer, c.SerialNumber.String())] {
+				return fmt.Errorf("%w: %s (serial %s)", ErrRevokedCertificate, c.Subject, c.SerialNumber)
+			}
+		}
+	}
+	return nil
+}
+
+// returns the CA that signed a revocation list: a trusted root, or an intermediate CA of a registered
+// certificate chain that is valid at the given time and hasn't been revoked
+func (cs *cert_state_t) revocationIssuer(crl *x509.RevocationList, at time.Time) (*x509.Certificate, error) {
+	for _, root := range cs.roots {
+		if crl.CheckSignatureFrom(root) == nil {
+			return root, nil
+		}
+	}
+	for _, chain := range cs.certs {
+		for i := 1; i < len(chain); i++ {
+			if !chain[i].IsCA || crl.CheckSignatureFrom(chain[i]) != nil {
+				continue
+			}
+			if cs.verifyCertificate(chain[i], chain[i+1:], at) == nil {
+				return chain[i], nil
+			}
+		}
+	}
+	return nil, errors.New("revocation list isn't signed by a trusted CA")
+}
+
+// applies a block to the certificate state of a chain whose tip has the given timestamp
+// returns the resulting state, or an error if the block's signers don't have valid certificates
+// a nil state means the chain isn't certificate-bound
+func (cs *cert_state_t) ApplyBlock(blk *block.Block, prev_timestamp int64) (*cert_state_t, error) {
+	if cs == nil {
+		if blk.GetTxType() == transaction.Certificate || blk.GetTxType() == transaction.Revocation {
+			return nil, errors.New("chain has no trusted CAs")
+		}
+		return nil, nil
+	}
+	if blk.GetTimestamp() < prev_timestamp {
+		return nil, errors.New("block timestamp is before the previous block's")
+	}
+	at := time.Unix(blk.GetTimestamp(), 0)
+	next := cs.copy()
+
+	if blk.GetTxType() == transaction.Certificate {
+		tx := blk.GetTx()
+		chain, err := tx.ParseTx_Certificate()
+		if err != nil {
+			return nil, err
+		}
+		pub, err := x509.MarshalPKIXPublicKey(chain[0].PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		if err := next.verifyChain(chain, pub, at); err != nil {
+			return nil, err
+		}
+		next.certs[hex.EncodeToString(pub)] = chain
+	} else if blk.GetTxType() == transaction.Revocation {
+		tx := blk.GetTx()
+		crl, err := tx.ParseTx_Revocation()
+		if err != nil {
+			return nil, err
+		}
+		issuer, err := cs.revocationIssuer(crl, at)
+		if err != nil {
+			return nil, err
+		}
+		// serial numbers are only unique per issuer, so a CRL revokes the certificates its signer issued
+		for _, entry := range crl.RevokedCertificateEntries {
+			next.revoked[revocationKey(issuer.RawSubject, entry.SerialNumber.String())] = true
+		}
+	}
+
+	keys, err := identity.SigningKeys(blk.GetValidator(), blk.GetSignature())
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		chain, ok := next.certs[hex.EncodeToString(k)]
+		if !ok {
+			return nil, fmt.Errorf("%w: signer %s has no certificate", ErrInvalidCertificate, identity.Fingerprint(k))
+		}
+		if err := next.verifyChain(chain, k, at); err != nil {
+			return nil, fmt.Errorf("signer %s: %w", identity.Fingerprint(k), err)
+		}
+	}
+	return next, nil
+}
+
+// returns the certificate registered for a validator, or nil
+func (bc *Blockchain) GetCertificate(validator string) *x509.Certificate {
+	if bc.certs == nil || len(bc.certs.certs[validator]) == 0 {
+		return nil
+	}
+	return bc.certs.certs[validator][0]
+}
+
+// reads a PEM certificate chain, leaf first, for a transaction.Certificate transaction
+func ReadCertificateFile(fname string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	return parseCertificatesPEM(data)
+}
+
+// reads a PEM or DER certificate revocation list for a transaction.Revocation transaction
+func ReadRevocationListFile(fname string) ([]byte, error) {
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	if blk, _ := pem.Decode(data); blk != nil {
+		if blk.Type != "X509 CRL" {
+			return nil, fmt.Errorf("%s contains a %s, not an X509 CRL", fname, blk.Type)
+		}
+		data = blk.Bytes
+	}
+	if _, err := x509.ParseRevocationList(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,211 @@
+package chain
+
+import (
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+
+	"reddchain/block"
+	"reddchain/identity"
+	"reddchain/identity/identitytest"
+	"reddchain/transaction"
+)
+
+// creates a certificate-bound chain whose only genesis validator is id
+func newTestCertChain(t *testing.T, label string, ca *identitytest.CA, id identity.Identity) Blockchain {
+	spec := NewGenesisSpec(label, id)
+	spec.Timestamp = time.Now().Add(-time.Hour).Unix()
+	spec.TrustedCAs = []string{ca.PEM()}
+	cert := ca.Issue(t, id, time.Now().Add(-24*time.Hour), time.Now().Add(24*time.Hour))
+	spec.Validators[0].Certificate = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+	return newSpecTestChain(t, spec, id)
+}
+
+// creates a block on top of the chain's tip with the given timestamp
+func newTestBlockAt(t *testing.T, bc *Blockchain, timestamp int64, tx transaction.Transaction, id identity.Signer) block.Block {
+	state_root, err := bc.NextStateRoot(id.GetPubBytes(), tx)
+	if err != nil {
+		state_root = bc.GetStateRoot()
+	}
+	blk, err := block.NewBlock(timestamp, bc.GetTipHash(), state_root, tx, id)
+	if err != nil {
+		t.Fatalf("error creating block (%s)", err)
+	}
+	return blk
+}
+
+func TestCertificateGenesis(t *testing.T) {
+	ca := identitytest.NewCA(t, "test root")
+	id := identitytest.NewIdentity(t, identity.ALGORITHM_P256)
+	spec := NewGenesisSpec("cert-genesis", id)
+	spec.TrustedCAs = []string{ca.PEM()}
+	if err := spec.Validate(); err == nil {
+		t.Errorf("genesis validator without a certificate was accepted")
+	}
+
+	other := identitytest.NewIdentity(t, identity.ALGORITHM_P256)
+	cert := ca.Issue(t, other, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	spec.Validators[0].Certificate = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+	if err := spec.Validate(); err == nil {
+		t.Errorf("certificate for a different key was accepted")
+	}
+
+	cert = ca.Issue(t, id, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	spec.Validators[0].Certificate = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+	if err := spec.Validate(); err != nil {
+		t.Errorf("valid certificate was rejected (%s)", err)
+	}
+	spec.TrustedCAs = []string{identitytest.NewCA(t, "other root").PEM()}
+	if err := spec.Validate(); err == nil {
+		t.Errorf("certificate from an untrusted CA was accepted")
+	}
+	spec.TrustedCAs = nil
+	if err := spec.Validate(); err == nil {
+		t.Errorf("certificate without trusted CAs was accepted")
+	}
+}
+
+func TestCertificateValidators(t *testing.T) {
+	ca := identitytest.NewCA(t, "test root")
+	id := identitytest.NewIdentity(t, identity.ALGORITHM_P256)
+	bc := newTestCertChain(t, "cert-validators", ca, id)
+	now := time.Now().Unix()
+
+	if _, err := bc.AppendBlock(newTestBlockAt(t, &bc, now, transaction.NewTx_Entry([]byte("certified")), id)); err != nil {
+		t.Fatalf("error appending block from a certified validator (%s)", err)
+	}
+	if _, err := bc.AppendBlock(newTestBlockAt(t, &bc, now-60, transaction.NewTx_Entry([]byte("backdated")), id)); err == nil {
+		t.Errorf("block with a timestamp before its predecessor was accepted")
+	}
+
+	// a delegate can't mint until its certificate is registered
+	delegate := identitytest.NewIdentity(t, identity.ALGORITHM_ED25519)
+	if _, err := bc.AppendBlock(newTestBlockAt(t, &bc, now, transaction.NewTx_Permission(10, delegate.GetPubBytes()), id)); err != nil {
+		t.Fatalf("error delegating (%s)", err)
+	}
+	if _, err := bc.AppendBlock(newTestBlockAt(t, &bc, now, transaction.NewTx_Entry([]byte("uncertified")), delegate)); err == nil {
+		t.Errorf("block from a validator without a certificate was accepted")
+	}
+
+	// an expired certificate is rejected, whoever submits it
+	expired := ca.Issue(t, delegate, time.Now().Add(-48*time.Hour), time.Now().Add(-24*time.Hour))
+	if _, err := bc.AppendBlock(newTestBlockAt(t, &bc, now, transaction.NewTx_Certificate([]*x509.Certificate{expired}), id)); err == nil {
+		t.Errorf("expired certificate was registered")
+	}
+
+	// a validator can register its own certificate
+	cert := ca.Issue(t, delegate, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	if _, err := bc.AppendBlock(newTestBlockAt(t, &bc, now, transaction.NewTx_Certificate([]*x509.Certificate{cert}), delegate)); err != nil {
+		t.Fatalf("error registering certificate (%s)", err)
+	}
+	if bc.GetCertificate(hex.EncodeToString(delegate.GetPubBytes())) == nil {
+		t.Errorf("registered certificate isn't recorded")
+	}
+	if _, err := bc.AppendBlock(newTestBlockAt(t, &bc, now, transaction.NewTx_Entry([]byte("certified delegate")), delegate)); err != nil {
+		t.Errorf("error appending block from a certified delegate (%s)", err)
+	}
+
+	// certificates are checked against the block's timestamp
+	late := time.Now().Add(2 * time.Hour).Unix()
+	if _, err := bc.AppendBlock(newTestBlockAt(t, &bc, late, transaction.NewTx_Entry([]byte("expired")), delegate)); err == nil {
+		t.Errorf("block from an expired certificate was accepted")
+	}
+
+	// a revocation list from an untrusted CA is rejected
+	other := identitytest.NewCA(t, "other root")
+	if _, err := bc.AppendBlock(newTestBlockAt(t, &bc, now, transaction.NewTx_Revocation(other.Revoke(t, cert)), id)); err == nil {
+		t.Errorf("revocation list from an untrusted CA was accepted")
+	}
+	if _, err := bc.AppendBlock(newTestBlockAt(t, &bc, now, transaction.NewTx_Revocation(ca.Revoke(t, cert)), id)); err != nil {
+		t.Fatalf("error revoking certificate (%s)", err)
+	}
+	if _, err := bc.AppendBlock(newTestBlockAt(t, &bc, now, transaction.NewTx_Entry([]byte("revoked")), delegate)); err == nil {
+		t.Errorf("block from a revoked certificate was accepted")
+	}
+	if _, err := bc.AppendBlock(newTestBlockAt(t, &bc, now, transaction.NewTx_Entry([]byte("still certified")), id)); err != nil {
+		t.Errorf("error appending block after revocation (%s)", err)
+	}
+
+	if _, err := bc.Verify(); err != nil {
+		t.Errorf("error verifying certificate-bound chain (%s)", err)
+	}
+}
+
+func TestCertificateIntermediateRevocation(t *testing.T) {
+	root := identitytest.NewCA(t, "test root")
+	intermediate := root.IssueCA(t, "test intermediate")
+	id := identitytest.NewIdentity(t, identity.ALGORITHM_P256)
+	bc := newTestCertChain(t, "cert-intermediate", root, id)
+	now := time.Now().Unix()
+
+	// two delegates certified by the intermediate
+	var delegates []identity.Identity
+	var certs []*x509.Certificate
+	for i := 0; i < 2; i++ {
+		delegate := identitytest.NewIdentity(t, identity.ALGORITHM_ED25519)
+		cert := intermediate.Issue(t, delegate, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+		txs := []transaction.Transaction{
+			transaction.NewTx_Permission(10, delegate.GetPubBytes()),
+			transaction.NewTx_Certificate([]*x509.Certificate{cert, intermediate.Cert}),
+		}
+		for _, tx := range txs {
+			if _, err := bc.AppendBlock(newTestBlockAt(t, &bc, now, tx, id)); err != nil {
+				t.Fatalf("error certifying delegate (%s)", err)
+			}
+		}
+		delegates, certs = append(delegates, delegate), append(certs, cert)
+	}
+	for _, delegate := range delegates {
+		if _, err := bc.AppendBlock(newTestBlockAt(t, &bc, now, transaction.NewTx_Entry([]byte("certified")), delegate)); err != nil {
+			t.Fatalf("error appending block from a delegate certified by the intermediate (%s)", err)
+		}
+	}
+
+	// the root can't revoke a certificate it didn't issue, but the intermediate can
+	if _, err := bc.AppendBlock(newTestBlockAt(t, &bc, now, transaction.NewTx_Revocation(root.Revoke(t, certs[0])), id)); err != nil {
+		t.Fatalf("error appending root revocation list (%s)", err)
+	}
+	if _, err := bc.AppendBlock(newTestBlockAt(t, &bc, now, transaction.NewTx_Entry([]byte("issued by the intermediate")), delegates[0])); err != nil {
+		t.Errorf("root revocation list revoked a certificate issued by the intermediate (%s)", err)
+	}
+	if _, err := bc.AppendBlock(newTestBlockAt(t, &bc, now, transaction.NewTx_Revocation(intermediate.Revoke(t, certs[0])), id)); err != nil {
+		t.Fatalf("error appending intermediate revocation list (%s)", err)
+	}
+	if _, err := bc.AppendBlock(newTestBlockAt(t, &bc, now, transaction.NewTx_Entry([]byte("revoked")), delegates[0])); !errors.Is(err, ErrRevokedCertificate) {
+		t.Errorf("block from a certificate revoked by the intermediate returned %v", err)
+	}
+	if _, err := bc.AppendBlock(newTestBlockAt(t, &bc, now, transaction.NewTx_Entry([]byte("not revoked")), delegates[1])); err != nil {
+		t.Errorf("error appending block from the other delegate (%s)", err)
+	}
+
+	// revoking the intermediate revokes everything it issued, and it can't sign revocation lists anymore
+	if _, err := bc.AppendBlock(newTestBlockAt(t, &bc, now, transaction.NewTx_Revocation(root.Revoke(t, intermediate.Cert)), id)); err != nil {
+		t.Fatalf("error revoking the intermediate (%s)", err)
+	}
+	if _, err := bc.AppendBlock(newTestBlockAt(t, &bc, now, transaction.NewTx_Entry([]byte("revoked intermediate")), delegates[1])); !errors.Is(err, ErrRevokedCertificate) {
+		t.Errorf("block from a certificate below a revoked intermediate returned %v", err)
+	}
+	if _, err := bc.AppendBlock(newTestBlockAt(t, &bc, now, transaction.NewTx_Revocation(intermediate.Revoke(t, certs[1])), id)); err == nil {
+		t.Errorf("revocation list from a revoked intermediate was accepted")
+	}
+
+	if _, err := bc.Verify(); err != nil {
+		t.Errorf("error verifying certificate-bound chain (%s)", err)
+	}
+}
+
+func TestCertificateUnboundChain(t *testing.T) {
+	ca := identitytest.NewCA(t, "test root")
+	id := identitytest.NewIdentity(t, identity.ALGORITHM_P256)
+	bc := newTestChain(t, "cert-unbound", id)
+	cert := ca.Issue(t, id, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	if _, err := bc.AppendBlock(newTestBlock(t, &bc, transaction.NewTx_Certificate([]*x509.Certificate{cert}), id)); err == nil {
+		t.Errorf("certificate was registered in a chain without trusted CAs")
+	}
+	if _, err := bc.AppendBlock(newTestBlock(t, &bc, transaction.NewTx_Revocation(ca.Revoke(t, cert)), id)); err == nil {
+		t.Errorf("revocation list was accepted in a chain without trusted CAs")
+	}
+}
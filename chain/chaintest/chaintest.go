@@ -0,0 +1,53 @@
+// Package chaintest builds chains and blocks for the tests of the packages that use chains.
+// The chain package's own tests can't import it, since it imports chain.
+package chaintest
+
+import (
+	"testing"
+
+	"reddchain/block"
+	"reddchain/chain"
+	"reddchain/identity"
+	"reddchain/transaction"
+)
+
+// returns the signed genesis file of a chain whose only genesis validator is id
+func Genesis(t *testing.T, label string, id identity.Signer) chain.GenesisFile {
+	gf, err := chain.SignGenesis(chain.GenesisFile{Spec: chain.NewGenesisSpec(label, id)}, id)
+	if err != nil {
+		t.Fatalf("error signing genesis (%s)", err)
+	}
+	return gf
+}
+
+// creates a chain whose only genesis validator is id, then appends a block minted by id for each of txs
+func NewChain(t *testing.T, label string, id identity.Signer, txs ...transaction.Transaction) (bc chain.Blockchain) {
+	gf := Genesis(t, label, id)
+	genesis, err := gf.Block()
+	if err != nil {
+		t.Fatalf("error creating genesis block (%s)", err)
+	}
+	if err := bc.Init(genesis); err != nil {
+		t.Fatalf("error initializing chain (%s)", err)
+	}
+	for _, tx := range txs {
+		if _, err := bc.AppendBlock(NewBlock(t, &bc, tx, id)); err != nil {
+			t.Fatalf("error appending block (%s)", err)
+		}
+	}
+	return bc
+}
+
+// creates a block on top of the chain's tip, committing to the resulting state
+// if id can't mint the block, it commits to the current state so appending it fails
+func NewBlock(t *testing.T, bc *chain.Blockchain, tx transaction.Transaction, id identity.Signer) block.Block {
+	state_root, err := bc.NextStateRoot(id.GetPubBytes(), tx)
+	if err != nil {
+		state_root = bc.GetStateRoot()
+	}
+	blk, err := block.NewBlock(block.GetCurrentTimestamp(), bc.GetTipHash(), state_root, tx, id)
+	if err != nil {
+		t.Fatalf("error creating block (%s)", err)
+	}
+	return blk
+}
@@ -0,0 +1,486 @@
+package chain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+
+	"reddchain/block"
+	"reddchain/identity"
+	"reddchain/transaction"
+)
+
+// a genesis specification describes a new chain
+// every genesis validator co-signs the hash of the specification's canonical encoding
+// the genesis block carries the specification and the co-signatures as its entry,
+// so the genesis hash, and therefore every block after it, depends on the whole file
+type GenesisSpec struct {
+	ChainID    string             `json:"chain_id"`
+	Timestamp  int64              `json:"timestamp"`
+	Validators []GenesisValidator `json:"validators"`
+	Consensus  ConsensusParams    `json:"consensus"`
+	Metadata   map[string]string  `json:"metadata,omitempty"`
+	TrustedCAs []string           `json:"trusted_cas,omitempty"` // PEM root certificates, if set the chain is certificate-bound
+}
+
+// a validator that is authorized from the start of the chain
+type GenesisValidator struct {
+	PubKey    string `json:"pubkey"`              // hex-encoded PKIX public key
+	Allowance uint32 `json:"allowance,omitempty"` // number of blocks the validator may mint
+	Unlimited bool   `json:"unlimited,omitempty"` // if true, the validator's allowance is never used up
+
+	// PEM certificate chain for the key, leaf first, required if the chain is certificate-bound
+	Certificate string `json:"certificate,omitempty"`
+}
+
+// a genesis validator's approval of the specification
+type GenesisCosignature struct {
+	PubKey    string `json:"pubkey"`    // hex-encoded PKIX public key of the validator
+	Signature string `json:"signature"` // hex-encoded signature of the specification's hash
+}
+
+// parameters every node on the chain must agree on
+type ConsensusParams struct {
+	MaxTxSize uint32 `json:"max_tx_size"` // largest transaction accepted, at most transaction.TX_MAX_SIZE
+}
+
+// the entry in the genesis block
+type genesis_payload_t struct {
+	Spec         GenesisSpec          `json:"spec"`
+	Cosignatures []GenesisCosignature `json:"cosignatures"` // sorted by public key
+}
+
+// a genesis file is a specification, its co-signatures and the signature of the genesis block built from them
+// until every validator has co-signed, the file is a draft with no signer or signature
+type GenesisFile struct {
+	Spec         GenesisSpec          `json:"spec"`
+	Cosignatures []GenesisCosignature `json:"cosignatures"`
+	Signer       string               `json:"signer,omitempty"`    // hex-encoded public key of the validator that signed the genesis block
+	Signature    string               `json:"signature,omitempty"` // hex-encoded signature of the genesis block
+}
+
+// the default consensus parameters for new chains
+func DefaultConsensusParams() ConsensusParams {
+	return ConsensusParams{
+		MaxTxSize: transaction.TX_MAX_SIZE,
+	}
+}
+
+// create a specification for a chain with a single validator
+// the signer is given an unlimited allowance on the new chain
+func NewGenesisSpec(chain_id string, signer identity.Signer) GenesisSpec {
+	return GenesisSpec{
+		ChainID:   chain_id,
+		Timestamp: block.GetCurrentTimestamp(),
+		Validators: []GenesisValidator{
+			{PubKey: hex.EncodeToString(signer.GetPubBytes()), Unlimited: true},
+		},
+		Consensus: DefaultConsensusParams(),
+	}
+}
+
+// checks that the specification describes a usable chain
+func (spec *GenesisSpec) Validate() error {
+	if !ValidChainLabel(spec.ChainID) {
+		return fmt.Errorf("invalid chain id %q", spec.ChainID)
+	}
+	if len(spec.Validators) == 0 {
+		return errors.New("genesis has no validators")
+	}
+	seen := make(map[string]bool)
+	for _, v := range spec.Validators {
+		pub, err := hex.DecodeString(v.PubKey)
+		if err != nil {
+			return fmt.Errorf("invalid validator public key %s", v.PubKey)
+		}
+		if _, err := identity.ParsePublicKey(pub); err != nil {
+			return fmt.Errorf("invalid validator public key %s (%w)", identity.FingerprintHex(v.PubKey), err)
+		}
+		if seen[v.PubKey] {
+			return fmt.Errorf("validator %s is listed twice", identity.FingerprintHex(v.PubKey))
+		}
+		seen[v.PubKey] = true
+		if v.Unlimited && v.Allowance != 0 {
+			return fmt.Errorf("validator %s has both an unlimited and a fixed allowance", identity.FingerprintHex(v.PubKey))
+		}
+		if !v.Unlimited && (v.Allowance == 0 || v.Allowance == UNLIMITED_ALLOWANCE) {
+			return fmt.Errorf("validator %s must have an allowance between 1 and %d, or be unlimited", identity.FingerprintHex(v.PubKey), UNLIMITED_ALLOWANCE-1)
+		}
+	}
+	if spec.Consensus.MaxTxSize == 0 || spec.Consensus.MaxTxSize > transaction.TX_MAX_SIZE {
+		return fmt.Errorf("max_tx_size must be between 1 and %d", transaction.TX_MAX_SIZE)
+	}
+	if _, err := newCertState(spec); err != nil {
+		return err
+	}
+	return nil
+}
+
+// creates the canonical encoding of the specification that is stored in the genesis block
+func (spec *GenesisSpec) Marshal() []byte {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// returns the hash that each genesis validator co-signs
+func (spec *GenesisSpec) Hash() []byte {
+	hash := sha256.Sum256(spec.Marshal())
+	return hash[:]
+}
+
+// the validator state before any block after the genesis block is applied
+func (spec *GenesisSpec) State() map[string]uint32 {
+	validators := make(map[string]uint32)
+	for _, v := range spec.Validators {
+		if v.Unlimited {
+			validators[v.PubKey] = UNLIMITED_ALLOWANCE
+		} else {
+			validators[v.PubKey] = v.Allowance
+		}
+	}
+	return validators
+}
+
+// checks that every genesis validator, and nobody else, has co-signed the specification
+func (spec *GenesisSpec) VerifyCosignatures(cosignatures []GenesisCosignature) error {
+	validators := spec.State()
+	hash := spec.Hash()
+	signed := make(map[string]bool)
+	for _, c := range cosignatures {
+		if _, ok := validators[c.PubKey]; !ok {
+			return fmt.Errorf("%s co-signed the genesis but isn't a genesis validator", identity.FingerprintHex(c.PubKey))
+		}
+		if signed[c.PubKey] {
+			return fmt.Errorf("%s co-signed the genesis twice", identity.FingerprintHex(c.PubKey))
+		}
+		pub, _ := hex.DecodeString(c.PubKey)
+		sig, err := hex.DecodeString(c.Signature)
+		if err != nil {
+			return fmt.Errorf("invalid co-signature from %s", identity.FingerprintHex(c.PubKey))
+		}
+		if err := identity.VerifySignature(pub, hash, sig); err != nil {
+			return fmt.Errorf("invalid co-signature from %s (%w)", identity.FingerprintHex(c.PubKey), err)
+		}
+		signed[c.PubKey] = true
+	}
+	for _, v := range spec.Validators {
+		if !signed[v.PubKey] {
+			return fmt.Errorf("genesis validator %s hasn't co-signed the genesis", identity.FingerprintHex(v.PubKey))
+		}
+	}
+	return nil
+}
+
+// returns the validators that have yet to co-sign the genesis
+func (gf *GenesisFile) MissingCosignatures() []string {
+	signed := make(map[string]bool)
+	for _, c := range gf.Cosignatures {
+		signed[c.PubKey] = true
+	}
+	var missing []string
+	for _, v := range gf.Spec.Validators {
+		if !signed[v.PubKey] {
+			missing = append(missing, v.PubKey)
+		}
+	}
+	return missing
+}
+
+// creates the canonical encoding of the genesis block's entry
+func (gf *GenesisFile) payload() []byte {
+	payload := genesis_payload_t{Spec: gf.Spec}
+	payload.Cosignatures = append(payload.Cosignatures, gf.Cosignatures...)
+	sort.Slice(payload.Cosignatures, func(i, j int) bool {
+		return payload.Cosignatures[i].PubKey < payload.Cosignatures[j].PubKey
+	})
+	data, err := json.Marshal(payload)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// adds the specified signer's co-signature to a draft genesis file
+// the signer must be one of the genesis validators
+func CosignGenesis(gf GenesisFile, signer identity.Signer) (GenesisFile, error) {
+	err := gf.Spec.Validate()
+	if err != nil {
+		return gf, err
+	}
+	if gf.Signature != "" {
+		return gf, errors.New("genesis block has already been signed")
+	}
+	pubkey := hex.EncodeToString(signer.GetPubBytes())
+	if _, ok := gf.Spec.State()[pubkey]; !ok {
+		return gf, errors.New("only genesis validators can co-sign the genesis")
+	}
+	for _, c := range gf.Cosignatures {
+		if c.PubKey == pubkey {
+			return gf, nil
+		}
+	}
+
+	sig, err := signer.Sign(gf.Spec.Hash())
+	if err != nil {
+		return gf, err
+	}
+	gf.Cosignatures = append(gf.Cosignatures, GenesisCosignature{PubKey: pubkey, Signature: hex.EncodeToString(sig)})
+	return gf, nil
+}
+
+// signs the genesis block for a genesis file with the specified signer
+// the signer co-signs the genesis if it hasn't already, and every other genesis validator must have co-signed
+func SignGenesis(gf GenesisFile, signer identity.Signer) (GenesisFile, error) {
+	gf, err := CosignGenesis(gf, signer)
+	if err != nil {
+		return gf, err
+	}
+	err = gf.Spec.VerifyCosignatures(gf.Cosignatures)
+	if err != nil {
+		return gf, err
+	}
+
+	tx := transaction.NewTx_Entry(gf.payload())
+	blk, err := block.NewBlock(gf.Spec.Timestamp, make([]byte, block.HASH_SIZE), StateRoot(gf.Spec.State()), tx, signer)
+	if err != nil {
+		return gf, err
+	}
+
+	gf.Signer = hex.EncodeToString(signer.GetPubBytes())
+	gf.Signature = hex.EncodeToString(blk.GetSignature())
+	return gf, nil
+}
+
+// rebuilds the genesis block described by the file
+func (gf *GenesisFile) Block() (blk block.Block, err error) {
+	err = gf.Spec.Validate()
+	if err != nil {
+		return blk, err
+	}
+	if gf.Signature == "" {
+		return blk, errors.New("genesis file is a draft that hasn't been signed")
+	}
+
+	validator, err := hex.DecodeString(gf.Signer)
+	if err != nil {
+		return blk, errors.New("invalid genesis signer")
+	}
+	signature, err := hex.DecodeString(gf.Signature)
+	if err != nil {
+		return blk, errors.New("invalid genesis signature")
+	}
+
+	blk, err = block.Assemble(gf.Spec.Timestamp, make([]byte, block.HASH_SIZE), StateRoot(gf.Spec.State()), transaction.NewTx_Entry(gf.payload()), validator, signature)
+	if err != nil {
+		return blk, fmt.Errorf("invalid genesis block (%w)", err)
+	}
+
+	_, err = ParseGenesisBlock(blk)
+	return blk, err
+}
+
+// recreates the genesis file that a genesis block was built from
+func GenesisFileFromBlock(blk block.Block) (gf GenesisFile, err error) {
+	payload, err := parseGenesisPayload(blk)
+	if err != nil {
+		return gf, err
+	}
+	gf.Spec = payload.Spec
+	gf.Cosignatures = payload.Cosignatures
+	gf.Signer = blk.GetValidatorString()
+	gf.Signature = hex.EncodeToString(blk.GetSignature())
+	return gf, nil
+}
+
+// checks a genesis block and returns the specification it carries
+func ParseGenesisBlock(blk block.Block) (spec GenesisSpec, err error) {
+	payload, err := parseGenesisPayload(blk)
+	return payload.Spec, err
+}
+
+// checks a genesis block and returns its entry
+func parseGenesisPayload(blk block.Block) (payload genesis_payload_t, err error) {
+	if !blk.IsGenesis() {
+		return payload, errors.New("block is not a genesis block")
+	}
+	_, err = blk.Verify()
+	if err != nil {
+		return payload, err
+	}
+	if blk.GetTxType() != transaction.Entry {
+		return payload, errors.New("genesis block must contain an entry")
+	}
+
+	tx := blk.GetTx()
+	err = json.Unmarshal(tx.Data(), &payload)
+	if err != nil {
+		return payload, fmt.Errorf("genesis block doesn't contain a specification (%w)", err)
+	}
+	gf := GenesisFile{Spec: payload.Spec, Cosignatures: payload.Cosignatures}
+	if !bytes.Equal(gf.payload(), tx.Data()) {
+		return payload, errors.New("genesis specification isn't canonically encoded")
+	}
+	spec := payload.Spec
+	err = spec.Validate()
+	if err != nil {
+		return payload, err
+	}
+	err = spec.VerifyCosignatures(payload.Cosignatures)
+	if err != nil {
+		return payload, err
+	}
+
+	if blk.GetTimestamp() != spec.Timestamp {
+		return payload, errors.New("genesis block timestamp doesn't match its specification")
+	}
+	if _, ok := spec.State()[blk.GetValidatorString()]; !ok {
+		return payload, errors.New("genesis block isn't signed by a genesis validator")
+	}
+	if !bytes.Equal(blk.GetStateRoot(), StateRoot(spec.State())) {
+		return payload, errors.New("genesis block has the wrong state root")
+	}
+	return payload, nil
+}
+
+// returns the path of the genesis file for a chain in the data directory dir
+func genesisPath(dir string, chain_id string) string {
+	return path.Join(dir, GENESIS_DIR, chain_id+".json")
+}
+
+// saves the genesis file to the genesis directory of the data directory dir, named by its chain id
+func (gf *GenesisFile) Save(dir string) error {
+	genesis_dir := path.Join(dir, GENESIS_DIR)
+	if _, err := os.Stat(genesis_dir); os.IsNotExist(err) {
+		err := os.MkdirAll(genesis_dir, 0755)
+		if err != nil {
+			return err
+		}
+	}
+
+	data, err := json.MarshalIndent(gf, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(genesisPath(dir, gf.Spec.ChainID), data, 0644)
+}
+
+// loads a genesis file from a path
+func ReadGenesisFile(fname string) (gf GenesisFile, err error) {
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return gf, err
+	}
+	err = json.Unmarshal(data, &gf)
+	if err != nil {
+		return gf, err
+	}
+	_, err = gf.Block()
+	return gf, err
+}
+
+// loads the genesis file for a chain from the data directory dir
+func LoadGenesisFile(dir string, chain_id string) (gf GenesisFile, err error) {
+	gf, err = ReadGenesisFile(genesisPath(dir, chain_id))
+	if err != nil {
+		return gf, err
+	}
+	if gf.Spec.ChainID != chain_id {
+		return gf, fmt.Errorf("genesis file for %s has chain id %s", chain_id, gf.Spec.ChainID)
+	}
+	return gf, nil
+}
+
+// reads a draft genesis file to sign
+// the file may also be a bare specification, which is treated as a draft with no co-signatures
+// a specification may leave out fields that have defaults: the timestamp, the consensus parameters,
+// and the validators, in which case signer is the only validator
+// if chain_id is empty, the chain is the one named in the file
+func ReadGenesisDraft(fname string, chain_id string, signer identity.Signer) (gf GenesisFile, err error) {
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return gf, err
+	}
+
+	var draft struct {
+		Spec *json.RawMessage `json:"spec"`
+	}
+	err = json.Unmarshal(data, &draft)
+	if err != nil {
+		return gf, err
+	}
+	spec_data := data
+	if draft.Spec != nil {
+		err = json.Unmarshal(data, &gf)
+		if err != nil {
+			return gf, err
+		}
+		spec_data = *draft.Spec
+	}
+
+	gf.Spec = NewGenesisSpec(chain_id, signer)
+	gf.Spec.Validators = nil
+	err = json.Unmarshal(spec_data, &gf.Spec)
+	if err != nil {
+		return gf, err
+	}
+	if chain_id != "" && gf.Spec.ChainID != chain_id {
+		return gf, fmt.Errorf("specification is for chain %s, not %s", gf.Spec.ChainID, chain_id)
+	}
+	if len(gf.Spec.Validators) == 0 {
+		gf.Spec.Validators = NewGenesisSpec(gf.Spec.ChainID, signer).Validators
+	}
+	return gf, nil
+}
+
+// writes a draft genesis file to fname
+func (gf *GenesisFile) SaveDraft(fname string) error {
+	data, err := json.MarshalIndent(gf, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fname, data, 0644)
+}
+
+// creates a new chain from a genesis file and saves it to the data directory dir
+func NewChainFromGenesis(dir string, gf GenesisFile) (bc Blockchain, err error) {
+	fname := path.Join(dir, BLOCKCHAIN_DIR, gf.Spec.ChainID+".json")
+	if _, err := os.Stat(fname); err == nil {
+		return bc, fmt.Errorf("chain %s already exists", gf.Spec.ChainID)
+	}
+
+	genesis, err := gf.Block()
+	if err != nil {
+		return bc, err
+	}
+	err = bc.Init(genesis)
+	if err != nil {
+		return bc, err
+	}
+	return bc, bc.Save(dir)
+}
+
+// signs a genesis file with the specified signer, saves it to the data directory dir, and creates the chain it describes
+func GenesisBootstrap(dir string, draft GenesisFile, signer identity.Signer) (gf GenesisFile, err error) {
+	gf, err = SignGenesis(draft, signer)
+	if err != nil {
+		return gf, err
+	}
+	if _, err := os.Stat(genesisPath(dir, gf.Spec.ChainID)); err == nil {
+		return gf, fmt.Errorf("a genesis file for %s already exists", gf.Spec.ChainID)
+	}
+
+	_, err = NewChainFromGenesis(dir, gf)
+	if err != nil {
+		return gf, err
+	}
+	return gf, gf.Save(dir)
+}
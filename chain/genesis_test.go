@@ -0,0 +1,199 @@
+package chain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"reddchain/identity/identitytest"
+	"reddchain/transaction"
+)
+
+func TestGenesisFile(t *testing.T) {
+	id := identitytest.Identity("main")
+
+	spec := NewGenesisSpec("genesis", id)
+	spec.Metadata = map[string]string{"network": "test"}
+	gf, err := SignGenesis(GenesisFile{Spec: spec}, id)
+	if err != nil {
+		t.Fatalf("error signing genesis (%s)", err)
+	}
+	dir := t.TempDir()
+	if err := gf.Save(dir); err != nil {
+		t.Fatalf("error saving genesis file (%s)", err)
+	}
+
+	loaded, err := LoadGenesisFile(dir, "genesis")
+	if err != nil {
+		t.Fatalf("error loading genesis file (%s)", err)
+	}
+	blk, err := gf.Block()
+	if err != nil {
+		t.Fatalf("error building genesis block (%s)", err)
+	}
+	loaded_block, err := loaded.Block()
+	if err != nil {
+		t.Fatalf("error building loaded genesis block (%s)", err)
+	}
+	if !bytes.Equal(blk.GetHash(), loaded_block.GetHash()) {
+		t.Errorf("genesis hash changed after saving and loading")
+	}
+
+	recreated, err := GenesisFileFromBlock(blk)
+	if err != nil || recreated.Signature != gf.Signature || recreated.Spec.Metadata["network"] != "test" {
+		t.Errorf("genesis file wasn't recreated from its block (%v)", err)
+	}
+
+	// changing any part of the specification invalidates the signature
+	tampered := gf
+	tampered.Spec.Metadata = map[string]string{"network": "prod"}
+	if _, err := tampered.Block(); err == nil {
+		t.Errorf("genesis file with a modified specification was accepted")
+	}
+	tampered = gf
+	tampered.Spec.Timestamp += 1
+	if _, err := tampered.Block(); err == nil {
+		t.Errorf("genesis file with a modified timestamp was accepted")
+	}
+
+	// a differently configured network has a different genesis
+	spec.Metadata = map[string]string{"network": "prod"}
+	other, err := SignGenesis(GenesisFile{Spec: spec}, id)
+	if err != nil {
+		t.Fatalf("error signing genesis (%s)", err)
+	}
+	other_block, err := other.Block()
+	if err != nil {
+		t.Fatalf("error building genesis block (%s)", err)
+	}
+	if bytes.Equal(blk.GetHash(), other_block.GetHash()) {
+		t.Errorf("different specifications have the same genesis hash")
+	}
+}
+
+func TestGenesisValidators(t *testing.T) {
+	id_main := identitytest.Identity("main")
+	id_bar := identitytest.Identity("bar")
+	id_foo := identitytest.Identity("foo")
+
+	spec := NewGenesisSpec("validators", id_main)
+	spec.Validators = append(spec.Validators, GenesisValidator{PubKey: hex.EncodeToString(id_bar.GetPubBytes()), Allowance: 1})
+
+	draft := GenesisFile{Spec: spec}
+	if _, err := SignGenesis(draft, id_foo); err == nil {
+		t.Errorf("genesis was signed by someone who isn't a genesis validator")
+	}
+	if _, err := CosignGenesis(draft, id_foo); err == nil {
+		t.Errorf("genesis was co-signed by someone who isn't a genesis validator")
+	}
+	if _, err := SignGenesis(draft, id_main); err == nil {
+		t.Errorf("genesis was signed before every validator co-signed it")
+	}
+
+	draft, err := CosignGenesis(draft, id_bar)
+	if err != nil {
+		t.Fatalf("error co-signing genesis (%s)", err)
+	}
+	if missing := draft.MissingCosignatures(); len(missing) != 1 || missing[0] != spec.Validators[0].PubKey {
+		t.Errorf("wrong validators still to co-sign (%v)", missing)
+	}
+	gf, err := SignGenesis(draft, id_main)
+	if err != nil {
+		t.Fatalf("error signing genesis (%s)", err)
+	}
+	if len(gf.Cosignatures) != 2 {
+		t.Errorf("signed genesis has %d co-signatures", len(gf.Cosignatures))
+	}
+
+	// a genesis block without a validator's co-signature is rejected
+	tampered := gf
+	tampered.Cosignatures = gf.Cosignatures[:1]
+	if _, err := tampered.Block(); err == nil {
+		t.Errorf("genesis missing a co-signature was accepted")
+	}
+	tampered.Cosignatures = []GenesisCosignature{gf.Cosignatures[0], gf.Cosignatures[0]}
+	if _, err := tampered.Block(); err == nil {
+		t.Errorf("genesis with a duplicate co-signature was accepted")
+	}
+	genesis, err := gf.Block()
+	if err != nil {
+		t.Fatalf("error building genesis block (%s)", err)
+	}
+	var bc Blockchain
+	if err := bc.Init(genesis); err != nil {
+		t.Fatalf("error initializing chain (%s)", err)
+	}
+	if bc.GetValidators()[spec.Validators[0].PubKey] != UNLIMITED_ALLOWANCE {
+		t.Errorf("unlimited genesis validator wasn't given an unlimited allowance")
+	}
+	if bc.label != "validators" {
+		t.Errorf("chain label %s doesn't match the chain id", bc.label)
+	}
+
+	// bar can mint exactly one block
+	blk := newTestBlock(t, &bc, transaction.NewTx_Entry([]byte("from bar")), id_bar)
+	if _, err := bc.AppendBlock(blk); err != nil {
+		t.Errorf("error appending block from genesis validator (%s)", err)
+	}
+	blk = newTestBlock(t, &bc, transaction.NewTx_Entry([]byte("from bar again")), id_bar)
+	if _, err := bc.AppendBlock(blk); err == nil {
+		t.Errorf("genesis validator minted more than its allowance")
+	}
+
+	// main is unlimited, so minting doesn't use up its allowance
+	blk = newTestBlock(t, &bc, transaction.NewTx_Entry([]byte("from main")), id_main)
+	if _, err := bc.AppendBlock(blk); err != nil {
+		t.Fatalf("error appending block from unlimited validator (%s)", err)
+	}
+	if bc.GetValidators()[spec.Validators[0].PubKey] != UNLIMITED_ALLOWANCE {
+		t.Errorf("unlimited validator's allowance was used up")
+	}
+
+	spec.Validators = append(spec.Validators, spec.Validators[0])
+	if err := spec.Validate(); err == nil {
+		t.Errorf("specification with a duplicate validator was accepted")
+	}
+	spec.Validators = []GenesisValidator{{PubKey: spec.Validators[0].PubKey, Allowance: 5, Unlimited: true}}
+	if err := spec.Validate(); err == nil {
+		t.Errorf("specification with an unlimited and fixed allowance was accepted")
+	}
+}
+
+func TestGenesisUnlimitedDelegation(t *testing.T) {
+	id_main := identitytest.Identity("main")
+	id_bar := identitytest.Identity("bar")
+	validator := hex.EncodeToString(id_main.GetPubBytes())
+	grantee := hex.EncodeToString(id_bar.GetPubBytes())
+	validators := map[string]uint32{validator: UNLIMITED_ALLOWANCE}
+
+	next, err := ApplyTx(validators, validator, transaction.NewTx_Permission(1000, id_bar.GetPubBytes()))
+	if err != nil {
+		t.Fatalf("error delegating from unlimited validator (%s)", err)
+	}
+	if next[validator] != UNLIMITED_ALLOWANCE || next[grantee] != 1000 {
+		t.Errorf("wrong allowances after delegation (%d, %d)", next[validator], next[grantee])
+	}
+
+	// a delegation can't turn a fixed allowance into an unlimited one
+	_, err = ApplyTx(next, validator, transaction.NewTx_Permission(UNLIMITED_ALLOWANCE-1000, id_bar.GetPubBytes()))
+	if err == nil {
+		t.Errorf("delegation overflowed the grantee's allowance")
+	}
+}
+
+func TestGenesisMaxTxSize(t *testing.T) {
+	id := identitytest.Identity("main")
+
+	spec := NewGenesisSpec("small", id)
+	spec.Consensus.MaxTxSize = 8
+	bc := newSpecTestChain(t, spec, id)
+
+	blk := newTestBlock(t, &bc, transaction.NewTx_Entry([]byte("12345678")), id)
+	if _, err := bc.AppendBlock(blk); err != nil {
+		t.Errorf("error appending block at the size limit (%s)", err)
+	}
+	blk = newTestBlock(t, &bc, transaction.NewTx_Entry([]byte("123456789")), id)
+	if _, err := bc.AppendBlock(blk); err == nil {
+		t.Errorf("block over the chain's size limit was appended")
+	}
+}
@@ -0,0 +1,67 @@
+package chain
+
+import (
+	"bytes"
+	"testing"
+
+	"reddchain/block"
+	"reddchain/identity"
+	"reddchain/identity/identitytest"
+	"reddchain/transaction"
+)
+
+func TestMultisigValidator(t *testing.T) {
+	id := identitytest.Identity("main")
+	officers := []identity.Identity{
+		identitytest.NewIdentity(t, identity.ALGORITHM_ED25519),
+		identitytest.NewIdentity(t, identity.ALGORITHM_P256),
+		identitytest.NewIdentity(t, identity.ALGORITHM_P384),
+	}
+	var keys [][]byte
+	for _, o := range officers {
+		keys = append(keys, o.GetPubBytes())
+	}
+	policy, err := identity.NewMultisigPolicy(2, keys)
+	if err != nil {
+		t.Fatalf("error creating policy (%s)", err)
+	}
+	bc := newTestChain(t, "multisig", id)
+
+	// blocks can't be delegated to a multisig validator before it is registered
+	blk := newTestBlock(t, &bc, transaction.NewTx_Permission(5, policy.ID()), id)
+	if _, err := bc.AppendBlock(blk); err == nil {
+		t.Errorf("blocks were delegated to an unregistered multisig validator")
+	}
+	blk = newTestBlock(t, &bc, transaction.NewTx_Multisig(policy), id)
+	if _, err := bc.AppendBlock(blk); err != nil {
+		t.Fatalf("error registering multisig validator (%s)", err)
+	}
+	blk = newTestBlock(t, &bc, transaction.NewTx_Multisig(policy), id)
+	if _, err := bc.AppendBlock(blk); err == nil {
+		t.Errorf("multisig validator was registered twice")
+	}
+	blk = newTestBlock(t, &bc, transaction.NewTx_Permission(5, policy.ID()), id)
+	if _, err := bc.AppendBlock(blk); err != nil {
+		t.Fatalf("error delegating to multisig validator (%s)", err)
+	}
+
+	// two of the three officers sign
+	signer, err := identity.NewMultisigSigner(policy, []identity.Signer{officers[0], officers[2]})
+	if err != nil {
+		t.Fatalf("error creating multisig signer (%s)", err)
+	}
+	blk = newTestBlock(t, &bc, transaction.NewTx_Entry([]byte("approved by two officers")), signer)
+	if _, err := bc.AppendBlock(blk); err != nil {
+		t.Fatalf("error appending multisig block (%s)", err)
+	}
+	parsed, err := block.Unmarshal(blk.Marshal())
+	if err != nil || !bytes.Equal(parsed.GetHash(), blk.GetHash()) {
+		t.Errorf("multisig block changed after parsing (%v)", err)
+	}
+
+	// an officer can't mint blocks with the multisig validator's allowance alone
+	blk = newTestBlock(t, &bc, transaction.NewTx_Entry([]byte("approved by one officer")), officers[0])
+	if _, err := bc.AppendBlock(blk); err == nil {
+		t.Errorf("block from a single officer was appended")
+	}
+}
@@ -0,0 +1,87 @@
+package chain
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"reddchain/block"
+	"reddchain/transaction"
+)
+
+// prunes the transaction data of every block below height
+// headers and signatures are kept, so the chain can still be verified
+// only entries are pruned, since the other transaction types are needed to rebuild the validator state
+// if cold is true, the full blocks are moved to the cold directory instead of being discarded
+// returns the number of blocks that were pruned
+func (bc *Blockchain) Prune(height int, cold bool) (int, error) {
+	if bc.dir == "" {
+		return 0, errors.New("chain " + bc.label + " hasn't been saved")
+	}
+	if height > len(bc.blocks) {
+		height = len(bc.blocks)
+	}
+
+	blocks_dir := path.Join(bc.dir, BLOCKS_DIR)
+	cold_dir := path.Join(bc.dir, COLD_DIR)
+	if cold {
+		if _, err := os.Stat(cold_dir); os.IsNotExist(err) {
+			err := os.MkdirAll(cold_dir, 0755)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	count := 0
+	for i := 1; i < height; i++ { // the genesis block is never pruned
+		blk := &bc.blocks[i]
+		if blk.IsPruned() || blk.GetTxType() != transaction.Entry {
+			continue
+		}
+
+		hashhex := hex.EncodeToString(blk.GetHash())
+		fname := path.Join(blocks_dir, hashhex+".dat")
+		if cold {
+			err := os.WriteFile(path.Join(cold_dir, hashhex+".dat"), blk.Marshal(), 0777)
+			if err != nil {
+				return count, err
+			}
+		}
+
+		blk.Prune()
+
+		// write the header before removing the full block so the chain is never left without it
+		_, err := blk.Save(blocks_dir)
+		if err != nil {
+			return count, err
+		}
+		err = os.Remove(fname)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return count, err
+		}
+		count += 1
+	}
+
+	return count, nil
+}
+
+// loads the full copy of a pruned block from the cold directory of the data directory dir
+func LoadColdBlock(dir string, hash []byte) (blk block.Block, err error) {
+	hashhex := hex.EncodeToString(hash)
+	data, err := os.ReadFile(path.Join(dir, COLD_DIR, hashhex+".dat"))
+	if err != nil {
+		return blk, err
+	}
+
+	blk, err = block.Unmarshal(data)
+	if err != nil {
+		return blk, err
+	}
+	if hex.EncodeToString(blk.GetHash()) != hashhex {
+		return blk, fmt.Errorf("cold copy of block %s has the wrong hash", hashhex)
+	}
+	return blk, nil
+}
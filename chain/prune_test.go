@@ -0,0 +1,70 @@
+package chain
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"reddchain/block"
+	"reddchain/identity/identitytest"
+	"reddchain/transaction"
+)
+
+func TestPrune(t *testing.T) {
+	id_main := identitytest.Identity("main")
+	id_bar := identitytest.Identity("bar")
+
+	bc := newTestChain(t, "prune", id_main,
+		transaction.NewTx_Entry([]byte("pruned")),
+		transaction.NewTx_Permission(5, id_bar.GetPubBytes()),
+		transaction.NewTx_Entry([]byte("kept")))
+	dir := t.TempDir()
+	if err := bc.Save(dir); err != nil {
+		t.Fatalf("error saving chain (%s)", err)
+	}
+
+	n, err := bc.Prune(3, true)
+	if err != nil {
+		t.Fatalf("error pruning chain (%s)", err)
+	}
+	if n != 1 {
+		t.Errorf("pruned %d blocks, expected only the first entry", n)
+	}
+
+	loaded, err := LoadChain(dir, "prune")
+	if err != nil {
+		t.Fatalf("error loading pruned chain (%s)", err)
+	}
+	if !bytes.Equal(loaded.GetTipHash(), bc.GetTipHash()) {
+		t.Errorf("tip of pruned chain %x doesn't match %x", loaded.GetTipHash(), bc.GetTipHash())
+	}
+	if !bytes.Equal(loaded.GetStateRoot(), bc.GetStateRoot()) {
+		t.Errorf("state of pruned chain doesn't match")
+	}
+
+	pruned := loaded.blocks[1]
+	if _, err := pruned.GetPayload(); !errors.Is(err, block.ErrPruned) {
+		t.Errorf("payload of pruned block was returned (%v)", err)
+	}
+	if _, err := pruned.Verify(); err != nil {
+		t.Errorf("pruned block failed verification (%s)", err)
+	}
+	kept := loaded.blocks[2]
+	if kept.IsPruned() {
+		t.Errorf("permission block was pruned")
+	}
+
+	cold, err := LoadColdBlock(dir, pruned.GetHash())
+	if err != nil {
+		t.Fatalf("error loading cold copy of pruned block (%s)", err)
+	}
+	payload, err := cold.GetPayload()
+	if err != nil || string(payload) != "pruned" {
+		t.Errorf("cold copy has the wrong payload %q (%v)", payload, err)
+	}
+
+	var buf bytes.Buffer
+	if err := loaded.Export(&buf); !errors.Is(err, block.ErrPruned) {
+		t.Errorf("pruned chain was exported (%v)", err)
+	}
+}
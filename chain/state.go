@@ -0,0 +1,252 @@
+package chain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"reddchain/identity"
+	"reddchain/transaction"
+)
+
+// the state of a chain is the set of validators and how many blocks each may still mint
+// every block commits to a merkle root of the state after it is applied
+// leaves are sorted by validator so that every node derives the same root
+
+// one step of a state proof
+type ProofStep struct {
+	Hash []byte `json:"hash"` // hash of the sibling node
+	Left bool   `json:"left"` // true if the sibling is on the left
+}
+
+// hash of a single validator's allowance
+// leaves and interior nodes use different prefixes so one can't be passed off as the other
+func stateLeaf(validator []byte, allowance uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, allowance)
+	hash := sha256.New()
+	hash.Write([]byte{0x00})
+	hash.Write(validator)
+	hash.Write(b)
+	return hash.Sum(nil)
+}
+
+// hash of an interior node of the state tree
+func stateNode(left []byte, right []byte) []byte {
+	hash := sha256.New()
+	hash.Write([]byte{0x01})
+	hash.Write(left)
+	hash.Write(right)
+	return hash.Sum(nil)
+}
+
+// returns the validators sorted by their public keys
+func SortedValidators(validators map[string]uint32) []string {
+	keys := make([]string, 0, len(validators))
+	for v := range validators {
+		keys = append(keys, v)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// computes the leaves of the state tree in order
+func stateLeaves(validators map[string]uint32) ([][]byte, error) {
+	var leaves [][]byte
+	for _, v := range SortedValidators(validators) {
+		pub, err := hex.DecodeString(v)
+		if err != nil {
+			return nil, err
+		}
+		leaves = append(leaves, stateLeaf(pub, validators[v]))
+	}
+	return leaves, nil
+}
+
+// combines each pair of nodes into the next level of the tree
+// an odd node at the end of a level is carried up unchanged
+func nextLevel(level [][]byte) [][]byte {
+	var next [][]byte
+	for i := 0; i < len(level); i += 2 {
+		if i+1 < len(level) {
+			next = append(next, stateNode(level[i], level[i+1]))
+		} else {
+			next = append(next, level[i])
+		}
+	}
+	return next
+}
+
+// computes the merkle root of the validator state
+func StateRoot(validators map[string]uint32) []byte {
+	leaves, err := stateLeaves(validators)
+	if err != nil {
+		panic(err)
+	}
+	if len(leaves) == 0 {
+		empty := sha256.Sum256(nil)
+		return empty[:]
+	}
+	for len(leaves) > 1 {
+		leaves = nextLevel(leaves)
+	}
+	return leaves[0]
+}
+
+// builds a proof that the validator's allowance is included in the state root
+func StateProof(validators map[string]uint32, validator string) (proof []ProofStep, err error) {
+	if _, ok := validators[validator]; !ok {
+		return proof, errors.New("validator is not in the state")
+	}
+
+	level, err := stateLeaves(validators)
+	if err != nil {
+		return proof, err
+	}
+	index := sort.SearchStrings(SortedValidators(validators), validator)
+
+	for len(level) > 1 {
+		if index%2 == 1 {
+			proof = append(proof, ProofStep{Hash: level[index-1], Left: true})
+		} else if index+1 < len(level) {
+			proof = append(proof, ProofStep{Hash: level[index+1], Left: false})
+		}
+		level = nextLevel(level)
+		index /= 2
+	}
+	return proof, nil
+}
+
+// checks a proof that the validator had the given allowance in the state with the given root
+func VerifyStateProof(root []byte, validator []byte, allowance uint32, proof []ProofStep) bool {
+	node := stateLeaf(validator, allowance)
+	for _, step := range proof {
+		if step.Left {
+			node = stateNode(step.Hash, node)
+		} else {
+			node = stateNode(node, step.Hash)
+		}
+	}
+	return bytes.Equal(node, root)
+}
+
+// returns true if the validator's allowance is never used up
+func IsUnlimited(allowance uint32) bool {
+	return allowance == UNLIMITED_ALLOWANCE
+}
+
+// formats an on-chain allowance for display
+func FormatAllowance(allowance uint32, ok bool) string {
+	if !ok {
+		return "not a validator"
+	}
+	if IsUnlimited(allowance) {
+		return "unlimited"
+	}
+	return strconv.FormatUint(uint64(allowance), 10)
+}
+
+// returned by ApplyTx when a validator can't mint a transaction
+var (
+	ErrNotAuthorized         = errors.New("validator is not authorized")
+	ErrInsufficientAllowance = errors.New("validator is not authorized to delegate that many blocks")
+)
+
+// returns a copy of the validator state
+func copyState(validators map[string]uint32) map[string]uint32 {
+	c := make(map[string]uint32, len(validators))
+	for v, n := range validators {
+		c[v] = n
+	}
+	return c
+}
+
+// applies a transaction minted by validator to a copy of the state
+// returns the resulting state, or an error if the validator isn't allowed to mint it
+func ApplyTx(validators map[string]uint32, validator string, tx transaction.Transaction) (map[string]uint32, error) {
+
+	// check if validator has authorization to publish to the chain
+	if val, ok := validators[validator]; !ok || val <= 0 {
+		return nil, ErrNotAuthorized
+	}
+
+	next := copyState(validators)
+
+	// check for various transaction types
+	if tx.Type() == transaction.Entry {
+		// no need to do anything
+	} else if tx.Type() == transaction.Permission {
+		n, delegate, err := tx.ParseTx_Permission()
+		if err != nil {
+			return nil, err
+		}
+
+		// check that validator has enough blocks to delegate
+		// take them away if so, unless the validator is unlimited
+		if !IsUnlimited(next[validator]) {
+			if next[validator] <= n {
+				return nil, ErrInsufficientAllowance
+			}
+			next[validator] -= n
+		}
+
+		// give blocks to other validator
+		// multisig validators must be registered before they can be given blocks
+		if err := identity.ValidValidatorKey(delegate); err != nil {
+			return nil, fmt.Errorf("invalid delegate (%w)", err)
+		}
+		grantee := hex.EncodeToString(delegate)
+		if _, ok := next[grantee]; !ok && identity.IsMultisigID(delegate) {
+			return nil, errors.New("multisig validator hasn't been registered")
+		}
+
+		// a delegated allowance can't grow large enough to become unlimited
+		if !IsUnlimited(next[grantee]) {
+			if uint64(next[grantee])+uint64(n) >= uint64(UNLIMITED_ALLOWANCE) {
+				return nil, errors.New("delegation would overflow the validator's allowance")
+			}
+			next[grantee] += n
+		}
+	} else if tx.Type() == transaction.Multisig {
+		// register the multisig validator with no allowance
+		policy, err := tx.ParseTx_Multisig()
+		if err != nil {
+			return nil, err
+		}
+		id := hex.EncodeToString(policy.ID())
+		if _, ok := next[id]; ok {
+			return nil, errors.New("multisig validator is already registered")
+		}
+		next[id] = 0
+	} else if tx.Type() == transaction.Alias {
+		// uniqueness depends on the chain's aliases, which AppendBlock checks
+		if _, err := tx.ParseTx_Alias(); err != nil {
+			return nil, err
+		}
+	} else if tx.Type() == transaction.Certificate {
+		// whether the certificate chains to a trusted CA depends on the chain, which AppendBlock checks
+		if _, err := tx.ParseTx_Certificate(); err != nil {
+			return nil, err
+		}
+	} else if tx.Type() == transaction.Revocation {
+		if _, err := tx.ParseTx_Revocation(); err != nil {
+			return nil, err
+		}
+	} else if tx.Type() == transaction.Blob {
+		// the blob itself is off-chain, but the commitment must be well formed
+		_, _, err := tx.ParseTx_Blob()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !IsUnlimited(next[validator]) {
+		next[validator] -= 1
+	}
+	return next, nil
+}
@@ -0,0 +1,64 @@
+package chain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"reddchain/identity/identitytest"
+	"reddchain/transaction"
+)
+
+func TestStateProof(t *testing.T) {
+	// odd sizes exercise nodes that are carried up a level
+	for size := 1; size <= 9; size++ {
+		validators := make(map[string]uint32)
+		for i := 0; i < size; i++ {
+			validators[hex.EncodeToString([]byte(fmt.Sprintf("validator %d", i)))] = uint32(100 + i)
+		}
+		root := StateRoot(validators)
+
+		for v, n := range validators {
+			proof, err := StateProof(validators, v)
+			if err != nil {
+				t.Fatalf("error creating proof for %s (%s)", v, err)
+			}
+			pub, _ := hex.DecodeString(v)
+			if !VerifyStateProof(root, pub, n, proof) {
+				t.Errorf("valid proof for %s in a state of size %d was rejected", v, size)
+			}
+			if VerifyStateProof(root, pub, n+1, proof) {
+				t.Errorf("proof for %s was accepted with the wrong allowance", v)
+			}
+		}
+	}
+}
+
+func TestStateRootOrder(t *testing.T) {
+	a := map[string]uint32{"aa": 1, "bb": 2, "cc": 3}
+	b := map[string]uint32{"cc": 3, "aa": 1, "bb": 2}
+	if hex.EncodeToString(StateRoot(a)) != hex.EncodeToString(StateRoot(b)) {
+		t.Errorf("state root depends on map order")
+	}
+	b["bb"] = 1
+	if hex.EncodeToString(StateRoot(a)) == hex.EncodeToString(StateRoot(b)) {
+		t.Errorf("state root didn't change with the state")
+	}
+}
+
+func TestBlobTransaction(t *testing.T) {
+	id := identitytest.Identity("main")
+	bc := newTestChain(t, "blob", id)
+
+	hash := sha256.Sum256([]byte("blob"))
+	blk := newTestBlock(t, &bc, transaction.NewTx_Blob(hash[:], 4), id)
+	if _, err := bc.AppendBlock(blk); err != nil {
+		t.Errorf("error appending blob block (%s)", err)
+	}
+
+	malformed := transaction.New(transaction.Blob, hash[:])
+	if _, err := ApplyTx(bc.GetValidators(), hex.EncodeToString(id.GetPubBytes()), malformed); err == nil {
+		t.Errorf("malformed blob transaction was accepted")
+	}
+}
@@ -0,0 +1,150 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"reddchain/blob"
+	"reddchain/transaction"
+)
+
+// UploadBlob uploads a file to the node's blob store in chunks of blob.BLOB_CHUNK_SIZE
+// an interrupted upload resumes from the offset reported by the node
+func (c *Client) UploadBlob(ctx context.Context, fname string) (hash []byte, size uint64, err error) {
+	hash, size, err = blob.HashBlobFile(fname)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	blobUrl := fmt.Sprintf("%s/blob?hash=%x&size=%d", c.base_url, hash, size)
+
+	// ask the node how much it already has
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, blobUrl, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, err := c.send(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	resp.Body.Close()
+	offset, _ := strconv.ParseInt(resp.Header.Get("X-Blob-Offset"), 10, 64)
+	if resp.StatusCode == http.StatusOK && uint64(offset) == size {
+		return hash, size, nil
+	}
+
+	for {
+		chunk := make([]byte, blob.BLOB_CHUNK_SIZE)
+		n, err := f.ReadAt(chunk, offset)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, 0, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, fmt.Sprintf("%s&offset=%d", blobUrl, offset), bytes.NewReader(chunk[:n]))
+		if err != nil {
+			return nil, 0, err
+		}
+		resp, err := c.send(req)
+		if err != nil {
+			return nil, 0, err
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusCreated {
+			return hash, size, nil
+		}
+		if resp.StatusCode != http.StatusAccepted {
+			return nil, 0, fmt.Errorf("server rejected blob chunk at %d (%d): %s", offset, resp.StatusCode, strings.TrimSpace(string(body)))
+		}
+		offset += int64(n)
+		if n == 0 {
+			return nil, 0, errors.New("server didn't accept the final chunk")
+		}
+	}
+}
+
+// DownloadBlob downloads a blob in chunks of blob.BLOB_CHUNK_SIZE and writes it to fname
+// the file is only written if the blob matches the hash and size
+func (c *Client) DownloadBlob(ctx context.Context, hash []byte, size uint64, fname string) error {
+	blobUrl := fmt.Sprintf("%s/blob?hash=%x", c.base_url, hash)
+
+	tmp, err := os.CreateTemp(path.Dir(fname), path.Base(fname)+".*.part")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	for offset := uint64(0); offset < size; offset += uint64(blob.BLOB_CHUNK_SIZE) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, blobUrl, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+uint64(blob.BLOB_CHUNK_SIZE)-1))
+		resp, err := c.send(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return fmt.Errorf("server returned %d for blob %x", resp.StatusCode, hash)
+		}
+		_, err = io.Copy(tmp, io.LimitReader(resp.Body, blob.BLOB_CHUNK_SIZE))
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tmp.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	err = blob.VerifyBlob(tmp, hash, size)
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	return os.Rename(tmp.Name(), fname)
+}
+
+// SubmitBlob uploads a file to the node's blob store, then submits a block committing to it
+func (c *Client) SubmitBlob(ctx context.Context, signer Signer, fname string) (Verdict, error) {
+	hash, size, err := c.UploadBlob(ctx, fname)
+	if err != nil {
+		return Verdict{}, err
+	}
+	return c.Submit(ctx, signer, transaction.NewTx_Blob(hash, size))
+}
+
+// FetchBlob downloads the blob committed to by a block and checks it against the commitment
+func (c *Client) FetchBlob(ctx context.Context, block_hash []byte, fname string) error {
+	b, err := c.GetBlock(ctx, block_hash)
+	if err != nil {
+		return err
+	}
+	if b.IsPruned() {
+		return fmt.Errorf("block %x has been pruned", block_hash)
+	}
+	tx := b.GetTx()
+	hash, size, err := tx.ParseTx_Blob()
+	if err != nil {
+		return err
+	}
+	return c.DownloadBlob(ctx, hash, size, fname)
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"os"
+	"path"
+	"testing"
+
+	"reddchain/blob"
+	"reddchain/identity/identitytest"
+)
+
+func TestClientBlobTransfer(t *testing.T) {
+	url, _ := newTestNode(t, "blob-transfer", identitytest.Identity("main"))
+	c, _ := New(url)
+	ctx := context.Background()
+
+	// large enough to need several chunks
+	content := make([]byte, 2*blob.BLOB_CHUNK_SIZE+12345)
+	rand.Read(content)
+	dir := t.TempDir()
+	fname := path.Join(dir, "upload")
+	if err := os.WriteFile(fname, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	hash, size, err := c.UploadBlob(ctx, fname)
+	if err != nil {
+		t.Fatalf("error uploading blob (%s)", err)
+	}
+	expected := sha256.Sum256(content)
+	if !bytes.Equal(hash, expected[:]) || size != uint64(len(content)) {
+		t.Errorf("upload returned hash %x and size %d", hash, size)
+	}
+
+	// uploading again should be a no-op
+	if _, _, err := c.UploadBlob(ctx, fname); err != nil {
+		t.Errorf("error uploading blob a second time (%s)", err)
+	}
+
+	downloaded := path.Join(dir, "download")
+	if err := c.DownloadBlob(ctx, hash, size, downloaded); err != nil {
+		t.Fatalf("error downloading blob (%s)", err)
+	}
+	data, err := os.ReadFile(downloaded)
+	if err != nil || !bytes.Equal(data, content) {
+		t.Errorf("downloaded blob doesn't match the upload")
+	}
+
+	// a download that doesn't match the commitment must not be written
+	mismatched := path.Join(dir, "mismatched")
+	if err := c.DownloadBlob(ctx, hash, size+1, mismatched); err == nil {
+		t.Errorf("blob with the wrong size was accepted")
+	}
+	if _, err := os.Stat(mismatched); err == nil {
+		t.Errorf("blob with the wrong size was written")
+	}
+}
@@ -0,0 +1,515 @@
+// Package client talks to reddchain nodes over HTTP.
+//
+// A Client reads blocks from a chain served by a node and submits blocks signed by a Signer.
+// Blocks read from a node are verified before they are returned.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"reddchain/block"
+	"reddchain/chain"
+	"reddchain/identity"
+	"reddchain/node"
+	"reddchain/transaction"
+)
+
+// Signer signs blocks on behalf of a validator
+// keystore identities, remote signers and multisig signers all implement it
+type Signer = identity.Signer
+
+// Block is a block of the chain and its height
+// the data of a pruned block has been discarded, only its header is kept
+type Block struct {
+	block.Block
+	Height int // -1 if the server didn't report it
+}
+
+// defaults for a new Client
+const (
+	DEFAULT_TIMEOUT         = 10 * time.Second
+	DEFAULT_POLL_INTERVAL   = time.Second
+	DEFAULT_SUBMIT_ATTEMPTS = 5
+)
+
+// Client is a client for one chain served by a node
+type Client struct {
+	base_url        string
+	http_client     *http.Client
+	genesis         string
+	poll_interval   time.Duration
+	submit_attempts int
+	auth            Signer      // signs each request if set
+	tls_config      *tls.Config // set by the tls options, applied to the transport by New
+	err             error       // the first error of an option, returned by New
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithTimeout sets the timeout of each HTTP request
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) { c.http_client.Timeout = timeout }
+}
+
+// WithHTTPClient sets the HTTP client used for requests, for example to configure TLS
+func WithHTTPClient(http_client *http.Client) Option {
+	return func(c *Client) { c.http_client = http_client }
+}
+
+// WithCABundle trusts the CAs in a PEM bundle, instead of the system's, to verify the node's certificate
+func WithCABundle(fname string) Option {
+	return func(c *Client) {
+		pool, err := node.LoadCABundle(fname)
+		if err != nil {
+			c.fail(fmt.Errorf("CA bundle: %w", err))
+			return
+		}
+		c.tlsConfig().RootCAs = pool
+	}
+}
+
+// WithClientCert presents a certificate to nodes that require mutual tls
+// the certificate must be for the key of an identity the node knows, such as a validator of the chain
+func WithClientCert(cert_file string, key_file string) Option {
+	return func(c *Client) {
+		cert, err := tls.LoadX509KeyPair(cert_file, key_file)
+		if err != nil {
+			c.fail(fmt.Errorf("client certificate: %w", err))
+			return
+		}
+		c.tlsConfig().Certificates = []tls.Certificate{cert}
+	}
+}
+
+// WithAuth signs every request with signer, for nodes that require requests to be signed by a known identity
+// the signer is usually a validator of the chain, and needn't be the one blocks are submitted with
+func WithAuth(signer Signer) Option {
+	return func(c *Client) { c.auth = signer }
+}
+
+// WithChain selects a chain other than the node's main chain
+func WithChain(label string) Option {
+	return func(c *Client) { c.base_url += "/chains/" + url.PathEscape(label) }
+}
+
+// WithGenesis makes every request fail with ErrGenesisMismatch unless the chain has this genesis block
+func WithGenesis(hash []byte) Option {
+	return func(c *Client) { c.genesis = hex.EncodeToString(hash) }
+}
+
+// WithPollInterval sets how often WaitForInclusion polls the node
+func WithPollInterval(interval time.Duration) Option {
+	return func(c *Client) { c.poll_interval = interval }
+}
+
+// WithSubmitAttempts sets how many times a submission is rebuilt when another block takes the tip first
+func WithSubmitAttempts(attempts int) Option {
+	return func(c *Client) { c.submit_attempts = attempts }
+}
+
+// New creates a client for the node at base_url
+func New(base_url string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(base_url)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported url scheme %q", u.Scheme)
+	}
+	c := &Client{
+		base_url:        strings.TrimRight(base_url, "/") + node.API_PREFIX,
+		http_client:     &http.Client{Timeout: DEFAULT_TIMEOUT},
+		poll_interval:   DEFAULT_POLL_INTERVAL,
+		submit_attempts: DEFAULT_SUBMIT_ATTEMPTS,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	if c.tls_config != nil {
+		if err := c.applyTLS(); err != nil {
+			return nil, err
+		}
+	}
+	if c.submit_attempts < 1 {
+		return nil, errors.New("submit attempts must be at least 1")
+	}
+	return c, nil
+}
+
+// records the first error of the options
+func (c *Client) fail(err error) {
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+// returns the tls configuration the tls options add to
+func (c *Client) tlsConfig() *tls.Config {
+	if c.tls_config == nil {
+		c.tls_config = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return c.tls_config
+}
+
+// gives the http client a transport with the tls configuration of the options
+// an http client given by WithHTTPClient is copied rather than changed, and its transport's tls configuration is replaced
+func (c *Client) applyTLS() error {
+	var transport *http.Transport
+	switch t := c.http_client.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		return errors.New("tls options need an http client with an *http.Transport")
+	}
+	transport.TLSClientConfig = c.tls_config
+	http_client := *c.http_client
+	http_client.Transport = transport
+	c.http_client = &http_client
+	return nil
+}
+
+// URL returns the base url of the client's chain in the node's api
+func (c *Client) URL() string {
+	return c.base_url
+}
+
+// creates a request to an endpoint of the chain
+func (c *Client) newRequest(ctx context.Context, method string, endpoint string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.base_url+endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.genesis != "" {
+		req.Header.Set(node.GENESIS_HEADER, c.genesis)
+	}
+	return req, nil
+}
+
+// signs a request if the client has a signer
+// the body of a signed request is read from GetBody, which http.NewRequest sets for in-memory bodies
+func (c *Client) sign(req *http.Request) error {
+	if c.auth == nil {
+		return nil
+	}
+	var body []byte
+	if req.GetBody != nil {
+		r, err := req.GetBody()
+		if err != nil {
+			return err
+		}
+		body, err = io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+	}
+	return node.SignRequest(req, body, c.auth)
+}
+
+// signs and sends a request
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	if err := c.sign(req); err != nil {
+		return nil, err
+	}
+	return c.http_client.Do(req)
+}
+
+// makes a request to an endpoint of the chain, asking for the encoding given by accept
+// returns the response if its status is 200, a *StatusError otherwise
+func (c *Client) do(ctx context.Context, method string, endpoint string, accept string) (*http.Response, error) {
+	req, err := c.newRequest(ctx, method, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	resp, err := c.send(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return resp, statusError(resp)
+	}
+	return resp, nil
+}
+
+// returns the error for a response with an unexpected status
+// the error's code and message are taken from the response if it's an api envelope
+func statusError(resp *http.Response) *StatusError {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var envelope node.APIResponse
+	if json.Unmarshal(b, &envelope) == nil && envelope.Error != nil {
+		return &StatusError{Status: resp.StatusCode, Code: envelope.Error.Code, Body: envelope.Error.Message}
+	}
+	return &StatusError{Status: resp.StatusCode, Body: strings.TrimSpace(string(b))}
+}
+
+// makes a GET request and decodes the data of the response into v
+// returns the hash of the tip the response belongs to
+func (c *Client) getData(ctx context.Context, endpoint string, v any) ([]byte, error) {
+	resp, err := c.do(ctx, http.MethodGet, endpoint, node.MEDIA_JSON)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var envelope node.APIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return nil, err
+	}
+	if envelope.Error != nil {
+		return nil, &StatusError{Status: resp.StatusCode, Code: envelope.Error.Code, Body: envelope.Error.Message}
+	}
+	tip, _ := hex.DecodeString(envelope.Tip)
+	return tip, json.Unmarshal(envelope.Data, v)
+}
+
+// GetTip returns the hash of the block at the chain's tip
+func (c *Client) GetTip(ctx context.Context) ([]byte, error) {
+	var info node.APITip
+	if _, err := c.getData(ctx, "/tip", &info); err != nil {
+		return nil, err
+	}
+	tip, err := hex.DecodeString(info.Hash)
+	if err != nil || len(tip) != int(block.HASH_SIZE) {
+		return nil, fmt.Errorf("server returned an invalid tip %q", info.Hash)
+	}
+	return tip, nil
+}
+
+// GetState returns the validators and their allowances at the tip, and the tip's hash if the node reports it
+func (c *Client) GetState(ctx context.Context) (map[string]uint32, []byte, error) {
+	state := make(map[string]uint32)
+	tip, err := c.getData(ctx, "/state", &state)
+	if err != nil {
+		return nil, nil, err
+	}
+	return state, tip, nil
+}
+
+// GetValidators returns the validators at the tip with their fingerprints and aliases
+func (c *Client) GetValidators(ctx context.Context) ([]node.ValidatorInfo, error) {
+	var validators []node.ValidatorInfo
+	_, err := c.getData(ctx, "/validators", &validators)
+	return validators, err
+}
+
+// FindValidator returns the validator at the tip with the given fingerprint or alias
+// returns ErrNotFound if no validator has it
+func (c *Client) FindValidator(ctx context.Context, name string) (node.ValidatorInfo, error) {
+	validators, err := c.GetValidators(ctx)
+	if err != nil {
+		return node.ValidatorInfo{}, err
+	}
+	for _, info := range validators {
+		if strings.EqualFold(info.Fingerprint, name) || info.Alias == name {
+			return info, nil
+		}
+	}
+	return node.ValidatorInfo{}, fmt.Errorf("validator %s: %w", name, ErrNotFound)
+}
+
+// fetches a block from the block endpoint in its binary encoding
+// pruned blocks are returned with only their headers
+func (c *Client) getBlock(ctx context.Context, query string) (Block, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/block?"+query, node.MEDIA_BINARY)
+	if err != nil {
+		return Block{}, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Block{}, err
+	}
+	var blk block.Block
+	if resp.Header.Get("X-Block-Status") == "pruned" {
+		blk, err = block.UnmarshalHeader(data)
+	} else {
+		blk, err = block.Unmarshal(data)
+	}
+	if err != nil {
+		return Block{}, err
+	}
+	height, err := strconv.Atoi(resp.Header.Get("X-Block-Height"))
+	if err != nil {
+		height = -1
+	}
+	return Block{Block: blk, Height: height}, nil
+}
+
+// GetBlock returns the block with the given hash
+func (c *Client) GetBlock(ctx context.Context, hash []byte) (Block, error) {
+	b, err := c.getBlock(ctx, "hash="+hex.EncodeToString(hash))
+	if err != nil {
+		return b, err
+	}
+	if !bytes.Equal(b.GetHash(), hash) {
+		return b, errors.New("server returned the wrong block")
+	}
+	return b, nil
+}
+
+// GetBlockAt returns the block at the given height
+func (c *Client) GetBlockAt(ctx context.Context, height int) (Block, error) {
+	return c.getBlock(ctx, "height="+strconv.Itoa(height))
+}
+
+// GetBlocks returns up to count blocks starting at the height from
+// fewer blocks are returned at the end of the chain, or if count is more than the node serves at once
+func (c *Client) GetBlocks(ctx context.Context, from int, count int) ([]Block, error) {
+	var list []node.APIBlock
+	if _, err := c.getData(ctx, fmt.Sprintf("/blocks?from=%d&count=%d", from, count), &list); err != nil {
+		return nil, err
+	}
+
+	var blocks []Block
+	for _, info := range list {
+		b, err := decodeAPIBlock(info, info.Pruned)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
+
+// decodes the raw encoding of a block in the api, checking it against the block's hash
+// the raw encoding is only the block's header if the block is pruned or only headers were asked for
+func decodeAPIBlock(info node.APIBlock, header bool) (Block, error) {
+	data, err := hex.DecodeString(info.Raw)
+	if err != nil {
+		return Block{}, err
+	}
+	var blk block.Block
+	if header {
+		blk, err = block.UnmarshalHeader(data)
+	} else {
+		blk, err = block.Unmarshal(data)
+	}
+	if err != nil {
+		return Block{}, err
+	}
+	if hex.EncodeToString(blk.GetHash()) != info.Hash {
+		return Block{}, fmt.Errorf("block at height %d doesn't match its hash", info.Height)
+	}
+	return Block{Block: blk, Height: info.Height}, nil
+}
+
+// SubmitEntry submits a block with an entry of arbitrary data
+func (c *Client) SubmitEntry(ctx context.Context, signer Signer, data []byte) (Verdict, error) {
+	return c.Submit(ctx, signer, transaction.NewTx_Entry(data))
+}
+
+// SubmitPermission submits a block delegating n blocks of the signer's allowance to the delegate
+// the delegate is a PKIX public key or multisig identifier
+func (c *Client) SubmitPermission(ctx context.Context, signer Signer, n uint32, delegate []byte) (Verdict, error) {
+	return c.Submit(ctx, signer, transaction.NewTx_Permission(n, delegate))
+}
+
+// Submit builds a block with the transaction on top of the tip, signs it and submits it
+// if another block takes the tip first, the block is rebuilt, up to the client's submit attempts
+// returns the node's verdict, with a *RejectionError if the block wasn't accepted
+func (c *Client) Submit(ctx context.Context, signer Signer, tx transaction.Transaction) (verdict Verdict, err error) {
+	validator := hex.EncodeToString(signer.GetPubBytes())
+	for attempt := 1; ; attempt++ {
+		// the state must be the state at the tip we build on
+		tip, err := c.GetTip(ctx)
+		if err != nil {
+			return verdict, err
+		}
+		state, state_tip, err := c.GetState(ctx)
+		if err != nil {
+			return verdict, err
+		}
+		if state_tip != nil && !bytes.Equal(state_tip, tip) {
+			if attempt < c.submit_attempts {
+				continue
+			}
+			return verdict, ErrStaleTip
+		}
+
+		next, err := chain.ApplyTx(state, validator, tx)
+		if err != nil {
+			return verdict, err
+		}
+		blk, err := block.NewBlock(block.GetCurrentTimestamp(), tip, chain.StateRoot(next), tx, signer)
+		if err != nil {
+			return verdict, err
+		}
+
+		verdict, err = c.SubmitBlock(ctx, blk)
+		if errors.Is(err, ErrStaleTip) && attempt < c.submit_attempts {
+			continue
+		}
+		return verdict, err
+	}
+}
+
+// SubmitBlock submits a signed block and returns the node's verdict
+func (c *Client) SubmitBlock(ctx context.Context, blk block.Block) (verdict Verdict, err error) {
+	req, err := c.newRequest(ctx, http.MethodPost, "/submit", bytes.NewReader(blk.Marshal()))
+	if err != nil {
+		return verdict, err
+	}
+	req.Header.Set("Content-Type", node.MEDIA_BINARY)
+	resp, err := c.send(req)
+	if err != nil {
+		return verdict, err
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != node.MEDIA_JSON {
+		return verdict, statusError(resp)
+	}
+
+	var envelope node.APIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return verdict, err
+	}
+	if len(envelope.Data) > 0 {
+		if err := json.Unmarshal(envelope.Data, &verdict); err != nil {
+			return verdict, err
+		}
+	} else if envelope.Error != nil && envelope.Error.Code == node.SUBMIT_MALFORMED {
+		verdict.Code, verdict.Error = envelope.Error.Code, envelope.Error.Message
+	} else if envelope.Error != nil {
+		return verdict, &StatusError{Status: resp.StatusCode, Code: envelope.Error.Code, Body: envelope.Error.Message}
+	}
+	if !envelope.OK || !verdict.Accepted {
+		return verdict, &RejectionError{Status: resp.StatusCode, Verdict: verdict}
+	}
+	return verdict, nil
+}
+
+// WaitForInclusion waits until the block with the given hash is in the chain
+// it polls the node until the block is found or the context is done
+func (c *Client) WaitForInclusion(ctx context.Context, hash []byte) (Block, error) {
+	ticker := time.NewTicker(c.poll_interval)
+	defer ticker.Stop()
+	for {
+		b, err := c.GetBlock(ctx, hash)
+		if !errors.Is(err, ErrNotFound) {
+			return b, err
+		}
+		select {
+		case <-ctx.Done():
+			return Block{}, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
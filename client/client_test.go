@@ -0,0 +1,390 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"reddchain/block"
+	"reddchain/chain/chaintest"
+	"reddchain/identity"
+	"reddchain/identity/identitytest"
+	"reddchain/node"
+	"reddchain/transaction"
+)
+
+type test_signer_t struct {
+	key *ecdsa.PrivateKey
+}
+
+func (s test_signer_t) GetPubBytes() []byte {
+	pub, _ := x509.MarshalPKIXPublicKey(s.key.Public())
+	return pub
+}
+
+func (s test_signer_t) Sign(digest []byte) ([]byte, error) {
+	return ecdsa.SignASN1(rand.Reader, s.key, digest)
+}
+
+func newTestSigner(t *testing.T) test_signer_t {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key (%s)", err)
+	}
+	return test_signer_t{key: key}
+}
+
+// writes an api response for a mock node
+func writeTestResponse(w http.ResponseWriter, status int, tip string, v any, api_err *node.APIError) {
+	resp := node.APIResponse{OK: api_err == nil, Tip: tip, Error: api_err}
+	if v != nil {
+		resp.Data, _ = json.Marshal(v)
+	}
+	w.Header().Set("Content-Type", node.MEDIA_JSON)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func TestClientErrors(t *testing.T) {
+	if _, err := New("ftp://example.com"); err == nil {
+		t.Errorf("client was created with an unsupported scheme")
+	}
+
+	// a node that has no blocks and rejects everything
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v1/chains/test/block":
+			writeTestResponse(w, http.StatusNotFound, "", nil, &node.APIError{Code: node.ERROR_NOT_FOUND, Message: "block not found"})
+		case "/v1/chains/test/submit":
+			verdict := Verdict{Code: node.SUBMIT_REJECTED, Error: "state root doesn't match"}
+			writeTestResponse(w, http.StatusUnprocessableEntity, "", verdict, &node.APIError{Code: verdict.Code, Message: verdict.Error})
+		default:
+			http.Error(w, "genesis mismatch", http.StatusConflict)
+		}
+	}))
+	defer server.Close()
+	c, err := New(server.URL, WithChain("test"))
+	if err != nil {
+		t.Fatalf("error creating client (%s)", err)
+	}
+
+	if _, err := c.GetBlock(context.Background(), make([]byte, block.HASH_SIZE)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing block returned %v", err)
+	}
+	if _, err := c.GetTip(context.Background()); !errors.Is(err, ErrGenesisMismatch) {
+		t.Errorf("genesis mismatch returned %v", err)
+	}
+	_, err = c.SubmitBlock(context.Background(), block.Block{})
+	var rejected *RejectionError
+	if !errors.As(err, &rejected) || !errors.Is(err, ErrRejected) || errors.Is(err, ErrStaleTip) || rejected.Status != http.StatusUnprocessableEntity {
+		t.Errorf("rejected block returned %v", err)
+	}
+}
+
+func TestClientRejectionReasons(t *testing.T) {
+	cases := []struct {
+		code string
+		err  error
+	}{
+		{node.SUBMIT_NOT_AUTHORIZED, ErrNotAuthorized},
+		{node.SUBMIT_INSUFFICIENT_ALLOWANCE, ErrInsufficientAllowance},
+		{node.SUBMIT_DUPLICATE_ALIAS, ErrDuplicateAlias},
+		{node.SUBMIT_REVOKED_CERTIFICATE, ErrRevokedCertificate},
+		{node.SUBMIT_INVALID_CERTIFICATE, ErrInvalidCertificate},
+		{node.SUBMIT_WRONG_STATE_ROOT, ErrWrongStateRoot},
+		{node.SUBMIT_TX_TOO_LARGE, ErrTxTooLarge},
+		{node.SUBMIT_REJECTED, ErrRejected},
+	}
+	for _, c := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			verdict := Verdict{Code: c.code, Error: "rejected for a reason"}
+			writeTestResponse(w, http.StatusUnprocessableEntity, "", verdict, &node.APIError{Code: verdict.Code, Message: verdict.Error})
+		}))
+		cl, err := New(server.URL, WithChain("test"))
+		if err != nil {
+			t.Fatalf("error creating client (%s)", err)
+		}
+
+		// every reason is also a rejection, and only matches its own error
+		_, err = cl.SubmitBlock(context.Background(), block.Block{})
+		if !errors.Is(err, c.err) || !errors.Is(err, ErrRejected) || errors.Is(err, ErrStaleTip) || errors.Is(err, ErrMalformed) {
+			t.Errorf("verdict %s returned %v", c.code, err)
+		}
+		for _, other := range cases {
+			if other.err != c.err && other.err != ErrRejected && errors.Is(err, other.err) {
+				t.Errorf("verdict %s matches %v", c.code, other.err)
+			}
+		}
+		server.Close()
+	}
+}
+
+func TestClientSubmitRetries(t *testing.T) {
+	signer := newTestSigner(t)
+	validator := hex.EncodeToString(signer.GetPubBytes())
+	tips := []string{strings.Repeat("11", int(block.HASH_SIZE)), strings.Repeat("22", int(block.HASH_SIZE))}
+	submissions := 0
+
+	// another block takes the tip just before the first submission arrives
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		tip := tips[min(submissions, 1)]
+		switch req.URL.Path {
+		case "/v1/tip":
+			writeTestResponse(w, http.StatusOK, tip, node.APITip{Hash: tip}, nil)
+		case "/v1/state":
+			writeTestResponse(w, http.StatusOK, tip, map[string]uint32{validator: 3}, nil)
+		case "/v1/submit":
+			data, _ := io.ReadAll(req.Body)
+			b, err := block.Unmarshal(data)
+			submissions++
+			if err != nil || hex.EncodeToString(b.GetPrevHash()) != tips[1] {
+				verdict := Verdict{Code: node.SUBMIT_STALE_TIP, Tip: tips[1]}
+				writeTestResponse(w, http.StatusConflict, tips[1], verdict, &node.APIError{Code: verdict.Code})
+				return
+			}
+			verdict := Verdict{Accepted: true, Code: node.SUBMIT_ACCEPTED, Hash: hex.EncodeToString(b.GetHash()), Height: 7}
+			writeTestResponse(w, http.StatusOK, tip, verdict, nil)
+		}
+	}))
+	defer server.Close()
+
+	c, _ := New(server.URL)
+	verdict, err := c.SubmitEntry(context.Background(), signer, []byte("retry"))
+	if err != nil || verdict.Height != 7 || submissions != 2 {
+		t.Errorf("submission wasn't retried on the new tip (%d submissions, %v)", submissions, err)
+	}
+
+	submissions = 0
+	c, _ = New(server.URL, WithSubmitAttempts(1))
+	if _, err := c.SubmitEntry(context.Background(), signer, []byte("no retry")); !errors.Is(err, ErrStaleTip) {
+		t.Errorf("stale submission returned %v", err)
+	}
+}
+
+// serves a new chain whose only genesis validator is id for the duration of a test
+// the node's data directory is a temporary directory
+// returns the url of the node and the chain's genesis hash
+func newTestNode(t *testing.T, label string, id identity.Signer) (string, []byte) {
+	gf := chaintest.Genesis(t, label, id)
+	genesis, err := gf.Block()
+	if err != nil {
+		t.Fatalf("error creating genesis block (%s)", err)
+	}
+	cfg := node.DefaultConfig()
+	cfg.DataDir, cfg.Chains = t.TempDir(), []string{label}
+	if err := gf.Save(cfg.DataDir); err != nil {
+		t.Fatalf("error saving genesis file (%s)", err)
+	}
+	n, err := node.NewFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("error creating node (%s)", err)
+	}
+	server := httptest.NewServer(n.Handler())
+	t.Cleanup(server.Close)
+	return server.URL, genesis.GetHash()
+}
+
+func TestClientInvalidTip(t *testing.T) {
+	for _, body := range []string{"", "zz\n", "abcd\n"} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Write([]byte(body))
+		}))
+		c, _ := New(server.URL)
+		if _, err := c.GetTip(context.Background()); err == nil {
+			t.Errorf("invalid tip %q was accepted", body)
+		}
+		server.Close()
+	}
+}
+
+func TestClientSubmitRejected(t *testing.T) {
+	id := identitytest.Identity("main")
+	url, _ := newTestNode(t, "client-rejected", id)
+	c, _ := New(url, WithChain("client-rejected"))
+	ctx := context.Background()
+
+	// a block that isn't valid for the chain gets a structured verdict
+	tip, _ := c.GetTip(ctx)
+	blk, err := block.NewBlock(block.GetCurrentTimestamp(), tip, make([]byte, block.HASH_SIZE), transaction.NewTx_Entry([]byte("wrong state")), id)
+	if err != nil {
+		t.Fatalf("error creating block (%s)", err)
+	}
+	_, err = c.SubmitBlock(ctx, blk)
+	var rejected *RejectionError
+	if !errors.As(err, &rejected) || !errors.Is(err, ErrRejected) || !errors.Is(err, ErrWrongStateRoot) || rejected.Status != http.StatusUnprocessableEntity {
+		t.Errorf("invalid block wasn't rejected (%v)", err)
+	}
+
+	resp, err := http.Post(c.URL()+"/submit", "text/plain", strings.NewReader("not hex\n"))
+	if err != nil {
+		t.Fatalf("error submitting (%s)", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("malformed block returned %d", resp.StatusCode)
+	}
+
+	// a validator without an allowance is refused before anything is submitted
+	if _, err := c.SubmitEntry(ctx, identitytest.Identity("bar"), []byte("not allowed")); !errors.Is(err, ErrNotAuthorized) {
+		t.Errorf("entry from a non-validator returned %v", err)
+	}
+}
+
+func TestClientSubmitStaleTip(t *testing.T) {
+	id := identitytest.Identity("main")
+	url, _ := newTestNode(t, "client-stale", id)
+	ctx := context.Background()
+	direct, _ := New(url, WithChain("client-stale"))
+
+	// another block takes the tip just before the first submission arrives
+	target, _ := http.NewRequest(http.MethodGet, url, nil)
+	proxy := httputil.NewSingleHostReverseProxy(target.URL)
+	raced := false
+	racing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasSuffix(req.URL.Path, "/submit") && !raced {
+			raced = true
+			if _, err := direct.SubmitEntry(ctx, id, []byte("first")); err != nil {
+				t.Errorf("error appending racing block (%s)", err)
+			}
+		}
+		proxy.ServeHTTP(w, req)
+	}))
+	defer racing.Close()
+
+	c, _ := New(racing.URL, WithChain("client-stale"))
+	verdict, err := c.SubmitEntry(ctx, id, []byte("second"))
+	if err != nil {
+		t.Fatalf("error submitting after a tip race (%s)", err)
+	}
+	if !raced || verdict.Height != 2 {
+		t.Errorf("block wasn't rebuilt on the new tip (%+v)", verdict)
+	}
+}
+
+// the client must build blocks the node accepts
+func TestClientNode(t *testing.T) {
+	id := identitytest.Identity("main")
+	url, genesis := newTestNode(t, "client-node", id)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	c, err := New(url, WithChain("client-node"), WithGenesis(genesis), WithPollInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("error creating client (%s)", err)
+	}
+	sub := c.Subscribe(ctx, 1)
+
+	verdict, err := c.SubmitEntry(ctx, id, []byte("from the client"))
+	if err != nil || verdict.Height != 1 || verdict.Code != node.SUBMIT_ACCEPTED || verdict.Tip != verdict.Hash {
+		t.Fatalf("error submitting entry (%v, %+v)", err, verdict)
+	}
+	bar := identitytest.Identity("bar")
+	if _, err := c.SubmitPermission(ctx, id, 5, bar.GetPubBytes()); err != nil {
+		t.Fatalf("error submitting permission (%s)", err)
+	}
+	if _, err := c.SubmitEntry(ctx, bar, []byte("from a delegate")); err != nil {
+		t.Fatalf("error submitting entry from delegate (%s)", err)
+	}
+
+	tip, err := c.GetTip(ctx)
+	if err != nil {
+		t.Errorf("error getting tip (%s)", err)
+	}
+	hash, _ := hex.DecodeString(verdict.Hash)
+	blk, err := c.WaitForInclusion(ctx, hash)
+	if payload, _ := blk.GetPayload(); err != nil || blk.Height != 1 || string(payload) != "from the client" {
+		t.Errorf("wrong block at height %d (%v)", blk.Height, err)
+	}
+	if !bytes.Equal(blk.GetPrevHash(), genesis) {
+		t.Errorf("block doesn't build on the genesis block")
+	}
+	blocks, err := c.GetBlocks(ctx, 0, 10)
+	if err != nil || len(blocks) != 4 || !bytes.Equal(blocks[3].GetHash(), tip) {
+		t.Errorf("wrong blocks (%d, %v)", len(blocks), err)
+	}
+	validators, err := c.GetValidators(ctx)
+	if err != nil || len(validators) != 2 {
+		t.Errorf("wrong validators %+v (%v)", validators, err)
+	}
+	found, err := c.FindValidator(ctx, identity.Fingerprint(bar.GetPubBytes()))
+	if err != nil || found.PubKey != hex.EncodeToString(bar.GetPubBytes()) || found.Allowance != 4 {
+		t.Errorf("wrong validator %+v for the delegate's fingerprint (%v)", found, err)
+	}
+	if _, err := c.FindValidator(ctx, "nobody"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown validator returned %v", err)
+	}
+
+	for height := 1; height <= 3; height++ {
+		b := <-sub.Blocks
+		if b.Height != height {
+			t.Errorf("subscription delivered height %d, expected %d", b.Height, height)
+		}
+	}
+	// filtered subscriptions catch up on the blocks already appended
+	filtered := c.Subscribe(ctx, 0, ByValidator(identity.Fingerprint(bar.GetPubBytes())), ByType(transaction.Entry), HeadersOnly())
+	if b := <-filtered.Blocks; b.Height != 3 || !b.IsPruned() || b.GetValidatorFingerprint() != identity.Fingerprint(bar.GetPubBytes()) {
+		t.Errorf("filtered subscription delivered height %d (%v)", b.Height, filtered.Err())
+	}
+	permissions := c.Subscribe(ctx, 0, ByType(transaction.Permission))
+	if b := <-permissions.Blocks; b.Height != 2 || b.IsPruned() {
+		t.Errorf("subscription to permissions delivered height %d (%v)", b.Height, permissions.Err())
+	}
+	cancel()
+	for range sub.Blocks {
+	}
+	if !errors.Is(sub.Err(), context.Canceled) {
+		t.Errorf("subscription ended with %v", sub.Err())
+	}
+
+	other, _ := New(url, WithChain("client-node"), WithGenesis(make([]byte, block.HASH_SIZE)))
+	if _, err := other.GetTip(context.Background()); !errors.Is(err, ErrGenesisMismatch) {
+		t.Errorf("genesis mismatch returned %v", err)
+	}
+}
+
+// nodes requiring signed requests serve clients that sign with a known identity
+func TestClientAuth(t *testing.T) {
+	validator := newTestSigner(t)
+	cfg := node.DefaultConfig()
+	cfg.RequireAuth, cfg.PublicReads = true, true
+	url := startConfiguredNode(t, cfg, validator)
+	ctx := context.Background()
+
+	c, _ := New(url)
+	if _, err := c.GetTip(ctx); err != nil {
+		t.Errorf("public read was refused (%s)", err)
+	}
+	var status_err *StatusError
+	if _, err := c.SubmitEntry(ctx, validator, []byte("unsigned")); !errors.As(err, &status_err) || status_err.Code != node.ERROR_UNAUTHORIZED {
+		t.Errorf("unsigned submission returned %v", err)
+	}
+	c, _ = New(url, WithAuth(newTestSigner(t)))
+	if _, err := c.GetTip(ctx); !errors.As(err, &status_err) || status_err.Code != node.ERROR_UNAUTHORIZED {
+		t.Errorf("request signed by an unknown identity returned %v", err)
+	}
+
+	c, _ = New(url, WithAuth(validator))
+	if _, err := c.SubmitEntry(ctx, validator, []byte("signed")); err != nil {
+		t.Errorf("signed submission failed (%s)", err)
+	}
+	fname := path.Join(t.TempDir(), "blob")
+	os.WriteFile(fname, []byte("a signed blob"), 0644)
+	if _, err := c.SubmitBlob(ctx, validator, fname); err != nil {
+		t.Errorf("signed blob submission failed (%s)", err)
+	}
+}
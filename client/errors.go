@@ -0,0 +1,86 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"reddchain/chain"
+	"reddchain/node"
+)
+
+// errors that can be matched with errors.Is
+var (
+	ErrNotFound              = errors.New("not found")
+	ErrGenesisMismatch       = errors.New("server's chain has a different genesis block")
+	ErrNotAuthorized         = chain.ErrNotAuthorized
+	ErrInsufficientAllowance = chain.ErrInsufficientAllowance
+	ErrDuplicateAlias        = chain.ErrDuplicateAlias
+	ErrRevokedCertificate    = chain.ErrRevokedCertificate
+	ErrInvalidCertificate    = chain.ErrInvalidCertificate
+	ErrWrongStateRoot        = chain.ErrWrongStateRoot
+	ErrTxTooLarge            = chain.ErrTxTooLarge
+
+	// the reasons a node gives for not accepting a block
+	ErrMalformed = errors.New("block is malformed")
+	ErrStaleTip  = errors.New("block doesn't build on the tip")
+	ErrRejected  = errors.New("block is invalid for the chain")
+	ErrInternal  = errors.New("block is valid but couldn't be saved")
+)
+
+// the verdict codes reported by a node's submit endpoint, and the errors they match
+var verdictErrors = map[string]error{
+	node.SUBMIT_MALFORMED:              ErrMalformed,
+	node.SUBMIT_STALE_TIP:              ErrStaleTip,
+	node.SUBMIT_INTERNAL:               ErrInternal,
+	node.SUBMIT_NOT_AUTHORIZED:         ErrNotAuthorized,
+	node.SUBMIT_INSUFFICIENT_ALLOWANCE: ErrInsufficientAllowance,
+	node.SUBMIT_DUPLICATE_ALIAS:        ErrDuplicateAlias,
+	node.SUBMIT_REVOKED_CERTIFICATE:    ErrRevokedCertificate,
+	node.SUBMIT_INVALID_CERTIFICATE:    ErrInvalidCertificate,
+	node.SUBMIT_WRONG_STATE_ROOT:       ErrWrongStateRoot,
+	node.SUBMIT_TX_TOO_LARGE:           ErrTxTooLarge,
+	node.SUBMIT_REJECTED:               ErrRejected,
+}
+
+// Verdict is a node's verdict on a submitted block
+type Verdict = node.SubmitVerdict
+
+// RejectionError is returned when a node doesn't accept a submitted block
+// it matches ErrMalformed, ErrStaleTip or ErrInternal with errors.Is, or the reason an invalid block was rejected,
+// such as ErrNotAuthorized or ErrWrongStateRoot; every invalid block also matches ErrRejected
+type RejectionError struct {
+	Status  int // http status of the response
+	Verdict Verdict
+}
+
+func (e *RejectionError) Error() string {
+	return fmt.Sprintf("server rejected block %s (%s): %s", e.Verdict.Hash, e.Verdict.Code, e.Verdict.Error)
+}
+
+func (e *RejectionError) Is(target error) bool {
+	if target == ErrRejected && e.Status == http.StatusUnprocessableEntity {
+		return true
+	}
+	return verdictErrors[e.Verdict.Code] == target
+}
+
+// StatusError is returned when a node responds to a request with an unexpected status
+// a 404 matches ErrNotFound and a 409 matches ErrGenesisMismatch with errors.Is
+type StatusError struct {
+	Status int
+	Code   string // the api's error code, if the node reported one
+	Body   string // the api's error message, or the body of the response
+}
+
+func (e *StatusError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("server returned %d (%s): %s", e.Status, e.Code, e.Body)
+	}
+	return fmt.Sprintf("server returned %d: %s", e.Status, e.Body)
+}
+
+func (e *StatusError) Is(target error) bool {
+	return (e.Status == http.StatusNotFound && target == ErrNotFound) ||
+		(e.Status == http.StatusConflict && target == ErrGenesisMismatch)
+}
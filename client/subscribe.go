@@ -0,0 +1,148 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"reddchain/node"
+	"reddchain/transaction"
+)
+
+// Subscription delivers the blocks of a chain as they are appended
+type Subscription struct {
+	Blocks <-chan Block // closed when the subscription ends
+	err    error
+}
+
+// Err returns why the subscription ended, once Blocks is closed
+func (s *Subscription) Err() error {
+	return s.err
+}
+
+// Filter narrows down the blocks a subscription delivers
+type Filter func(query url.Values)
+
+// ByValidator delivers the blocks signed by the validator with this fingerprint, alias or hex-encoded key
+// given several times, the blocks of any of the validators are delivered
+func ByValidator(name string) Filter {
+	return func(query url.Values) { query.Add("validator", name) }
+}
+
+// ByType delivers the blocks whose transactions have this type
+// given several times, the blocks of any of the types are delivered
+func ByType(txtype transaction.Type) Filter {
+	return func(query url.Values) { query.Add("type", txtype.String()) }
+}
+
+// HeadersOnly delivers only the headers of the blocks, as if they had been pruned
+func HeadersOnly() Filter {
+	return func(query url.Values) { query.Set("headers", "true") }
+}
+
+// Subscribe delivers the blocks from the given height onward that pass the filters, in order
+// blocks are streamed by the node as soon as they are appended
+// the subscription ends when the context is done or the stream fails,
+// and can be resumed by subscribing from the height after the last block delivered
+// a negative from delivers only the blocks appended after the subscription starts
+func (c *Client) Subscribe(ctx context.Context, from int, filters ...Filter) *Subscription {
+	blocks := make(chan Block)
+	sub := &Subscription{Blocks: blocks}
+	go func() {
+		defer close(blocks)
+		sub.err = c.stream(ctx, from, filters, blocks)
+		if ctx.Err() != nil {
+			sub.err = ctx.Err()
+		}
+	}()
+	return sub
+}
+
+// reads the subscribe endpoint's stream, sending its blocks to blocks until the stream fails
+func (c *Client) stream(ctx context.Context, from int, filters []Filter, blocks chan<- Block) error {
+	query := url.Values{}
+	if from >= 0 {
+		query.Set("from", strconv.Itoa(from))
+	}
+	for _, filter := range filters {
+		filter(query)
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, "/subscribe?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", node.MEDIA_EVENT_STREAM)
+	if err := c.sign(req); err != nil {
+		return err
+	}
+	// the stream stays open for longer than the timeout of a request
+	http_client := *c.http_client
+	http_client.Timeout = 0
+	resp, err := http_client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp)
+	}
+
+	header := query.Get("headers") == "true"
+	r := bufio.NewReader(resp.Body)
+	var event, data string
+	for {
+		line, err := r.ReadString('\n')
+		if errors.Is(err, io.EOF) {
+			return errors.New("node closed the stream")
+		}
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		// a blank line ends an event, lines starting with a colon are comments
+		if line != "" {
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "event":
+				event = value
+			case "data":
+				if data != "" {
+					data += "\n"
+				}
+				data += value
+			}
+			continue
+		}
+		if event != "block" || data == "" {
+			event, data = "", ""
+			continue
+		}
+		var info node.APIBlock
+		if err := json.Unmarshal([]byte(data), &info); err != nil {
+			return fmt.Errorf("node streamed an invalid block: %w", err)
+		}
+		event, data = "", ""
+		b, err := decodeAPIBlock(info, header || info.Pruned)
+		if err != nil {
+			return err
+		}
+		if b.Height < from {
+			return fmt.Errorf("node streamed the block at height %d out of order", b.Height)
+		}
+		from = b.Height + 1
+		select {
+		case blocks <- b:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"reddchain/chain"
+	"reddchain/chain/chaintest"
+	"reddchain/identity/identitytest"
+	"reddchain/node"
+)
+
+// a certificate authority whose certificate and the certificates it issues are written to a temporary directory
+type test_ca_t struct {
+	*identitytest.CA
+	dir string
+}
+
+func newTestCA(t *testing.T) test_ca_t {
+	ca := test_ca_t{CA: identitytest.NewCA(t, "test CA"), dir: t.TempDir()}
+	ca.write(t, "ca.pem", "CERTIFICATE", ca.Cert.Raw)
+	return ca
+}
+
+// writes a PEM file to the CA's directory, returning its name
+func (ca test_ca_t) write(t *testing.T, name string, pem_type string, der []byte) string {
+	fname := path.Join(ca.dir, name)
+	if err := os.WriteFile(fname, pem.EncodeToMemory(&pem.Block{Type: pem_type, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return fname
+}
+
+// issues a certificate for key, for the server at 127.0.0.1 or for a client
+// returns the names of the certificate and key files
+func (ca test_ca_t) issue(t *testing.T, name string, key crypto.Signer, server bool) (string, string) {
+	cert := ca.IssueTLS(t, name, key.Public(), server)
+	key_der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca.write(t, name+".pem", "CERTIFICATE", cert.Raw), ca.write(t, name+"_key.pem", "PRIVATE KEY", key_der)
+}
+
+// serves the main chain, with validator as its only genesis validator, from a node configured by cfg
+// the node's data directory is a temporary directory, the url of the node is returned
+func startConfiguredNode(t *testing.T, cfg node.Config, validator Signer) string {
+	cfg.DataDir = t.TempDir()
+	gf := chaintest.Genesis(t, chain.MAIN_CHAIN_NAME, validator)
+	if err := gf.Save(cfg.DataDir); err != nil {
+		t.Fatalf("error saving genesis file (%s)", err)
+	}
+
+	n, err := node.NewFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("error creating node (%s)", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := n.Server(ln.Addr().String())
+	t.Cleanup(func() { server.Close() })
+	if server.TLSConfig != nil {
+		go server.ServeTLS(ln, "", "")
+		return "https://" + ln.Addr().String()
+	}
+	go server.Serve(ln)
+	return "http://" + ln.Addr().String()
+}
+
+// clients need a certificate from the node's CA for the key of one of the chain's validators
+func TestClientMutualTLS(t *testing.T) {
+	validator := newTestSigner(t)
+	ca := newTestCA(t)
+	server_key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	cfg := node.DefaultConfig()
+	cfg.TLSCert, cfg.TLSKey = ca.issue(t, "server", server_key, true)
+	cfg.ClientCA = path.Join(ca.dir, "ca.pem")
+	url := startConfiguredNode(t, cfg, validator)
+	ctx := context.Background()
+
+	validator_cert, validator_key := ca.issue(t, "validator", validator.key, false)
+	stranger := newTestSigner(t)
+	stranger_cert, stranger_key := ca.issue(t, "stranger", stranger.key, false)
+
+	// the node's certificate isn't trusted without the CA bundle, and the node wants a client certificate
+	c, _ := New(url, WithClientCert(validator_cert, validator_key))
+	if _, err := c.GetTip(ctx); err == nil {
+		t.Errorf("node was trusted without the CA bundle")
+	}
+	c, _ = New(url, WithCABundle(cfg.ClientCA))
+	if _, err := c.GetTip(ctx); err == nil {
+		t.Errorf("node was reached without a client certificate")
+	}
+
+	// a certificate from the CA isn't enough if its key isn't a known identity
+	c, _ = New(url, WithCABundle(cfg.ClientCA), WithClientCert(stranger_cert, stranger_key))
+	var status_err *StatusError
+	if _, err := c.GetTip(ctx); !errors.As(err, &status_err) || status_err.Code != node.ERROR_FORBIDDEN {
+		t.Errorf("unknown client got %v", err)
+	}
+
+	c, err := New(url, WithCABundle(cfg.ClientCA), WithClientCert(validator_cert, validator_key), WithPollInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("error creating client (%s)", err)
+	}
+	if _, err := c.SubmitPermission(ctx, validator, 5, stranger.GetPubBytes()); err != nil {
+		t.Fatalf("validator couldn't submit over mutual tls (%s)", err)
+	}
+
+	// once it's a validator, the stranger is let in
+	c, _ = New(url, WithCABundle(cfg.ClientCA), WithClientCert(stranger_cert, stranger_key))
+	if _, err := c.GetTip(ctx); err != nil {
+		t.Errorf("new validator was refused (%s)", err)
+	}
+
+	if _, err := New(url, WithCABundle(path.Join(ca.dir, "missing.pem"))); err == nil {
+		t.Errorf("missing CA bundle was accepted")
+	}
+	if _, err := New(url, WithClientCert(validator_key, validator_key)); err == nil {
+		t.Errorf("key file was accepted as a certificate")
+	}
+}
@@ -0,0 +1,119 @@
+package identity
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+// validator keys may use any of these algorithms
+// keys are identified by their PKIX encoding, which records the algorithm,
+// so blocks and the state don't need a separate algorithm field
+// signatures are over a sha256 digest: ASN.1 for ECDSA, and plain Ed25519 of the digest
+const (
+	ALGORITHM_ED25519 string = "ed25519"
+	ALGORITHM_P256    string = "p256"
+	ALGORITHM_P384    string = "p384"
+
+	DEFAULT_ALGORITHM string = ALGORITHM_P384
+)
+
+const (
+	DIGEST_SIZE     int   = sha256.Size // signers sign sha256 digests
+	PUBKEY_MAX_SIZE uint8 = 255         // validator keys are length-prefixed with a single byte in blocks
+)
+
+var ErrUnsupportedKey = errors.New("unsupported key algorithm")
+
+// the supported algorithms, in the order they are listed to users
+var ALGORITHMS = []string{ALGORITHM_ED25519, ALGORITHM_P256, ALGORITHM_P384}
+
+// generates a private key for the named algorithm
+func GenerateKey(algorithm string) (crypto.Signer, error) {
+	switch algorithm {
+	case ALGORITHM_ED25519:
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		return privateKey, err
+	case ALGORITHM_P256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case ALGORITHM_P384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	}
+	return nil, fmt.Errorf("%w %q, expected one of %v", ErrUnsupportedKey, algorithm, ALGORITHMS)
+}
+
+// returns the name of a public key's algorithm, or ErrUnsupportedKey
+func KeyAlgorithm(publicKey crypto.PublicKey) (string, error) {
+	switch key := publicKey.(type) {
+	case ed25519.PublicKey:
+		if len(key) == ed25519.PublicKeySize {
+			return ALGORITHM_ED25519, nil
+		}
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return ALGORITHM_P256, nil
+		case elliptic.P384():
+			return ALGORITHM_P384, nil
+		}
+	}
+	return "", ErrUnsupportedKey
+}
+
+// parses a PKIX-encoded public key, checking that its algorithm is supported
+func ParsePublicKey(pubBytes []byte) (crypto.PublicKey, error) {
+	if len(pubBytes) == 0 || len(pubBytes) > int(PUBKEY_MAX_SIZE) {
+		return nil, fmt.Errorf("public key has an invalid length (%d)", len(pubBytes))
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(pubBytes)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := KeyAlgorithm(publicKey); err != nil {
+		return nil, err
+	}
+	return publicKey, nil
+}
+
+// signs a digest with a private key of any supported algorithm
+func SignDigest(privateKey crypto.Signer, digest []byte) ([]byte, error) {
+	if len(digest) != DIGEST_SIZE {
+		return nil, fmt.Errorf("digest must be %d bytes", DIGEST_SIZE)
+	}
+	if _, err := KeyAlgorithm(privateKey.Public()); err != nil {
+		return nil, err
+	}
+	switch key := privateKey.(type) {
+	case ed25519.PrivateKey:
+		return ed25519.Sign(key, digest), nil
+	case *ecdsa.PrivateKey:
+		return ecdsa.SignASN1(rand.Reader, key, digest)
+	}
+	return nil, ErrUnsupportedKey
+}
+
+// checks a signature of hash by the PKIX-encoded public key
+// returns an error, rather than panicking, for keys of unsupported or unknown algorithms
+func VerifySignature(pubBytes []byte, hash []byte, sig []byte) error {
+	publicKey, err := ParsePublicKey(pubBytes)
+	if err != nil {
+		return err
+	}
+	valid := false
+	switch key := publicKey.(type) {
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(key, hash, sig)
+	case *ecdsa.PublicKey:
+		valid = ecdsa.VerifyASN1(key, hash, sig)
+	}
+	if !valid {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
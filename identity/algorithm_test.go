@@ -0,0 +1,67 @@
+package identity
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"slices"
+	"testing"
+)
+
+// creates an in-memory identity using the named algorithm
+func newTestIdentity(t *testing.T, algorithm string) Identity {
+	id, err := Generate(algorithm, algorithm)
+	if err != nil {
+		t.Fatalf("error generating %s key (%s)", algorithm, err)
+	}
+	return id
+}
+
+func TestAlgorithms(t *testing.T) {
+	digest := make([]byte, DIGEST_SIZE)
+	for _, algorithm := range ALGORITHMS {
+		id := newTestIdentity(t, algorithm)
+		sig, err := id.Sign(digest)
+		if err != nil {
+			t.Errorf("error signing with %s (%s)", algorithm, err)
+			continue
+		}
+		if err := VerifySignature(id.GetPubBytes(), digest, sig); err != nil {
+			t.Errorf("%s signature didn't verify (%s)", algorithm, err)
+		}
+		if err := ValidValidatorKey(id.GetPubBytes()); err != nil {
+			t.Errorf("%s key isn't a valid validator (%s)", algorithm, err)
+		}
+
+		// a key of one algorithm doesn't verify another's signatures
+		other := newTestIdentity(t, ALGORITHMS[(slices.Index(ALGORITHMS, algorithm)+1)%len(ALGORITHMS)])
+		if err := VerifySignature(other.GetPubBytes(), digest, sig); err == nil {
+			t.Errorf("%s signature verified with the wrong key", algorithm)
+		}
+	}
+
+	if _, err := GenerateKey("p521"); err == nil {
+		t.Errorf("key generated for an unsupported algorithm")
+	}
+}
+
+func TestAlgorithmsUnsupportedKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("error generating rsa key (%s)", err)
+	}
+	rsaPub, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	digest := make([]byte, DIGEST_SIZE)
+
+	// none of these may panic
+	for _, pub := range [][]byte{rsaPub, nil, []byte("not a key"), make([]byte, 300)} {
+		if err := VerifySignature(pub, digest, []byte("signature")); err == nil {
+			t.Errorf("signature verified with an unsupported key")
+		}
+	}
+	rsaId := Identity{prvKey: rsaKey, pubKey: &rsaKey.PublicKey}
+	if _, err := rsaId.Sign(digest); err == nil {
+		t.Errorf("signed with an unsupported key")
+	}
+
+}
@@ -0,0 +1,243 @@
+// Package identity manages the keys validators sign with: keystore identities, remote signers and multisig policies.
+package identity
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+)
+
+// the directory of the keystore, relative to the root of a data directory
+const KEYS_DIR string = "keys"
+
+// a keystore holds the keys of local identities in the keys directory of a data directory
+type Keystore struct {
+	dir string
+}
+
+// returns the keystore of the data directory dir
+func NewKeystore(dir string) Keystore {
+	return Keystore{dir: path.Join(dir, KEYS_DIR)}
+}
+
+// a signer holds a validator's private key, which may live outside this process
+// the public key is PKIX-encoded and digests are sha256 hashes
+type Signer interface {
+	GetPubBytes() []byte
+	Sign(digest []byte) ([]byte, error)
+}
+
+// an identity from the local keystore, with its private key in memory
+type Identity struct {
+	label     string
+	prvKey    crypto.Signer
+	pubKey    crypto.PublicKey
+	encrypted bool
+}
+
+// generates an identity with a key for the named algorithm, without saving it to the keystore
+func Generate(label string, algorithm string) (id Identity, err error) {
+	privateKey, err := GenerateKey(algorithm)
+	if err != nil {
+		return id, err
+	}
+	return Identity{label: label, prvKey: privateKey, pubKey: privateKey.Public()}, nil
+}
+
+// returns the label of the identity in the keystore
+func (id Identity) Label() string {
+	return id.label
+}
+
+// reports whether the identity's private key is stored encrypted in the keystore
+// keys written by older versions aren't, until they are given a passphrase
+func (id Identity) Encrypted() bool {
+	return id.encrypted
+}
+
+// returns the identity's public key
+func (id Identity) Public() crypto.PublicKey {
+	return id.pubKey
+}
+
+func (id Identity) GetPubBytes() []byte {
+	pubBytes, err := x509.MarshalPKIXPublicKey(id.pubKey)
+	if err != nil {
+		panic(err)
+	}
+	return pubBytes
+}
+
+// signs a hash with the identity's private key
+func (id Identity) Sign(hash []byte) ([]byte, error) {
+	return SignDigest(id.prvKey, hash)
+}
+
+// returns the path of an identity's public key file
+func (ks Keystore) publicKeyPath(label string) string {
+	return path.Join(ks.dir, label+"_pub.pem")
+}
+
+// returns the path of an identity's encrypted private key file
+func (ks Keystore) privateKeyPath(label string) string {
+	return path.Join(ks.dir, label+"_prv.pem")
+}
+
+func encodePub(publicKey crypto.PublicKey) string {
+	x509EncodedPub, _ := x509.MarshalPKIXPublicKey(publicKey)
+	pemEncodedPub := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: x509EncodedPub})
+	return string(pemEncodedPub)
+}
+
+func decodePub(pemEncodedPub string) (crypto.PublicKey, error) {
+	blockPub, _ := pem.Decode([]byte(pemEncodedPub))
+	if blockPub == nil {
+		return nil, errors.New("public key file isn't PEM-encoded")
+	}
+	return ParsePublicKey(blockPub.Bytes)
+}
+
+// identity labels name key files, so they are limited to the same characters as chain labels
+func ValidIdentityLabel(label string) bool {
+	return ValidLabel(label)
+}
+
+// returns true if the keystore has keys for the identity
+func (ks Keystore) IdentityExists(label string) bool {
+	_, err := os.Stat(ks.publicKeyPath(label))
+	return err == nil
+}
+
+// generates a key pair using the named algorithm for a new identity
+// the private key is encrypted with passphrase
+func (ks Keystore) GenerateKeys(label string, algorithm string, passphrase []byte) error {
+	privateKey, err := GenerateKey(algorithm)
+	if err != nil {
+		return err
+	}
+	return ks.saveKeys(label, privateKey, passphrase)
+}
+
+// writes an identity's keys to the keystore
+// an existing identity is never overwritten
+func (ks Keystore) saveKeys(label string, privateKey crypto.Signer, passphrase []byte) error {
+	if !ValidIdentityLabel(label) {
+		return fmt.Errorf("invalid identity label %q", label)
+	}
+	publicKey := privateKey.Public()
+
+	// check if keys already exist
+	fname_pub := ks.publicKeyPath(label)
+	fname_prv := ks.privateKeyPath(label)
+	if _, err := os.Stat(fname_pub); !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("a public key already exists for identity %s", label)
+	}
+	if _, err := os.Stat(fname_prv); !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("a private key already exists for identity %s", label)
+	}
+
+	// encode keys to save to file
+	encPub := encodePub(publicKey)
+	encPriv, err := EncryptPrivateKey(privateKey, passphrase)
+	if err != nil {
+		return err
+	}
+
+	// decode keys and check equality to originals
+	priv2, _, err := DecryptPrivateKey(encPriv, func() ([]byte, error) { return passphrase, nil })
+	if err != nil {
+		return err
+	}
+	pub2, err := decodePub(encPub)
+	if err != nil {
+		return err
+	}
+	if !privateKey.(interface{ Equal(crypto.PrivateKey) bool }).Equal(priv2) {
+		return errors.New("private keys do not match")
+	}
+	if !publicKey.(interface{ Equal(crypto.PublicKey) bool }).Equal(pub2) {
+		return errors.New("public keys do not match")
+	}
+
+	// create keys directory if it doesn't exist
+	if err := os.MkdirAll(ks.dir, 0700); err != nil {
+		return err
+	}
+
+	// save keys to files, the private key is only readable by its owner
+	// the private key is written first so a public key file always has a private key
+	err = WritePrivateFile(fname_prv, encPriv)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fname_pub, []byte(encPub), 0644)
+}
+
+// reads an identity's public key from the keystore without decrypting its private key
+func (ks Keystore) LoadPublicKey(label string) ([]byte, error) {
+	encPub, err := os.ReadFile(ks.publicKeyPath(label))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("identity %s doesn't exist, create it with: keys new %s", label, label)
+	}
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := decodePub(string(encPub))
+	if err != nil {
+		return nil, err
+	}
+	return x509.MarshalPKIXPublicKey(publicKey)
+}
+
+// reads an identity from the keystore, decrypting its private key
+func (ks Keystore) OpenIdentity(label string) (id Identity, err error) {
+	pubBytes, err := ks.LoadPublicKey(label)
+	if err != nil {
+		return id, err
+	}
+	publicKey, err := ParsePublicKey(pubBytes)
+	if err != nil {
+		return id, err
+	}
+
+	encPriv, err := os.ReadFile(ks.privateKeyPath(label))
+	if err != nil {
+		return id, err
+	}
+	privateKey, encrypted, err := DecryptPrivateKey(encPriv, identityPassphrase(label))
+	if err != nil {
+		return id, err
+	}
+	// ensure keys match
+	challenge := make([]byte, 16)
+	rand.Reader.Read(challenge)
+	hash := sha256.Sum256(challenge)
+	sig, err := SignDigest(privateKey, hash[:])
+	if err != nil {
+		return id, err
+	}
+	if VerifySignature(pubBytes, hash[:], sig) != nil {
+		return id, fmt.Errorf("the keys for identity %s don't match", label)
+	}
+
+	id.prvKey = privateKey
+	id.pubKey = publicKey
+	id.label = label
+	id.encrypted = encrypted
+	return id, nil
+}
+
+// reads an identity from the keystore, panicking if it can't
+func (ks Keystore) LoadIdentity(label string) Identity {
+	id, err := ks.OpenIdentity(label)
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
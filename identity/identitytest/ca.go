@@ -0,0 +1,133 @@
+package identitytest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"reddchain/identity"
+)
+
+// a certificate authority generated for a test
+// serial numbers are random, so the certificates of different CAs can't be confused in revocation lists
+type CA struct {
+	Cert *x509.Certificate
+	Key  crypto.Signer
+	crls int64 // number of revocation lists issued
+}
+
+// returns a random serial number
+func newSerial(t *testing.T) *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 62))
+	if err != nil {
+		t.Fatalf("error generating serial number (%s)", err)
+	}
+	return serial
+}
+
+// creates a CA whose certificate is signed by parent, or a self-signed root CA if parent is nil
+func newCA(t *testing.T, name string, parent *CA) *CA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating CA key (%s)", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          newSerial(t),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-48 * time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	issuer, issuer_key := template, crypto.Signer(key)
+	if parent != nil {
+		issuer, issuer_key = parent.Cert, parent.Key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, key.Public(), issuer_key)
+	if err != nil {
+		t.Fatalf("error creating CA certificate (%s)", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &CA{Cert: cert, Key: key}
+}
+
+// creates a root CA
+func NewCA(t *testing.T, name string) *CA {
+	return newCA(t, name, nil)
+}
+
+// creates an intermediate CA issued by ca
+func (ca *CA) IssueCA(t *testing.T, name string) *CA {
+	return newCA(t, name, ca)
+}
+
+// returns the CA's certificate, PEM-encoded
+func (ca *CA) PEM() string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Cert.Raw}))
+}
+
+// signs a certificate for pub from template, filling in its serial number
+func (ca *CA) issue(t *testing.T, template *x509.Certificate, pub crypto.PublicKey) *x509.Certificate {
+	template.SerialNumber = newSerial(t)
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Cert, pub, ca.Key)
+	if err != nil {
+		t.Fatalf("error issuing certificate (%s)", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert
+}
+
+// issues a certificate for an identity's key, valid between the given times
+func (ca *CA) Issue(t *testing.T, id identity.Identity, not_before, not_after time.Time) *x509.Certificate {
+	return ca.issue(t, &x509.Certificate{
+		Subject:   pkix.Name{CommonName: id.Label()},
+		NotBefore: not_before,
+		NotAfter:  not_after,
+		KeyUsage:  x509.KeyUsageDigitalSignature,
+	}, id.Public())
+}
+
+// issues a certificate for pub that is valid for an hour, for a tls server at 127.0.0.1 or for a tls client
+func (ca *CA) IssueTLS(t *testing.T, name string, pub crypto.PublicKey, server bool) *x509.Certificate {
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: name},
+		NotBefore:   time.Now().Add(-time.Hour),
+		NotAfter:    time.Now().Add(time.Hour),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if server {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	}
+	return ca.issue(t, template, pub)
+}
+
+// creates a DER revocation list revoking the given certificates
+func (ca *CA) Revoke(t *testing.T, certs ...*x509.Certificate) []byte {
+	var entries []x509.RevocationListEntry
+	for _, c := range certs {
+		entries = append(entries, x509.RevocationListEntry{SerialNumber: c.SerialNumber, RevocationTime: time.Now()})
+	}
+	ca.crls++
+	template := &x509.RevocationList{
+		Number:                    big.NewInt(ca.crls),
+		ThisUpdate:                time.Now(),
+		NextUpdate:                time.Now().Add(24 * time.Hour),
+		RevokedCertificateEntries: entries,
+	}
+	crl, err := x509.CreateRevocationList(rand.Reader, template, ca.Cert, ca.Key)
+	if err != nil {
+		t.Fatalf("error creating revocation list (%s)", err)
+	}
+	return crl
+}
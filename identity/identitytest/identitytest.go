@@ -0,0 +1,38 @@
+// Package identitytest provides in-memory identities for the tests of other packages.
+package identitytest
+
+import (
+	"sync"
+	"testing"
+
+	"reddchain/identity"
+)
+
+// identities shared by the tests of a package, by label
+var identities = make(map[string]identity.Identity)
+var identities_lock sync.Mutex
+
+// returns the test identity with the given label, generating it the first time it's used
+func Identity(label string) identity.Identity {
+	identities_lock.Lock()
+	defer identities_lock.Unlock()
+	id, ok := identities[label]
+	if !ok {
+		var err error
+		id, err = identity.Generate(label, identity.DEFAULT_ALGORITHM)
+		if err != nil {
+			panic(err)
+		}
+		identities[label] = id
+	}
+	return id
+}
+
+// creates a new identity using the named algorithm
+func NewIdentity(t *testing.T, algorithm string) identity.Identity {
+	id, err := identity.Generate(algorithm, algorithm)
+	if err != nil {
+		t.Fatalf("error generating %s key (%s)", algorithm, err)
+	}
+	return id
+}
@@ -0,0 +1,173 @@
+package identity
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"os"
+	"testing"
+)
+
+// test identities are encrypted with a fixed passphrase so tests never prompt
+func TestMain(m *testing.M) {
+	os.Setenv(PASSPHRASE_ENV, "test passphrase")
+	os.Exit(m.Run())
+}
+
+func TestKeystoreEncryption(t *testing.T) {
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	passphrase := func(p string) func() ([]byte, error) {
+		return func() ([]byte, error) { return []byte(p), nil }
+	}
+
+	enc, err := EncryptPrivateKey(privateKey, []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("error encrypting key (%s)", err)
+	}
+	dec, encrypted, err := DecryptPrivateKey(enc, passphrase("correct horse"))
+	if err != nil || !encrypted || !privateKey.Equal(dec) {
+		t.Fatalf("key didn't decrypt to the original (%v)", err)
+	}
+	if _, _, err := DecryptPrivateKey(enc, passphrase("battery staple")); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("key decrypted with the wrong passphrase (%v)", err)
+	}
+	if _, err := EncryptPrivateKey(privateKey, nil); err == nil {
+		t.Errorf("key was encrypted with an empty passphrase")
+	}
+
+	// keys written under the old label, which is sealed with the key, still decrypt
+	block, _ := pem.Decode(enc)
+	if block.Type != ENCRYPTED_KEY_TYPE {
+		t.Errorf("key was encrypted as %s", block.Type)
+	}
+	salt, _ := hex.DecodeString(block.Headers["Salt"])
+	nonce, _ := hex.DecodeString(block.Headers["Nonce"])
+	key, _ := deriveKeyEncryptionKey([]byte("correct horse"), salt, SCRYPT_N, SCRYPT_R, SCRYPT_P)
+	aead, _ := newKeyCipher(key)
+	der, _ := x509.MarshalECPrivateKey(privateKey)
+	legacy := &pem.Block{Type: LEGACY_ENCRYPTED_KEY_TYPE, Headers: block.Headers, Bytes: aead.Seal(nil, nonce, der, []byte(LEGACY_ENCRYPTED_KEY_TYPE))}
+	if dec, _, err := DecryptPrivateKey(pem.EncodeToMemory(legacy), passphrase("correct horse")); err != nil || !privateKey.Equal(dec) {
+		t.Errorf("key with the old label didn't decrypt (%v)", err)
+	}
+
+	// a modified ciphertext fails authentication
+	block.Bytes[0] ^= 0xff
+	if _, _, err := DecryptPrivateKey(pem.EncodeToMemory(block), passphrase("correct horse")); err == nil {
+		t.Errorf("tampered key was decrypted")
+	}
+}
+
+func TestKeystoreChangePassphrase(t *testing.T) {
+	label := "passphrase-test"
+	ks := NewKeystore(t.TempDir())
+	if err := ks.GenerateKeys(label, DEFAULT_ALGORITHM, []byte("test passphrase")); err != nil {
+		t.Fatalf("error generating keys (%s)", err)
+	}
+	id := ks.LoadIdentity(label)
+	if !id.Encrypted() || len(UnencryptedIdentities(id)) != 0 {
+		t.Errorf("new identity isn't reported as encrypted")
+	}
+
+	// keys written unencrypted by older versions are reported, and encrypted by a passphrase change
+	der, _ := x509.MarshalPKCS8PrivateKey(id.prvKey)
+	if err := WritePrivateFile(ks.privateKeyPath(label), pem.EncodeToMemory(&pem.Block{Type: PLAINTEXT_KEY_TYPE, Bytes: der})); err != nil {
+		t.Fatalf("error writing unencrypted key (%s)", err)
+	}
+	if plain := ks.LoadIdentity(label); plain.Encrypted() || len(UnencryptedIdentities(plain)) != 1 {
+		t.Errorf("unencrypted identity isn't reported")
+	}
+
+	info, err := os.Stat(ks.privateKeyPath(label))
+	if err != nil {
+		t.Fatalf("error reading private key file (%s)", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("private key file has permissions %o", info.Mode().Perm())
+	}
+
+	if err := ks.ChangePassphrase(label, []byte("new passphrase")); err != nil {
+		t.Fatalf("error changing passphrase (%s)", err)
+	}
+	enc, err := os.ReadFile(ks.privateKeyPath(label))
+	if err != nil {
+		t.Fatalf("error reading private key file (%s)", err)
+	}
+	if _, _, err := DecryptPrivateKey(enc, identityPassphrase(label)); err == nil {
+		t.Errorf("old passphrase still decrypts the key")
+	}
+	key, _, err := DecryptPrivateKey(enc, func() ([]byte, error) { return []byte("new passphrase"), nil })
+	if err != nil || !id.prvKey.(*ecdsa.PrivateKey).Equal(key) {
+		t.Errorf("new passphrase doesn't decrypt the key (%v)", err)
+	}
+}
+
+func TestKeystoreImportExport(t *testing.T) {
+	label := "import-test"
+	ks := NewKeystore(t.TempDir())
+	if _, err := ks.OpenIdentity(label); err == nil {
+		t.Fatalf("missing identity was loaded")
+	}
+	if ks.IdentityExists(label) {
+		t.Fatalf("loading a missing identity created it")
+	}
+
+	// import a standard PKCS#8 key
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(privateKey)
+	pkcs8 := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := ks.ImportIdentity(label, pkcs8, []byte("test passphrase")); err != nil {
+		t.Fatalf("error importing key (%s)", err)
+	}
+	if err := ks.ImportIdentity(label, pkcs8, []byte("test passphrase")); err == nil {
+		t.Errorf("import overwrote an existing identity")
+	}
+	id := ks.LoadIdentity(label)
+	if !privateKey.Equal(id.prvKey) {
+		t.Errorf("imported identity has a different key")
+	}
+
+	labels, err := ks.ListIdentities()
+	if err != nil {
+		t.Fatalf("error listing identities (%s)", err)
+	}
+	found := false
+	for _, l := range labels {
+		found = found || l == label
+	}
+	if !found {
+		t.Errorf("imported identity isn't listed (%v)", labels)
+	}
+
+	exported, err := ks.ExportIdentity(label, false)
+	if err != nil {
+		t.Fatalf("error exporting key (%s)", err)
+	}
+	if !bytes.Equal(exported, pkcs8) {
+		t.Errorf("exported key doesn't match the imported key")
+	}
+	pub, err := ks.ExportIdentity(label, true)
+	if err != nil || !bytes.Contains(pub, []byte("PUBLIC KEY")) {
+		t.Errorf("error exporting public key (%v)", err)
+	}
+
+	other, _ := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	der, _ = x509.MarshalPKCS8PrivateKey(other)
+	if err := ks.ImportIdentity("import-test-p521", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), []byte("test passphrase")); err == nil {
+		t.Errorf("key on an unsupported curve was imported")
+	}
+
+	if err := ks.DeleteIdentity(label); err != nil {
+		t.Fatalf("error deleting identity (%s)", err)
+	}
+	if ks.IdentityExists(label) {
+		t.Errorf("deleted identity still exists")
+	}
+	if len(Fingerprint(id.GetPubBytes())) != 2*FINGERPRINT_SIZE {
+		t.Errorf("fingerprint has the wrong length")
+	}
+}
@@ -0,0 +1,329 @@
+package identity
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// a multisig validator is a set of N public keys, any M of which must sign its blocks
+// the validator is identified by MULTISIG_ID_PREFIX followed by the sha256 of its policy's encoding,
+// which can't be mistaken for a PKIX public key since those always start with 0x30
+// the policy is registered on-chain with a Multisig transaction before allowance can be delegated to it
+//
+// policy encoding:
+//
+//	threshold   1 byte    M
+//	count       1 byte    N
+//	keys        N times a 1 byte length followed by a PKIX public key, sorted and distinct
+//
+// a multisig block's signature is a multisignature:
+//
+//	policy_len  2 bytes   length of the policy
+//	policy      variable
+//	count       1 byte    number of signatures
+//	signatures  count times a 1 byte key index, a 1 byte length and the signature, in increasing index order
+const (
+	MULTISIG_ID_PREFIX     byte   = 'M'
+	MULTISIG_ID_SIZE       int    = 1 + DIGEST_SIZE
+	MULTISIG_MAX_KEYS      uint8  = 16
+	MULTISIG_SIGNER_PREFIX string = "multisig:" // identity arguments of the form multisig:<policy_file>=<signer>,<signer>...
+)
+
+type MultisigPolicy struct {
+	threshold uint8
+	keys      [][]byte // PKIX public keys, sorted
+}
+
+// creates a policy requiring threshold of the keys to sign
+func NewMultisigPolicy(threshold uint8, keys [][]byte) (policy MultisigPolicy, err error) {
+	policy.threshold = threshold
+	for _, k := range keys {
+		policy.keys = append(policy.keys, append([]byte(nil), k...))
+	}
+	sort.Slice(policy.keys, func(i, j int) bool { return bytes.Compare(policy.keys[i], policy.keys[j]) < 0 })
+	return policy, policy.Validate()
+}
+
+// checks that the policy is well formed
+func (policy *MultisigPolicy) Validate() error {
+	n := len(policy.keys)
+	if n == 0 || n > int(MULTISIG_MAX_KEYS) {
+		return fmt.Errorf("a multisig validator must have between 1 and %d keys", MULTISIG_MAX_KEYS)
+	}
+	if policy.threshold == 0 || int(policy.threshold) > n {
+		return fmt.Errorf("threshold %d is not between 1 and %d", policy.threshold, n)
+	}
+	for i, k := range policy.keys {
+		if _, err := ParsePublicKey(k); err != nil {
+			return fmt.Errorf("multisig key %d: %w", i, err)
+		}
+		if i > 0 && bytes.Compare(policy.keys[i-1], k) >= 0 {
+			return errors.New("multisig keys must be sorted and distinct")
+		}
+	}
+	return nil
+}
+
+func (policy *MultisigPolicy) Marshal() (d []byte) {
+	d = append(d, policy.threshold, uint8(len(policy.keys)))
+	for _, k := range policy.keys {
+		d = append(d, uint8(len(k)))
+		d = append(d, k...)
+	}
+	return d
+}
+
+func ParseMultisigPolicy(data []byte) (policy MultisigPolicy, err error) {
+	if len(data) < 2 {
+		return policy, errors.New("multisig policy too short")
+	}
+	policy.threshold = data[0]
+	count := int(data[1])
+	data = data[2:]
+	for i := 0; i < count; i++ {
+		if len(data) < 1 || len(data) < 1+int(data[0]) {
+			return policy, errors.New("multisig policy too short")
+		}
+		policy.keys = append(policy.keys, data[1:1+int(data[0])])
+		data = data[1+int(data[0]):]
+	}
+	if len(data) != 0 {
+		return policy, errors.New("multisig policy too long")
+	}
+	return policy, policy.Validate()
+}
+
+// writes the hex-encoded policy to a file
+func (policy *MultisigPolicy) Save(fname string) error {
+	return os.WriteFile(fname, []byte(hex.EncodeToString(policy.Marshal())+"\n"), 0644)
+}
+
+// reads a policy written by Save
+func ReadMultisigPolicy(fname string) (policy MultisigPolicy, err error) {
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return policy, err
+	}
+	encoded, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return policy, fmt.Errorf("%s isn't a multisig policy file", fname)
+	}
+	return ParseMultisigPolicy(encoded)
+}
+
+// returns how many of the policy's keys must sign
+func (policy *MultisigPolicy) Threshold() int {
+	return int(policy.threshold)
+}
+
+// returns the policy's public keys, sorted
+func (policy *MultisigPolicy) Keys() [][]byte {
+	return policy.keys
+}
+
+// returns the validator identifier of the policy
+func (policy *MultisigPolicy) ID() []byte {
+	hash := sha256.Sum256(policy.Marshal())
+	return append([]byte{MULTISIG_ID_PREFIX}, hash[:]...)
+}
+
+// returns true if the validator is a multisig identifier rather than a public key
+func IsMultisigID(validator []byte) bool {
+	return len(validator) == MULTISIG_ID_SIZE && validator[0] == MULTISIG_ID_PREFIX
+}
+
+// checks that validator is a supported public key or a multisig identifier
+func ValidValidatorKey(validator []byte) error {
+	if IsMultisigID(validator) {
+		return nil
+	}
+	_, err := ParsePublicKey(validator)
+	return err
+}
+
+// one signature in a multisignature
+type multisig_signature_t struct {
+	index     uint8 // index of the key in the policy
+	signature []byte
+}
+
+func marshalMultisignature(policy MultisigPolicy, sigs []multisig_signature_t) []byte {
+	encoded := policy.Marshal()
+	d := binary.BigEndian.AppendUint16(nil, uint16(len(encoded)))
+	d = append(d, encoded...)
+	d = append(d, uint8(len(sigs)))
+	for _, s := range sigs {
+		d = append(d, s.index, uint8(len(s.signature)))
+		d = append(d, s.signature...)
+	}
+	return d
+}
+
+func parseMultisignature(data []byte) (policy MultisigPolicy, sigs []multisig_signature_t, err error) {
+	if len(data) < 2 {
+		return policy, nil, errors.New("multisignature too short")
+	}
+	n := int(binary.BigEndian.Uint16(data))
+	if len(data) < 2+n+1 {
+		return policy, nil, errors.New("multisignature too short")
+	}
+	policy, err = ParseMultisigPolicy(data[2 : 2+n])
+	if err != nil {
+		return policy, nil, err
+	}
+	count := int(data[2+n])
+	data = data[2+n+1:]
+	for i := 0; i < count; i++ {
+		if len(data) < 2 || len(data) < 2+int(data[1]) {
+			return policy, nil, errors.New("multisignature too short")
+		}
+		sigs = append(sigs, multisig_signature_t{index: data[0], signature: data[2 : 2+int(data[1])]})
+		data = data[2+int(data[1]):]
+	}
+	if len(data) != 0 {
+		return policy, nil, errors.New("multisignature too long")
+	}
+	return policy, sigs, nil
+}
+
+// checks a multisignature of hash by the multisig validator with the given identifier
+func VerifyMultisig(id []byte, hash []byte, multisignature []byte) error {
+	policy, sigs, err := parseMultisignature(multisignature)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(policy.ID(), id) {
+		return errors.New("multisignature is for a different validator")
+	}
+	for i, s := range sigs {
+		if int(s.index) >= len(policy.keys) {
+			return fmt.Errorf("multisignature refers to key %d of %d", s.index, len(policy.keys))
+		}
+		if i > 0 && sigs[i-1].index >= s.index {
+			return errors.New("multisignature indexes must be increasing")
+		}
+		if err := VerifySignature(policy.keys[s.index], hash, s.signature); err != nil {
+			return fmt.Errorf("multisig key %d: %w", s.index, err)
+		}
+	}
+	if len(sigs) < int(policy.threshold) {
+		return fmt.Errorf("multisignature has %d of the %d signatures required", len(sigs), policy.threshold)
+	}
+	return nil
+}
+
+// checks a block signature by a validator, which may be a public key or a multisig identifier
+func VerifyValidatorSignature(validator []byte, hash []byte, sig []byte) error {
+	if IsMultisigID(validator) {
+		return VerifyMultisig(validator, hash, sig)
+	}
+	return VerifySignature(validator, hash, sig)
+}
+
+// returns the keys that signed a block signature by a validator
+// for a multisig validator, those are the keys with signatures in the multisignature
+func SigningKeys(validator []byte, sig []byte) ([][]byte, error) {
+	if !IsMultisigID(validator) {
+		return [][]byte{validator}, nil
+	}
+	policy, sigs, err := parseMultisignature(sig)
+	if err != nil {
+		return nil, err
+	}
+	var keys [][]byte
+	for _, s := range sigs {
+		if int(s.index) >= len(policy.keys) {
+			return nil, fmt.Errorf("multisignature refers to key %d of %d", s.index, len(policy.keys))
+		}
+		keys = append(keys, policy.keys[s.index])
+	}
+	return keys, nil
+}
+
+// a signer for a multisig validator that collects signatures from the key holders it has
+// signers may be local identities or remote signer daemons
+type MultisigSigner struct {
+	policy  MultisigPolicy
+	signers []Signer
+}
+
+// creates a signer for the policy from the signers of some of its keys
+// at least the policy's threshold of signers must be given
+func NewMultisigSigner(policy MultisigPolicy, signers []Signer) (*MultisigSigner, error) {
+	ms := &MultisigSigner{policy: policy}
+	for _, s := range signers {
+		if ms.keyIndex(s.GetPubBytes()) < 0 {
+			return nil, fmt.Errorf("key %s isn't part of the multisig validator", Fingerprint(s.GetPubBytes()))
+		}
+		ms.signers = append(ms.signers, s)
+	}
+	if len(ms.signers) < int(policy.threshold) {
+		return nil, fmt.Errorf("%d signers given, %d are required", len(ms.signers), policy.threshold)
+	}
+	return ms, nil
+}
+
+// returns the index of a key in the policy, or -1
+func (ms *MultisigSigner) keyIndex(pub []byte) int {
+	for i, k := range ms.policy.keys {
+		if bytes.Equal(k, pub) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (ms *MultisigSigner) GetPubBytes() []byte {
+	return ms.policy.ID()
+}
+
+// collects signatures from the key holders until the threshold is met
+func (ms *MultisigSigner) Sign(digest []byte) ([]byte, error) {
+	var sigs []multisig_signature_t
+	for _, s := range ms.signers {
+		if len(sigs) == int(ms.policy.threshold) {
+			break
+		}
+		sig, err := s.Sign(digest)
+		if err != nil {
+			return nil, fmt.Errorf("signer %s: %w", Fingerprint(s.GetPubBytes()), err)
+		}
+		sigs = append(sigs, multisig_signature_t{index: uint8(ms.keyIndex(s.GetPubBytes())), signature: sig})
+	}
+	sort.Slice(sigs, func(i, j int) bool { return sigs[i].index < sigs[j].index })
+	for i := 1; i < len(sigs); i++ {
+		if sigs[i-1].index == sigs[i].index {
+			return nil, errors.New("the same key was given twice")
+		}
+	}
+	return marshalMultisignature(ms.policy, sigs), nil
+}
+
+// opens a multisig signer from an argument of the form <policy_file>=<signer>,<signer>...
+// each signer is a keystore identity or a remote signer, as accepted by OpenSigner
+func (ks Keystore) openMultisigSigner(arg string) (*MultisigSigner, error) {
+	fname, names, ok := strings.Cut(arg, "=")
+	if !ok {
+		return nil, fmt.Errorf("expected %s<policy_file>=<signer>,<signer>...", MULTISIG_SIGNER_PREFIX)
+	}
+	policy, err := ReadMultisigPolicy(fname)
+	if err != nil {
+		return nil, err
+	}
+	var signers []Signer
+	for _, name := range strings.Split(names, ",") {
+		signer, err := ks.OpenSigner(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		signers = append(signers, signer)
+	}
+	return NewMultisigSigner(policy, signers)
+}
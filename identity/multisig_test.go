@@ -0,0 +1,101 @@
+package identity
+
+import (
+	"bytes"
+	"path"
+	"testing"
+)
+
+func TestMultisigPolicy(t *testing.T) {
+	a := newTestIdentity(t, ALGORITHM_ED25519)
+	b := newTestIdentity(t, ALGORITHM_P256)
+
+	policy, err := NewMultisigPolicy(2, [][]byte{a.GetPubBytes(), b.GetPubBytes()})
+	if err != nil {
+		t.Fatalf("error creating policy (%s)", err)
+	}
+	parsed, err := ParseMultisigPolicy(policy.Marshal())
+	if err != nil || !bytes.Equal(parsed.ID(), policy.ID()) {
+		t.Errorf("policy changed after parsing (%v)", err)
+	}
+	if !IsMultisigID(policy.ID()) || IsMultisigID(a.GetPubBytes()) {
+		t.Errorf("multisig identifiers aren't distinguished from public keys")
+	}
+
+	fname := path.Join(t.TempDir(), "policy")
+	if err := policy.Save(fname); err != nil {
+		t.Fatalf("error saving policy (%s)", err)
+	}
+	loaded, err := ReadMultisigPolicy(fname)
+	if err != nil || !bytes.Equal(loaded.ID(), policy.ID()) {
+		t.Errorf("policy changed after saving (%v)", err)
+	}
+
+	if _, err := NewMultisigPolicy(3, [][]byte{a.GetPubBytes(), b.GetPubBytes()}); err == nil {
+		t.Errorf("policy with a threshold above its key count was accepted")
+	}
+	if _, err := NewMultisigPolicy(1, [][]byte{a.GetPubBytes(), a.GetPubBytes()}); err == nil {
+		t.Errorf("policy with a duplicate key was accepted")
+	}
+}
+
+func TestMultisigSigner(t *testing.T) {
+	officers := []Identity{
+		newTestIdentity(t, ALGORITHM_ED25519),
+		newTestIdentity(t, ALGORITHM_P256),
+		newTestIdentity(t, ALGORITHM_P384),
+	}
+	var keys [][]byte
+	for _, o := range officers {
+		keys = append(keys, o.GetPubBytes())
+	}
+	policy, err := NewMultisigPolicy(2, keys)
+	if err != nil {
+		t.Fatalf("error creating policy (%s)", err)
+	}
+
+	// two of the three officers sign, one of them through a signer daemon
+	remote, err := DialSigner(startTestSignerDaemon(t, officers[2]))
+	if err != nil {
+		t.Fatalf("error connecting to signer (%s)", err)
+	}
+	signer, err := NewMultisigSigner(policy, []Signer{officers[0], remote})
+	if err != nil {
+		t.Fatalf("error creating multisig signer (%s)", err)
+	}
+	if !bytes.Equal(signer.GetPubBytes(), policy.ID()) {
+		t.Errorf("multisig signer doesn't sign as its policy")
+	}
+	digest := make([]byte, DIGEST_SIZE)
+	multisignature, err := signer.Sign(digest)
+	if err != nil {
+		t.Fatalf("error signing (%s)", err)
+	}
+	if err := VerifyValidatorSignature(policy.ID(), digest, multisignature); err != nil {
+		t.Errorf("multisignature didn't verify (%s)", err)
+	}
+	signing_keys, err := SigningKeys(policy.ID(), multisignature)
+	if err != nil || len(signing_keys) != 2 || !bytes.Equal(signing_keys[0], keys[0]) || !bytes.Equal(signing_keys[1], keys[2]) {
+		t.Errorf("multisignature reported the wrong signing keys (%v)", err)
+	}
+
+	// a single officer can't meet the threshold
+	if _, err := NewMultisigSigner(policy, []Signer{officers[0]}); err == nil {
+		t.Errorf("multisig signer was created with too few signers")
+	}
+	sig, _ := officers[0].Sign(digest)
+	single := marshalMultisignature(policy, []multisig_signature_t{{index: uint8(signer.keyIndex(officers[0].GetPubBytes())), signature: sig}})
+	if err := VerifyValidatorSignature(policy.ID(), digest, single); err == nil {
+		t.Errorf("multisignature below the threshold was accepted")
+	}
+	doubled := marshalMultisignature(policy, []multisig_signature_t{{index: 0, signature: sig}, {index: 0, signature: sig}})
+	if err := VerifyValidatorSignature(policy.ID(), digest, doubled); err == nil {
+		t.Errorf("multisignature counting one key twice was accepted")
+	}
+
+	// an officer outside the policy can't sign
+	outsider := newTestIdentity(t, ALGORITHM_ED25519)
+	if _, err := NewMultisigSigner(policy, []Signer{officers[0], outsider}); err == nil {
+		t.Errorf("multisig signer accepted a key outside the policy")
+	}
+}
@@ -0,0 +1,58 @@
+package identity
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// validators are shown by a short fingerprint of their key instead of the full hex encoding
+
+const (
+	FINGERPRINT_SIZE int = 8 // bytes of the key hash shown as a fingerprint
+	LABEL_MAX_SIZE   int = 64
+	ALIAS_MAX_SIZE   int = 64
+)
+
+// returns true if label can be used to name a chain or an identity
+// labels are used in file names and urls, so only lowercase letters, digits, '-' and '_' are allowed
+func ValidLabel(label string) bool {
+	if len(label) == 0 || len(label) > LABEL_MAX_SIZE {
+		return false
+	}
+	for _, c := range label {
+		if !(c >= 'a' && c <= 'z') && !(c >= '0' && c <= '9') && c != '-' && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// returns a short fingerprint of a validator key for display
+// the key may be a PKIX public key or a multisig identifier
+func Fingerprint(pubBytes []byte) string {
+	hash := sha256.Sum256(pubBytes)
+	return hex.EncodeToString(hash[:FINGERPRINT_SIZE])
+}
+
+// returns the fingerprint of a hex-encoded validator key, as used in the validator state
+func FingerprintHex(validator string) string {
+	pubBytes, err := hex.DecodeString(validator)
+	if err != nil {
+		return validator
+	}
+	return Fingerprint(pubBytes)
+}
+
+// checks that an alias can be registered
+// aliases use the same characters as labels, and can't be mistaken for a fingerprint
+func ValidAlias(alias string) error {
+	if len(alias) > ALIAS_MAX_SIZE || !ValidLabel(alias) {
+		return fmt.Errorf("invalid alias %q, aliases are 1 to %d lowercase letters, digits, '-' or '_'", alias, ALIAS_MAX_SIZE)
+	}
+	if _, err := hex.DecodeString(alias); err == nil && len(alias) == 2*FINGERPRINT_SIZE {
+		return errors.New("an alias can't look like a fingerprint")
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package identity
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// a signer daemon keeps a validator's keys out of the node and client processes
+// it listens on a unix socket and answers one json request per line with one json response per line:
+//
+//	{"method":"pubkey"}                    -> {"pubkey":"<hex PKIX public key>"}
+//	{"method":"sign","digest":"<hex>"}     -> {"signature":"<hex ASN.1 signature>"}
+//
+// failed requests are answered with {"error":"<message>"}
+// the socket is only accessible by its owner, which is what authorizes callers
+
+const (
+	REMOTE_SIGNER_PREFIX  string        = "unix:" // identity arguments with this prefix name a signer socket
+	REMOTE_SIGNER_TIMEOUT time.Duration = 30 * time.Second
+)
+
+type signer_request_t struct {
+	Method string `json:"method"`
+	Digest string `json:"digest,omitempty"`
+}
+
+type signer_response_t struct {
+	PubKey    string `json:"pubkey,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// a signer reached over a unix socket
+type RemoteSigner struct {
+	socket_path string
+	pubBytes    []byte
+}
+
+// answers a single signer request
+func handleSignerRequest(signer Signer, req signer_request_t) (resp signer_response_t) {
+	if req.Method == "pubkey" {
+		resp.PubKey = hex.EncodeToString(signer.GetPubBytes())
+	} else if req.Method == "sign" {
+		digest, err := hex.DecodeString(req.Digest)
+		if err != nil {
+			resp.Error = "invalid digest"
+			return resp
+		}
+		sig, err := signer.Sign(digest)
+		if err != nil {
+			resp.Error = err.Error()
+			return resp
+		}
+		resp.Signature = hex.EncodeToString(sig)
+	} else {
+		resp.Error = fmt.Sprintf("unknown method %q", req.Method)
+	}
+	return resp
+}
+
+// answers requests on a connection until it is closed
+func serveSignerConn(conn net.Conn, signer Signer) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	encoder := json.NewEncoder(conn)
+	for scanner.Scan() {
+		var req signer_request_t
+		var resp signer_response_t
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp.Error = "invalid request"
+		} else {
+			resp = handleSignerRequest(signer, req)
+		}
+		if err := encoder.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+// answers signing requests on l with signer until l is closed
+func ServeSigner(l net.Listener, signer Signer) error {
+	for {
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		go serveSignerConn(conn, signer)
+	}
+}
+
+// listens on a unix socket that only its owner can connect to
+// a stale socket left by a previous daemon is replaced
+func ListenSigner(socket_path string) (net.Listener, error) {
+	if info, err := os.Stat(socket_path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and isn't a socket", socket_path)
+		}
+		os.Remove(socket_path)
+	}
+	l, err := net.Listen("unix", socket_path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(socket_path, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// sends a request to the signer daemon and waits for its response
+func (rs *RemoteSigner) request(req signer_request_t) (resp signer_response_t, err error) {
+	conn, err := net.DialTimeout("unix", rs.socket_path, REMOTE_SIGNER_TIMEOUT)
+	if err != nil {
+		return resp, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(REMOTE_SIGNER_TIMEOUT))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return resp, err
+	}
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return resp, err
+	}
+	if resp.Error != "" {
+		return resp, fmt.Errorf("remote signer: %s", resp.Error)
+	}
+	return resp, nil
+}
+
+// connects to the signer daemon listening on socket_path
+func DialSigner(socket_path string) (*RemoteSigner, error) {
+	rs := &RemoteSigner{socket_path: socket_path}
+	resp, err := rs.request(signer_request_t{Method: "pubkey"})
+	if err != nil {
+		return nil, err
+	}
+	rs.pubBytes, err = hex.DecodeString(resp.PubKey)
+	if err != nil {
+		return nil, errors.New("remote signer returned an invalid public key")
+	}
+	return rs, nil
+}
+
+func (rs *RemoteSigner) GetPubBytes() []byte {
+	return rs.pubBytes
+}
+
+// asks the daemon to sign a digest
+// the signature is checked so a misbehaving daemon can't produce invalid blocks
+func (rs *RemoteSigner) Sign(digest []byte) ([]byte, error) {
+	if len(digest) != DIGEST_SIZE {
+		return nil, fmt.Errorf("digest must be %d bytes", DIGEST_SIZE)
+	}
+	resp, err := rs.request(signer_request_t{Method: "sign", Digest: hex.EncodeToString(digest)})
+	if err != nil {
+		return nil, err
+	}
+	sig, err := hex.DecodeString(resp.Signature)
+	if err != nil {
+		return nil, errors.New("remote signer returned an invalid signature")
+	}
+	if err := VerifySignature(rs.pubBytes, digest, sig); err != nil {
+		return nil, fmt.Errorf("remote signer returned a bad signature (%w)", err)
+	}
+	return sig, nil
+}
+
+// opens the signer named by an identity argument
+// REMOTE_SIGNER_PREFIX followed by a path names a signer daemon's socket,
+// MULTISIG_SIGNER_PREFIX names a multisig policy and the signers of its keys, and anything else is a keystore identity
+func (ks Keystore) OpenSigner(name string) (Signer, error) {
+	if socket_path, ok := strings.CutPrefix(name, REMOTE_SIGNER_PREFIX); ok {
+		return DialSigner(socket_path)
+	}
+	if arg, ok := strings.CutPrefix(name, MULTISIG_SIGNER_PREFIX); ok {
+		return ks.openMultisigSigner(arg)
+	}
+	return ks.OpenIdentity(name)
+}
+
+// returns the labels of the keystore identities a signer signs with whose private keys aren't encrypted
+func UnencryptedIdentities(signer Signer) (labels []string) {
+	switch s := signer.(type) {
+	case Identity:
+		if !s.encrypted {
+			labels = append(labels, s.label)
+		}
+	case *MultisigSigner:
+		for _, member := range s.signers {
+			labels = append(labels, UnencryptedIdentities(member)...)
+		}
+	}
+	return labels
+}
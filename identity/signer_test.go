@@ -0,0 +1,90 @@
+package identity
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"path"
+	"testing"
+)
+
+// an in-memory signer standing in for a signer daemon's key
+// if corrupt is set, it returns signatures that don't verify
+type test_signer_t struct {
+	key     *ecdsa.PrivateKey
+	corrupt bool
+}
+
+func newTestSigner(t *testing.T) *test_signer_t {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key (%s)", err)
+	}
+	return &test_signer_t{key: key}
+}
+
+func (ts *test_signer_t) GetPubBytes() []byte {
+	pubBytes, _ := x509.MarshalPKIXPublicKey(&ts.key.PublicKey)
+	return pubBytes
+}
+
+func (ts *test_signer_t) Sign(digest []byte) ([]byte, error) {
+	sig, err := ecdsa.SignASN1(rand.Reader, ts.key, digest)
+	if ts.corrupt {
+		sig[len(sig)-1] ^= 0xff
+	}
+	return sig, err
+}
+
+// starts a signer daemon for signer on a temporary socket
+func startTestSignerDaemon(t *testing.T, signer Signer) string {
+	socket_path := path.Join(t.TempDir(), "signer.sock")
+	l, err := ListenSigner(socket_path)
+	if err != nil {
+		t.Fatalf("error listening on signer socket (%s)", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go ServeSigner(l, signer)
+	return socket_path
+}
+
+func TestRemoteSigner(t *testing.T) {
+	local := newTestSigner(t)
+	socket_path := startTestSignerDaemon(t, local)
+
+	signer, err := NewKeystore(t.TempDir()).OpenSigner(REMOTE_SIGNER_PREFIX + socket_path)
+	if err != nil {
+		t.Fatalf("error connecting to signer (%s)", err)
+	}
+	if string(signer.GetPubBytes()) != string(local.GetPubBytes()) {
+		t.Fatalf("remote signer reported the wrong public key")
+	}
+
+	digest := make([]byte, DIGEST_SIZE)
+	sig, err := signer.Sign(digest)
+	if err != nil {
+		t.Fatalf("error signing remotely (%s)", err)
+	}
+	if err := VerifySignature(local.GetPubBytes(), digest, sig); err != nil {
+		t.Errorf("remote signature didn't verify (%s)", err)
+	}
+
+	if _, err := signer.Sign([]byte("too short")); err == nil {
+		t.Errorf("remote signer signed a digest of the wrong length")
+	}
+}
+
+func TestRemoteSignerBadSignature(t *testing.T) {
+	local := newTestSigner(t)
+	socket_path := startTestSignerDaemon(t, local)
+	signer, err := DialSigner(socket_path)
+	if err != nil {
+		t.Fatalf("error connecting to signer (%s)", err)
+	}
+
+	local.corrupt = true
+	if _, err := signer.Sign(make([]byte, DIGEST_SIZE)); err == nil {
+		t.Errorf("bad signature from the signer was accepted")
+	}
+}
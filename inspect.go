@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"reddchain/block"
+	"reddchain/chain"
+)
+
+// a block as printed by inspect
+type inspected_block_t struct {
+	Height int `json:"height"`
+	block.Info
+	Alias string `json:"alias,omitempty"`
+}
+
+// a chain as printed by inspect
+type inspected_chain_t struct {
+	Label      string                `json:"label"`
+	Genesis    string                `json:"genesis"`
+	Tip        string                `json:"tip"`
+	Height     int                   `json:"height"`
+	Pruned     int                   `json:"pruned"` // blocks whose payloads have been discarded
+	StateRoot  string                `json:"state_root"`
+	Validators []chain.ValidatorInfo `json:"validators"`
+}
+
+// returns the block named by arg, a block hash or a height
+func findBlock(bc *chain.Blockchain, arg string) (block.Block, int, error) {
+	if height, err := strconv.Atoi(arg); err == nil && len(arg) < 2*int(block.HASH_SIZE) {
+		blk, err := bc.GetBlockAt(height)
+		return blk, height, err
+	}
+	hash, err := hex.DecodeString(arg)
+	if err != nil {
+		return block.Block{}, -1, fmt.Errorf("%s is neither a height nor a block hash", arg)
+	}
+	return bc.GetBlock(hash)
+}
+
+func inspectBlock(bc *chain.Blockchain, blk block.Block, height int) inspected_block_t {
+	return inspected_block_t{
+		Height: height,
+		Info:   blk.Info(),
+		Alias:  bc.GetAlias(blk.GetValidatorString()),
+	}
+}
+
+func inspectChain(bc *chain.Blockchain) inspected_chain_t {
+	info := inspected_chain_t{
+		Label:      bc.Label(),
+		Genesis:    hex.EncodeToString(bc.GetGenesisHash()),
+		Tip:        hex.EncodeToString(bc.GetTipHash()),
+		Height:     bc.Height(),
+		StateRoot:  hex.EncodeToString(bc.GetStateRoot()),
+		Validators: bc.ValidatorInfos(),
+	}
+	for i := 0; i <= bc.Height(); i++ {
+		blk, _ := bc.GetBlockAt(i)
+		if blk.IsPruned() {
+			info.Pruned += 1
+		}
+	}
+	return info
+}
+
+func printInspectedBlock(info inspected_block_t) {
+	validator := info.Fingerprint
+	if info.Alias != "" {
+		validator += " (" + info.Alias + ")"
+	}
+	fmt.Printf("Block %d %s\r\n", info.Height, info.Hash)
+	fmt.Printf("  timestamp:    %s\r\n", time.Unix(info.Timestamp, 0).UTC().Format(time.RFC3339))
+	fmt.Printf("  prev_hash:    %s\r\n", info.PrevHash)
+	fmt.Printf("  state_root:   %s\r\n", info.StateRoot)
+	fmt.Printf("  validator:    %s\r\n", validator)
+	fmt.Printf("  signature:    %d bytes\r\n", len(info.Signature)/2)
+	fmt.Printf("  type:         %s\r\n", info.TxType)
+	fmt.Printf("  payload_hash: %s\r\n", info.PayloadHash)
+	if info.Height == 0 {
+		fmt.Printf("  data:         genesis\r\n")
+	} else if info.Tx == nil {
+		fmt.Printf("  data:         pruned\r\n")
+	} else {
+		fmt.Printf("  data:         %s\r\n", info.Tx.Description)
+	}
+}
+
+func printInspectedChain(info inspected_chain_t) {
+	fmt.Printf("Chain %s\r\n", info.Label)
+	fmt.Printf("  genesis:    %s\r\n", info.Genesis)
+	fmt.Printf("  tip:        %s\r\n", info.Tip)
+	fmt.Printf("  height:     %d\r\n", info.Height)
+	fmt.Printf("  pruned:     %d blocks\r\n", info.Pruned)
+	fmt.Printf("  state_root: %s\r\n", info.StateRoot)
+	fmt.Println("Validators")
+	for _, v := range info.Validators {
+		fmt.Printf("  %-16s %-20s %s\r\n", v.Fingerprint, v.Alias, chain.FormatAllowance(v.Allowance, true))
+	}
+}
+
+// runs the inspect command: inspect <chain> [block] [json]
+// prints the block given by its hash or height, or a summary of the chain
+func inspectCommand() error {
+	if err := checkOsArgs(2); err != nil {
+		return err
+	}
+	as_json := false
+	var block_arg string
+	for _, arg := range os.Args[3:] {
+		if arg == "json" {
+			as_json = true
+		} else if block_arg == "" {
+			block_arg = arg
+		} else {
+			return errors.New("too many arguments")
+		}
+	}
+
+	bc, err := chain.LoadChain(dataDir(), os.Args[2])
+	if err != nil {
+		return fmt.Errorf("loading chain %s: %w", os.Args[2], err)
+	}
+
+	var info any
+	if block_arg == "" {
+		info = inspectChain(&bc)
+	} else {
+		blk, height, err := findBlock(&bc, block_arg)
+		if err != nil {
+			return err
+		}
+		info = inspectBlock(&bc, blk, height)
+	}
+
+	if as_json {
+		data, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	} else if b, ok := info.(inspected_block_t); ok {
+		printInspectedBlock(b)
+	} else {
+		printInspectedChain(info.(inspected_chain_t))
+	}
+	return nil
+}
@@ -1,18 +1,107 @@
 package main
 
 import (
+	"context"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+
+	"reddchain/chain"
+	"reddchain/client"
+	"reddchain/identity"
+	"reddchain/node"
+	"reddchain/transaction"
+)
+
+// every command keeps its data in the directory named by DATA_DIR_ENV, or in node.DEFAULT_DATA_DIR
+const DATA_DIR_ENV string = "REDDCHAIN_DATA"
+
+// commands that talk to a server over https verify it with the CA bundle named by CA_BUNDLE_ENV, or the system's CAs
+// servers requiring mutual tls are given the certificate and key named by CLIENT_CERT_ENV and CLIENT_KEY_ENV
+const (
+	CA_BUNDLE_ENV   string = "REDDCHAIN_CA_BUNDLE"
+	CLIENT_CERT_ENV string = "REDDCHAIN_CLIENT_CERT"
+	CLIENT_KEY_ENV  string = "REDDCHAIN_CLIENT_KEY"
 )
 
+// commands that talk to a server sign their requests with the identity or signer named by AUTH_IDENTITY_ENV, if it's set
+const AUTH_IDENTITY_ENV string = "REDDCHAIN_AUTH_IDENTITY"
+
 func printUsage() {
 	fmt.Println("Permissioned Blockchain")
 	fmt.Println("Please specify a command.")
-	fmt.Println("  serve")
-	fmt.Println("     starts a blockchain server")
-	fmt.Println("  entry <server_url> <identity> <entry>")
+	fmt.Println("  serve [flags] [chain...]")
+	fmt.Println("     starts a blockchain server for each <chain>, or for the " + chain.MAIN_CHAIN_NAME + " chain if none are given")
+	printServeFlags()
+	fmt.Println("  cosign <identity> <draft_file>")
+	fmt.Println("     add the co-signature of <identity> to a draft genesis file or specification, rewriting <draft_file>")
+	fmt.Println("  bootstrap <identity> [chain] [draft_file]")
+	fmt.Println("     sign the genesis block for a new chain, then create the chain from it")
+	fmt.Println("     <chain> defaults to " + chain.MAIN_CHAIN_NAME + ", and the genesis file is saved to " + chain.GENESIS_DIR + " in the data directory")
+	fmt.Println("     <draft_file> must be co-signed by every other genesis validator, otherwise <identity> is the only validator")
+	fmt.Println("  entry <server_url> <identity> <entry> [chain]")
 	fmt.Println("     submit an entry transaction with the data <entry> to the server <server_url> using your <identity>")
+	fmt.Println("  delegate <server_url> <identity> <count> <delegate> [chain]")
+	fmt.Println("     delegate <count> blocks of the allowance of <identity> to <delegate>, then show the allowance left")
+	fmt.Println("     <delegate> is an identity, a PEM public key file, or the fingerprint or alias of a validator")
+	fmt.Println("  blob <server_url> <identity> <file> [chain]")
+	fmt.Println("     upload <file> to the blob store of <server_url> and submit a transaction committing to it")
+	fmt.Println("  fetch <server_url> <block_hash> <file> [chain]")
+	fmt.Println("     download the blob committed to by <block_hash> to <file>, checking it against the chain")
+	fmt.Println("  watch <server_url> [from] [chain]")
+	fmt.Println("     print each block of the chain as the server appends it, starting at height <from> if it's given")
+	fmt.Println("  keys new <identity> [algorithm]")
+	fmt.Println("     generate keys for a new identity, using " + strings.Join(identity.ALGORITHMS, ", ") + " (default " + identity.DEFAULT_ALGORITHM + ")")
+	fmt.Println("  keys list [server_url] [chain]")
+	fmt.Println("     list identities with their fingerprints, and their allowances if <server_url> is given")
+	fmt.Println("  keys show <identity> [server_url] [chain]")
+	fmt.Println("     show the fingerprint and public key of <identity>, and its allowance if <server_url> is given")
+	fmt.Println("  keys import <identity> <pem_file>")
+	fmt.Println("     add an identity from a PKCS#8 or SEC 1 PEM private key")
+	fmt.Println("  keys export <identity> <pem_file> [public]")
+	fmt.Println("     write the unencrypted PKCS#8 private key of <identity>, or only its public key, to <pem_file>")
+	fmt.Println("  keys delete <identity> confirm")
+	fmt.Println("     remove the keys of <identity>")
+	fmt.Println("  signer <identity> <socket_path>")
+	fmt.Println("     sign for <identity> on the unix socket <socket_path>, keeping its keys out of other processes")
+	fmt.Println("     other commands use the signer when given " + identity.REMOTE_SIGNER_PREFIX + "<socket_path> as their <identity>")
+	fmt.Println("  multisig <threshold> <policy_file> <key>...")
+	fmt.Println("     define a validator that needs <threshold> of the <key>s to sign, saving it to <policy_file>")
+	fmt.Println("     each <key> is an identity or a PEM public key file")
+	fmt.Println("  register <server_url> <identity> <policy_file> [chain]")
+	fmt.Println("     register the multisig validator in <policy_file> on the chain so it can be delegated blocks")
+	fmt.Println("     it signs when given " + identity.MULTISIG_SIGNER_PREFIX + "<policy_file>=<identity>,<identity>... as its <identity>")
+	fmt.Println("  alias <server_url> <identity> <alias> [chain]")
+	fmt.Println("     register <alias> as the name of <identity> on the chain, replacing its previous alias")
+	fmt.Println("  certify <server_url> <identity> <cert_file> [chain]")
+	fmt.Println("     register the PEM certificate chain in <cert_file> for <identity> on a certificate-bound chain")
+	fmt.Println("  revoke <server_url> <identity> <crl_file> [chain]")
+	fmt.Println("     submit the revocation list in <crl_file>, signed by a trusted CA, revoking its certificates on the chain")
+	fmt.Println("  passphrase <identity>")
+	fmt.Println("     change the passphrase that encrypts the private key of <identity>")
+	fmt.Println("  export <chain> <file>")
+	fmt.Println("     write the local chain labeled <chain> to the archive <file>")
+	fmt.Println("  import <file>")
+	fmt.Println("     verify the chain in the archive <file> and replace the local chain with it")
+	fmt.Println("  inspect <chain> [block] [json]")
+	fmt.Println("     print the block of the local chain <chain> given by its hash or height, or a summary of the chain")
+	fmt.Println("     with json, the output is JSON instead of text")
+	fmt.Println("  verify <chain>")
+	fmt.Println("     check every signature, link and permission of the local chain <chain> without a server")
+	fmt.Println("     the genesis block is checked against " + chain.GENESIS_DIR + " and pruned blocks against " + chain.COLD_DIR + " in the data directory when they have copies there")
+	fmt.Println("  prune <chain> <height> [cold]")
+	fmt.Println("     discard entry payloads below <height> in the local chain <chain>, keeping headers")
+	fmt.Println("     with cold, the full blocks are moved to " + chain.COLD_DIR + " in the data directory instead")
+	fmt.Println("  private keys are encrypted with a passphrase, read from $" + identity.PASSPHRASE_ENV + ", the file named by $" + identity.PASSPHRASE_FILE_ENV + ", or a prompt")
+	fmt.Println("  a new passphrase is read from $" + identity.NEW_PASSPHRASE_ENV + ", the file named by $" + identity.NEW_PASSPHRASE_FILE_ENV + ", or a prompt")
+	fmt.Println("  commands that take a [chain] use the server's " + chain.MAIN_CHAIN_NAME + " chain if it isn't given")
+	fmt.Println("  data is kept in $" + DATA_DIR_ENV + ", or in " + node.DEFAULT_DATA_DIR + " if it isn't set")
+	fmt.Println("  https servers are verified with the CA bundle in $" + CA_BUNDLE_ENV + " if it's set, and servers requiring")
+	fmt.Println("  mutual tls are given the certificate in $" + CLIENT_CERT_ENV + " with the private key in $" + CLIENT_KEY_ENV)
+	fmt.Println("  requests are signed by the identity in $" + AUTH_IDENTITY_ENV + " if it's set, for servers that require signed requests")
 }
 
 // check that there are at least n command line arguments after the program name
@@ -25,6 +114,241 @@ func checkOsArgs(n int) error {
 	return nil
 }
 
+// returns the nth command line argument after the program name, or "" if it wasn't given
+func optionalOsArg(n int) string {
+	if len(os.Args) < n+1 {
+		return ""
+	}
+	return os.Args[n]
+}
+
+// prints the verdict for a block the server accepted
+func printVerdict(verdict client.Verdict) {
+	fmt.Printf("Accepted block %s at height %d\r\n", verdict.Hash, verdict.Height)
+}
+
+// returns the data directory named by DATA_DIR_ENV, or node.DEFAULT_DATA_DIR if it isn't set
+func dataDir() string {
+	if dir := os.Getenv(DATA_DIR_ENV); dir != "" {
+		return dir
+	}
+	return node.DEFAULT_DATA_DIR
+}
+
+// returns the keystore of the data directory
+func keystore() identity.Keystore {
+	return identity.NewKeystore(dataDir())
+}
+
+// opens a keystore identity or remote signer, exiting if it can't
+func openSigner(name string) identity.Signer {
+	signer, err := keystore().OpenSigner(name)
+	if err != nil {
+		fmt.Printf("Error loading identity %s: %s\r\n", name, err)
+		os.Exit(1)
+	}
+	for _, label := range identity.UnencryptedIdentities(signer) {
+		fmt.Printf("Warning: the private key for identity %s isn't encrypted, set a passphrase with the passphrase command\r\n", label)
+	}
+	return signer
+}
+
+// creates a client for a chain on the server at server_url, exiting if it can't
+// if label is empty, the server's main chain is used
+func openClient(server_url string, label string) *client.Client {
+	var opts []client.Option
+	if label != "" {
+		opts = append(opts, client.WithChain(label))
+	}
+	if ca_bundle := os.Getenv(CA_BUNDLE_ENV); ca_bundle != "" {
+		opts = append(opts, client.WithCABundle(ca_bundle))
+	}
+	if cert_file := os.Getenv(CLIENT_CERT_ENV); cert_file != "" {
+		opts = append(opts, client.WithClientCert(cert_file, os.Getenv(CLIENT_KEY_ENV)))
+	}
+	if auth := os.Getenv(AUTH_IDENTITY_ENV); auth != "" {
+		opts = append(opts, client.WithAuth(openSigner(auth)))
+	}
+	c, err := client.New(server_url, opts...)
+	if err != nil {
+		fmt.Printf("Error connecting to %s: %s\r\n", server_url, err)
+		os.Exit(1)
+	}
+	return c
+}
+
+// prints the blocks of the client's chain from height from as the server appends them, until the stream fails
+// a negative from starts at the next block appended
+func watchCommand(c *client.Client, from int) error {
+	sub := c.Subscribe(context.Background(), from)
+	for b := range sub.Blocks {
+		description := b.GetTxType().String() + " (pruned)"
+		if !b.IsPruned() {
+			tx := b.GetTx()
+			description = b.GetTxType().String() + " " + tx.Describe()
+		}
+		fmt.Printf("Block %d %x by %s: %s\r\n", b.Height, b.GetHash(), b.GetValidatorFingerprint(), description)
+	}
+	return sub.Err()
+}
+
+// returns the key named by a delegate argument
+// the argument is a keystore identity or PEM public key file, or the fingerprint of a local identity,
+// or the fingerprint or alias of a validator on the chain
+func resolveDelegate(c *client.Client, arg string) ([]byte, error) {
+	if pub, err := keystore().ResolvePublicKey(arg); err == nil {
+		return pub, nil
+	}
+	labels, err := keystore().ListIdentities()
+	if err != nil {
+		return nil, err
+	}
+	for _, label := range labels {
+		pub, err := keystore().LoadPublicKey(label)
+		if err == nil && strings.EqualFold(identity.Fingerprint(pub), arg) {
+			return pub, nil
+		}
+	}
+	info, err := c.FindValidator(context.Background(), arg)
+	if errors.Is(err, client.ErrNotFound) {
+		return nil, fmt.Errorf("%s isn't an identity, a public key file, or the fingerprint or alias of a validator", arg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(info.PubKey)
+}
+
+// prints an identity's fingerprint and public key
+// if validators isn't nil, its allowance and alias on the chain are printed too
+func printIdentity(label string, validators map[string]node.ValidatorInfo, verbose bool) error {
+	pubBytes, err := keystore().LoadPublicKey(label)
+	if err != nil {
+		return err
+	}
+	publicKey, err := identity.ParsePublicKey(pubBytes)
+	if err != nil {
+		return err
+	}
+	algorithm, _ := identity.KeyAlgorithm(publicKey)
+	line := fmt.Sprintf("%-16s %-8s %s", label, algorithm, identity.Fingerprint(pubBytes))
+	if validators != nil {
+		info, ok := validators[hex.EncodeToString(pubBytes)]
+		line += "  " + chain.FormatAllowance(info.Allowance, ok)
+		if info.Alias != "" {
+			line += "  " + info.Alias
+		}
+	}
+	fmt.Printf("%s\r\n", line)
+	if verbose {
+		fmt.Printf("Public key: %x\r\n", pubBytes)
+	}
+	return nil
+}
+
+// runs a keys subcommand
+func keysCommand() error {
+	if err := checkOsArgs(2); err != nil {
+		return err
+	}
+	sub := os.Args[2]
+
+	// list and show can look up allowances on a server's chain
+	fetchValidators := func(n int) (map[string]node.ValidatorInfo, error) {
+		server_url := optionalOsArg(n)
+		if server_url == "" {
+			return nil, nil
+		}
+		list, err := openClient(server_url, optionalOsArg(n+1)).GetValidators(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		validators := make(map[string]node.ValidatorInfo)
+		for _, info := range list {
+			validators[info.PubKey] = info
+		}
+		return validators, nil
+	}
+
+	if sub == "new" {
+		if err := checkOsArgs(3); err != nil {
+			return err
+		}
+		label := os.Args[3]
+		passphrase, err := identity.ReadPassphrase(fmt.Sprintf("New passphrase for identity %s: ", label), identity.NEW_PASSPHRASE_ENV, identity.NEW_PASSPHRASE_FILE_ENV, true)
+		if err != nil {
+			return err
+		}
+		algorithm := optionalOsArg(4)
+		if algorithm == "" {
+			algorithm = identity.DEFAULT_ALGORITHM
+		}
+		if err := keystore().GenerateKeys(label, algorithm, passphrase); err != nil {
+			return err
+		}
+		return printIdentity(label, nil, true)
+	} else if sub == "list" {
+		validators, err := fetchValidators(3)
+		if err != nil {
+			return err
+		}
+		labels, err := keystore().ListIdentities()
+		if err != nil {
+			return err
+		}
+		for _, label := range labels {
+			if err := printIdentity(label, validators, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	} else if sub == "show" {
+		if err := checkOsArgs(3); err != nil {
+			return err
+		}
+		validators, err := fetchValidators(4)
+		if err != nil {
+			return err
+		}
+		return printIdentity(os.Args[3], validators, true)
+	} else if sub == "import" {
+		if err := checkOsArgs(4); err != nil {
+			return err
+		}
+		data, err := os.ReadFile(os.Args[4])
+		if err != nil {
+			return err
+		}
+		passphrase, err := identity.ReadPassphrase(fmt.Sprintf("New passphrase for identity %s: ", os.Args[3]), identity.NEW_PASSPHRASE_ENV, identity.NEW_PASSPHRASE_FILE_ENV, true)
+		if err != nil {
+			return err
+		}
+		if err := keystore().ImportIdentity(os.Args[3], data, passphrase); err != nil {
+			return err
+		}
+		return printIdentity(os.Args[3], nil, true)
+	} else if sub == "export" {
+		if err := checkOsArgs(4); err != nil {
+			return err
+		}
+		data, err := keystore().ExportIdentity(os.Args[3], optionalOsArg(5) == "public")
+		if err != nil {
+			return err
+		}
+		return identity.WritePrivateFile(os.Args[4], data)
+	} else if sub == "delete" {
+		if err := checkOsArgs(3); err != nil {
+			return err
+		}
+		if optionalOsArg(4) != "confirm" {
+			return fmt.Errorf("deleting identity %s can't be undone, repeat the command with confirm at the end", os.Args[3])
+		}
+		return keystore().DeleteIdentity(os.Args[3])
+	}
+	printUsage()
+	return fmt.Errorf("unknown keys command %s", sub)
+}
+
 func main() {
 
 	if err := checkOsArgs(1); err != nil {
@@ -34,23 +358,350 @@ func main() {
 	cmd := os.Args[1]
 
 	if cmd == "serve" {
-		GetCurrentTimestamp()
-		StartServer()
+		cfg, err := serveConfig(os.Args[2:])
+		if err != nil {
+			fmt.Printf("Error in serve configuration: %s\r\n", err)
+			os.Exit(1)
+		}
+		n, err := node.NewFromConfig(cfg)
+		if err != nil {
+			fmt.Printf("Error starting node: %s\r\n", err)
+			os.Exit(1)
+		}
+		if err := n.ListenAndServe(cfg.Listen); err != nil {
+			fmt.Printf("Error serving: %s\r\n", err)
+			os.Exit(1)
+		}
 	} else if cmd == "entry" {
 		if err := checkOsArgs(4); err != nil {
 			return
 		}
-		server_url := os.Args[2]
-		id := LoadIdentity(os.Args[3])
+		c := openClient(os.Args[2], optionalOsArg(5))
+		id := openSigner(os.Args[3])
 		entry := []byte(os.Args[4])
 
-		SubmitEntry(server_url, entry, id)
+		verdict, err := c.SubmitEntry(context.Background(), id, entry)
+		if err != nil {
+			fmt.Printf("Error submitting entry: %s\r\n", err)
+			os.Exit(1)
+		}
+		printVerdict(verdict)
 	} else if cmd == "bootstrap" {
 		if err := checkOsArgs(2); err != nil {
 			return
 		}
-		fmt.Printf("Creating a genesis block for %s\r\n", os.Args[2])
-		GenesisBootstrap(LoadIdentity(os.Args[2]))
+		label := optionalOsArg(3)
+		if label == "" {
+			label = chain.MAIN_CHAIN_NAME
+		}
+		id := openSigner(os.Args[2])
+		draft := chain.GenesisFile{Spec: chain.NewGenesisSpec(label, id)}
+		if draft_file := optionalOsArg(4); draft_file != "" {
+			var err error
+			draft, err = chain.ReadGenesisDraft(draft_file, label, id)
+			if err != nil {
+				fmt.Printf("Error reading genesis draft: %s\r\n", err)
+				os.Exit(1)
+			}
+		}
+
+		fmt.Printf("Creating chain %s with a genesis block signed by %s\r\n", label, os.Args[2])
+		gf, err := chain.GenesisBootstrap(dataDir(), draft, id)
+		if err != nil {
+			fmt.Printf("Error creating chain: %s\r\n", err)
+			os.Exit(1)
+		}
+		genesis, _ := gf.Block()
+		genesis.Print()
+		fmt.Printf("Created chain %s with genesis block %x\r\n", label, genesis.GetHash())
+	} else if cmd == "cosign" {
+		if err := checkOsArgs(3); err != nil {
+			return
+		}
+		id := openSigner(os.Args[2])
+		draft, err := chain.ReadGenesisDraft(os.Args[3], "", id)
+		if err != nil {
+			fmt.Printf("Error reading genesis draft: %s\r\n", err)
+			os.Exit(1)
+		}
+		draft, err = chain.CosignGenesis(draft, id)
+		if err == nil {
+			err = draft.SaveDraft(os.Args[3])
+		}
+		if err != nil {
+			fmt.Printf("Error co-signing genesis: %s\r\n", err)
+			os.Exit(1)
+		}
+		missing := draft.MissingCosignatures()
+		fmt.Printf("Co-signed genesis for chain %s, %d validator(s) still to co-sign\r\n", draft.Spec.ChainID, len(missing))
+		for _, v := range missing {
+			fmt.Printf("  %s\r\n", identity.FingerprintHex(v))
+		}
+	} else if cmd == "keys" {
+		if err := keysCommand(); err != nil {
+			fmt.Printf("Error: %s\r\n", err)
+			os.Exit(1)
+		}
+	} else if cmd == "signer" {
+		if err := checkOsArgs(3); err != nil {
+			return
+		}
+		id := openSigner(os.Args[2])
+		l, err := identity.ListenSigner(os.Args[3])
+		if err != nil {
+			fmt.Printf("Error listening on %s: %s\r\n", os.Args[3], err)
+			os.Exit(1)
+		}
+		fmt.Printf("Signing for identity %s (%s) on %s\r\n", os.Args[2], identity.Fingerprint(id.GetPubBytes()), os.Args[3])
+		err = identity.ServeSigner(l, id)
+		if err != nil {
+			fmt.Printf("Error serving signer: %s\r\n", err)
+			os.Exit(1)
+		}
+	} else if cmd == "multisig" {
+		if err := checkOsArgs(4); err != nil {
+			return
+		}
+		threshold, err := strconv.ParseUint(os.Args[2], 10, 8)
+		if err != nil {
+			fmt.Printf("Invalid threshold %s\r\n", os.Args[2])
+			os.Exit(1)
+		}
+		var keys [][]byte
+		for _, arg := range os.Args[4:] {
+			pub, err := keystore().ResolvePublicKey(arg)
+			if err != nil {
+				fmt.Printf("Error reading key: %s\r\n", err)
+				os.Exit(1)
+			}
+			keys = append(keys, pub)
+		}
+		policy, err := identity.NewMultisigPolicy(uint8(threshold), keys)
+		if err == nil {
+			err = policy.Save(os.Args[3])
+		}
+		if err != nil {
+			fmt.Printf("Error creating multisig validator: %s\r\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Saved %d-of-%d multisig validator %s to %s\r\n", threshold, len(keys), identity.Fingerprint(policy.ID()), os.Args[3])
+	} else if cmd == "register" {
+		if err := checkOsArgs(4); err != nil {
+			return
+		}
+		policy, err := identity.ReadMultisigPolicy(os.Args[4])
+		if err != nil {
+			fmt.Printf("Error reading multisig policy: %s\r\n", err)
+			os.Exit(1)
+		}
+		_, err = openClient(os.Args[2], optionalOsArg(5)).Submit(context.Background(), openSigner(os.Args[3]), transaction.NewTx_Multisig(policy))
+		if err != nil {
+			fmt.Printf("Error registering multisig validator: %s\r\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Submitted registration of multisig validator %s\r\n", identity.Fingerprint(policy.ID()))
+	} else if cmd == "alias" {
+		if err := checkOsArgs(4); err != nil {
+			return
+		}
+		if err := identity.ValidAlias(os.Args[4]); err != nil {
+			fmt.Printf("Error: %s\r\n", err)
+			os.Exit(1)
+		}
+		_, err := openClient(os.Args[2], optionalOsArg(5)).Submit(context.Background(), openSigner(os.Args[3]), transaction.NewTx_Alias(os.Args[4]))
+		if err != nil {
+			fmt.Printf("Error registering alias: %s\r\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Submitted registration of alias %s\r\n", os.Args[4])
+	} else if cmd == "certify" {
+		if err := checkOsArgs(4); err != nil {
+			return
+		}
+		certs, err := chain.ReadCertificateFile(os.Args[4])
+		if err == nil {
+			_, err = openClient(os.Args[2], optionalOsArg(5)).Submit(context.Background(), openSigner(os.Args[3]), transaction.NewTx_Certificate(certs))
+		}
+		if err != nil {
+			fmt.Printf("Error registering certificate: %s\r\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Submitted certificate for %s\r\n", certs[0].Subject)
+	} else if cmd == "revoke" {
+		if err := checkOsArgs(4); err != nil {
+			return
+		}
+		crl, err := chain.ReadRevocationListFile(os.Args[4])
+		if err == nil {
+			_, err = openClient(os.Args[2], optionalOsArg(5)).Submit(context.Background(), openSigner(os.Args[3]), transaction.NewTx_Revocation(crl))
+		}
+		if err != nil {
+			fmt.Printf("Error submitting revocation list: %s\r\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Submitted revocation list %s\r\n", os.Args[4])
+	} else if cmd == "passphrase" {
+		if err := checkOsArgs(2); err != nil {
+			return
+		}
+		new_passphrase, err := identity.ReadPassphrase("New passphrase: ", identity.NEW_PASSPHRASE_ENV, identity.NEW_PASSPHRASE_FILE_ENV, true)
+		if err == nil {
+			err = keystore().ChangePassphrase(os.Args[2], new_passphrase)
+		}
+		if err != nil {
+			fmt.Printf("Error changing passphrase: %s\r\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Changed the passphrase for identity %s\r\n", os.Args[2])
+	} else if cmd == "delegate" {
+		if err := checkOsArgs(5); err != nil {
+			return
+		}
+		count, err := strconv.ParseUint(os.Args[4], 10, 32)
+		if err != nil || count == 0 {
+			fmt.Printf("Invalid count %s\r\n", os.Args[4])
+			os.Exit(1)
+		}
+		c := openClient(os.Args[2], optionalOsArg(6))
+		signer := openSigner(os.Args[3])
+		delegate, err := resolveDelegate(c, os.Args[5])
+		if err != nil {
+			fmt.Printf("Error: %s\r\n", err)
+			os.Exit(1)
+		}
+
+		// the delegating block uses up one more block of the allowance
+		validator := hex.EncodeToString(signer.GetPubBytes())
+		state, _, err := c.GetState(context.Background())
+		if err != nil {
+			fmt.Printf("Error fetching the state: %s\r\n", err)
+			os.Exit(1)
+		}
+		allowance, ok := state[validator]
+		if !ok || (!chain.IsUnlimited(allowance) && uint64(allowance) <= count) {
+			fmt.Printf("Error: %s has an allowance of %s, delegating %d blocks needs at least %d\r\n", os.Args[3], chain.FormatAllowance(allowance, ok), count, count+1)
+			os.Exit(1)
+		}
+
+		verdict, err := c.SubmitPermission(context.Background(), signer, uint32(count), delegate)
+		if err != nil {
+			fmt.Printf("Error delegating blocks: %s\r\n", err)
+			os.Exit(1)
+		}
+		printVerdict(verdict)
+		fmt.Printf("Delegated %d blocks to %s\r\n", count, identity.Fingerprint(delegate))
+		state, _, err = c.GetState(context.Background())
+		if err != nil {
+			fmt.Printf("Error fetching the remaining allowance: %s\r\n", err)
+			os.Exit(1)
+		}
+		allowance, ok = state[validator]
+		fmt.Printf("Remaining allowance of %s: %s\r\n", os.Args[3], chain.FormatAllowance(allowance, ok))
+	} else if cmd == "blob" {
+		if err := checkOsArgs(4); err != nil {
+			return
+		}
+		verdict, err := openClient(os.Args[2], optionalOsArg(5)).SubmitBlob(context.Background(), openSigner(os.Args[3]), os.Args[4])
+		if err != nil {
+			fmt.Printf("Error submitting blob: %s\r\n", err)
+			os.Exit(1)
+		}
+		printVerdict(verdict)
+	} else if cmd == "fetch" {
+		if err := checkOsArgs(4); err != nil {
+			return
+		}
+		block_hash, err := hex.DecodeString(os.Args[3])
+		if err != nil {
+			fmt.Printf("Invalid block hash %s\r\n", os.Args[3])
+			os.Exit(1)
+		}
+		err = openClient(os.Args[2], optionalOsArg(5)).FetchBlob(context.Background(), block_hash, os.Args[4])
+		if err != nil {
+			fmt.Printf("Error fetching blob: %s\r\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Saved verified blob to %s\r\n", os.Args[4])
+	} else if cmd == "watch" {
+		if err := checkOsArgs(2); err != nil {
+			return
+		}
+		from := -1
+		if arg := optionalOsArg(3); arg != "" {
+			height, err := strconv.Atoi(arg)
+			if err != nil || height < 0 {
+				fmt.Printf("Invalid height %s\r\n", arg)
+				os.Exit(1)
+			}
+			from = height
+		}
+		if err := watchCommand(openClient(os.Args[2], optionalOsArg(4)), from); err != nil {
+			fmt.Printf("Error watching chain: %s\r\n", err)
+			os.Exit(1)
+		}
+	} else if cmd == "export" {
+		if err := checkOsArgs(3); err != nil {
+			return
+		}
+		err := chain.ExportChainFile(dataDir(), os.Args[2], os.Args[3])
+		if err != nil {
+			fmt.Printf("Error exporting chain: %s\r\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Exported chain %s to %s\r\n", os.Args[2], os.Args[3])
+	} else if cmd == "import" {
+		if err := checkOsArgs(2); err != nil {
+			return
+		}
+		bc, err := chain.ImportChainFile(dataDir(), os.Args[2])
+		if err != nil {
+			fmt.Printf("Error importing chain: %s\r\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Imported chain %s with %d blocks, tip %x\r\n", bc.Label(), bc.Height()+1, bc.GetTipHash())
+	} else if cmd == "inspect" {
+		if err := inspectCommand(); err != nil {
+			fmt.Printf("Error: %s\r\n", err)
+			os.Exit(1)
+		}
+	} else if cmd == "verify" {
+		if err := checkOsArgs(2); err != nil {
+			return
+		}
+		bc, err := chain.VerifyChain(dataDir(), os.Args[2])
+		var verr *chain.VerifyError
+		if errors.As(err, &verr) && verr.Height >= 0 {
+			fmt.Printf("Block %d (%x) failed verification: %s\r\n", verr.Height, verr.Hash, verr.Err)
+			os.Exit(1)
+		} else if errors.As(err, &verr) {
+			fmt.Printf("Block %x failed verification: %s\r\n", verr.Hash, verr.Err)
+			os.Exit(1)
+		} else if err != nil {
+			fmt.Printf("Error verifying chain: %s\r\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Verified chain %s with %d blocks, tip %x\r\n", bc.Label(), bc.Height()+1, bc.GetTipHash())
+	} else if cmd == "prune" {
+		if err := checkOsArgs(3); err != nil {
+			return
+		}
+		height, err := strconv.Atoi(os.Args[3])
+		if err != nil {
+			fmt.Printf("Invalid height %s\r\n", os.Args[3])
+			os.Exit(1)
+		}
+		cold := len(os.Args) > 4 && os.Args[4] == "cold"
+		bc, err := chain.LoadChain(dataDir(), os.Args[2])
+		if err != nil {
+			fmt.Printf("Error loading chain: %s\r\n", err)
+			os.Exit(1)
+		}
+		n, err := bc.Prune(height, cold)
+		if err != nil {
+			fmt.Printf("Error pruning chain: %s\r\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Pruned %d blocks from chain %s\r\n", n, os.Args[2])
 	} else {
 		printUsage()
 	}
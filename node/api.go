@@ -0,0 +1,479 @@
+package node
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"reddchain/block"
+	"reddchain/chain"
+	"reddchain/identity"
+)
+
+// the versioned json api is served under API_PREFIX, next to the original endpoints
+// every response is an APIResponse, except for the raw encodings a client can ask for with the Accept header
+const API_PREFIX string = "/v1"
+
+// the media types of the encodings the api can respond with
+const (
+	MEDIA_JSON   string = "application/json"
+	MEDIA_HEX    string = "text/plain" // hex encoding followed by a newline
+	MEDIA_BINARY string = "application/octet-stream"
+)
+
+// error codes reported by the api, besides the SUBMIT_* codes of a rejected block
+const (
+	ERROR_BAD_REQUEST        string = "bad_request"
+	ERROR_NOT_FOUND          string = "not_found"
+	ERROR_METHOD_NOT_ALLOWED string = "method_not_allowed"
+	ERROR_GENESIS_MISMATCH   string = "genesis_mismatch"
+	ERROR_UNAUTHORIZED       string = "unauthorized"
+	ERROR_FORBIDDEN          string = "forbidden"
+	ERROR_TOO_LARGE          string = "too_large"
+	ERROR_RATE_LIMITED       string = "rate_limited"
+	ERROR_INTERNAL           string = "internal"
+)
+
+// the envelope every json response of the api is wrapped in
+type APIResponse struct {
+	OK    bool            `json:"ok"`
+	Tip   string          `json:"tip,omitempty"` // the chain's tip when the response was made
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error *APIError       `json:"error,omitempty"`
+}
+
+// why a request failed
+type APIError struct {
+	Code    string `json:"code"` // one of the ERROR_* or SUBMIT_* codes
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// a chain as listed by the chains endpoint
+type APIChain struct {
+	Label   string `json:"label"`
+	Genesis string `json:"genesis"`
+	Tip     string `json:"tip"`
+	Height  int    `json:"height"`
+}
+
+// the node itself
+type APINode struct {
+	Fingerprint  string   `json:"fingerprint,omitempty"` // fingerprint of the node's identity, if it has one
+	PubKey       string   `json:"pubkey,omitempty"`      // hex-encoded public key of the node's identity
+	Chains       []string `json:"chains"`
+	Peers        []string `json:"peers"`
+	RefusedPeers []string `json:"refused_peers,omitempty"` // peers serving a shared chain with a different genesis block
+	Auth         string   `json:"auth"`                    // which requests must be signed, one of the AUTH_* modes
+}
+
+// the tip of a chain
+type APITip struct {
+	Hash      string `json:"hash"`
+	Height    int    `json:"height"`
+	StateRoot string `json:"state_root"`
+	Genesis   string `json:"genesis"`
+}
+
+// a block of a chain
+type APIBlock struct {
+	Height int `json:"height"`
+	block.Info
+	Raw string `json:"raw"` // hex-encoded block, or its header if the block has been pruned
+}
+
+// a proof that a validator's allowance is included in the state root of the tip
+type APIProof struct {
+	Validator string            `json:"validator"`
+	Allowance uint32            `json:"allowance"`
+	StateRoot string            `json:"state_root"`
+	Proof     []chain.ProofStep `json:"proof"`
+}
+
+// the body of a json submission
+type APISubmission struct {
+	Block string `json:"block"` // hex-encoded block
+}
+
+// endpoints available under API_PREFIX/chains/<label>/
+var apiHandlers = map[string]chainHandlerFunc{
+	"tip":        apiTip,
+	"submit":     apiSubmit,
+	"state":      apiState,
+	"validators": apiValidators,
+	"proof":      apiProof,
+	"block":      apiBlock,
+	"blocks":     apiBlocks,
+	"genesis":    apiGenesis,
+	"subscribe":  apiSubscribe,
+}
+
+// routes API_PREFIX/chains/<label>/<endpoint> to the handler for that endpoint
+// the main chain is also served at API_PREFIX/<endpoint>, and the blob store at API_PREFIX/blob
+func (n *Node) routeAPI(w http.ResponseWriter, req *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, API_PREFIX+"/"), "/")
+	label := chain.MAIN_CHAIN_NAME
+	if parts[0] == "chains" {
+		if len(parts) == 1 || (len(parts) == 2 && parts[1] == "") {
+			n.apiChains(w, req)
+			return
+		}
+		if len(parts) != 3 {
+			writeError(w, http.StatusNotFound, ERROR_NOT_FOUND, "unknown endpoint")
+			return
+		}
+		label, parts = parts[1], parts[2:]
+	}
+	if len(parts) != 1 {
+		writeError(w, http.StatusNotFound, ERROR_NOT_FOUND, "unknown endpoint")
+		return
+	}
+	if parts[0] == "" {
+		n.apiChains(w, req)
+		return
+	}
+	if parts[0] == "blob" {
+		n.serveBlob(w, req)
+		return
+	}
+	if parts[0] == "node" && label == chain.MAIN_CHAIN_NAME {
+		n.apiNode(w, req)
+		return
+	}
+	if parts[0] == "metrics" && label == chain.MAIN_CHAIN_NAME {
+		n.apiMetrics(w, req)
+		return
+	}
+
+	served, ok := n.chains[label]
+	if !ok {
+		writeError(w, http.StatusNotFound, ERROR_NOT_FOUND, "unknown chain "+label)
+		return
+	}
+	handler, ok := apiHandlers[parts[0]]
+	if !ok {
+		writeError(w, http.StatusNotFound, ERROR_NOT_FOUND, "unknown endpoint")
+		return
+	}
+	if actual, ok := genesisMatches(req, served); !ok {
+		writeError(w, http.StatusConflict, ERROR_GENESIS_MISMATCH, "this chain's genesis is "+actual)
+		return
+	}
+	handler(w, req, served)
+}
+
+// writes a successful response wrapping v
+func writeData(w http.ResponseWriter, status int, tip []byte, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ERROR_INTERNAL, err.Error())
+		return
+	}
+	writeResponse(w, status, APIResponse{OK: true, Tip: hex.EncodeToString(tip), Data: data})
+}
+
+// writes a failed response
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	writeResponse(w, status, APIResponse{Error: &APIError{Code: code, Message: message}})
+}
+
+func writeResponse(w http.ResponseWriter, status int, resp APIResponse) {
+	w.Header().Set("Content-Type", MEDIA_JSON)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// returns the encoding the client asked for in the Accept header
+// the first of MEDIA_JSON, MEDIA_HEX or MEDIA_BINARY that is listed is used, MEDIA_JSON if none are
+func acceptedMedia(req *http.Request) string {
+	for _, part := range strings.Split(req.Header.Get("Accept"), ",") {
+		media, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		switch media {
+		case MEDIA_JSON, MEDIA_HEX, MEDIA_BINARY:
+			return media
+		}
+	}
+	return MEDIA_JSON
+}
+
+// writes data in the raw encoding given by media, either MEDIA_HEX or MEDIA_BINARY
+func writeRaw(w http.ResponseWriter, media string, data []byte) {
+	w.Header().Set("Content-Type", media)
+	if media == MEDIA_BINARY {
+		w.Write(data)
+	} else {
+		fmt.Fprintf(w, "%x\n", data)
+	}
+}
+
+// refuses requests with a method other than the ones given
+// returns false if the request was refused
+func allowMethods(w http.ResponseWriter, req *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if req.Method == method {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, ERROR_METHOD_NOT_ALLOWED, req.Method+" is not allowed")
+	return false
+}
+
+// writes the chains served by the node, sorted by label
+func (n *Node) apiChains(w http.ResponseWriter, req *http.Request) {
+	if !allowMethods(w, req, http.MethodGet, http.MethodHead) {
+		return
+	}
+	list := []APIChain{}
+	for _, label := range n.Labels() {
+		served := n.chains[label]
+		served.lock.RLock()
+		list = append(list, APIChain{
+			Label:   label,
+			Genesis: hex.EncodeToString(served.bc.GetGenesisHash()),
+			Tip:     hex.EncodeToString(served.bc.GetTipHash()),
+			Height:  served.bc.Height(),
+		})
+		served.lock.RUnlock()
+	}
+	writeData(w, http.StatusOK, nil, list)
+}
+
+// writes the node's identity, chains and peers
+func (n *Node) apiNode(w http.ResponseWriter, req *http.Request) {
+	if !allowMethods(w, req, http.MethodGet, http.MethodHead) {
+		return
+	}
+	info := APINode{Chains: n.Labels(), Peers: n.Peers(), RefusedPeers: n.RefusedPeers(), Auth: n.AuthMode()}
+	if n.identity != nil {
+		info.Fingerprint = identity.Fingerprint(n.identity)
+		info.PubKey = hex.EncodeToString(n.identity)
+	}
+	writeData(w, http.StatusOK, nil, info)
+}
+
+// writes the tip of the chain, or only its hash in a raw encoding
+func apiTip(w http.ResponseWriter, req *http.Request, served *served_chain_t) {
+	if !allowMethods(w, req, http.MethodGet, http.MethodHead) {
+		return
+	}
+	served.lock.RLock()
+	defer served.lock.RUnlock()
+	tip := served.bc.GetTipHash()
+	if media := acceptedMedia(req); media != MEDIA_JSON {
+		writeRaw(w, media, tip)
+		return
+	}
+	writeData(w, http.StatusOK, tip, APITip{
+		Hash:      hex.EncodeToString(tip),
+		Height:    served.bc.Height(),
+		StateRoot: hex.EncodeToString(served.bc.GetStateRoot()),
+		Genesis:   hex.EncodeToString(served.bc.GetGenesisHash()),
+	})
+}
+
+// writes the validator state at the tip as an object of validator -> allowance
+func apiState(w http.ResponseWriter, req *http.Request, served *served_chain_t) {
+	if !allowMethods(w, req, http.MethodGet, http.MethodHead) {
+		return
+	}
+	served.lock.RLock()
+	defer served.lock.RUnlock()
+	writeData(w, http.StatusOK, served.bc.GetTipHash(), served.bc.GetValidators())
+}
+
+// writes the validators at the tip with their fingerprints and aliases, sorted by public key
+func apiValidators(w http.ResponseWriter, req *http.Request, served *served_chain_t) {
+	if !allowMethods(w, req, http.MethodGet, http.MethodHead) {
+		return
+	}
+	served.lock.RLock()
+	defer served.lock.RUnlock()
+	writeData(w, http.StatusOK, served.bc.GetTipHash(), served.bc.ValidatorInfos())
+}
+
+// writes a proof that the validator given as a hex-encoded public key is included in the state root of the tip
+func apiProof(w http.ResponseWriter, req *http.Request, served *served_chain_t) {
+	if !allowMethods(w, req, http.MethodGet, http.MethodHead) {
+		return
+	}
+	served.lock.RLock()
+	defer served.lock.RUnlock()
+	validator := req.URL.Query().Get("validator")
+	validators := served.bc.GetValidators()
+	steps, err := chain.StateProof(validators, validator)
+	if err != nil {
+		writeError(w, http.StatusNotFound, ERROR_NOT_FOUND, err.Error())
+		return
+	}
+	writeData(w, http.StatusOK, served.bc.GetTipHash(), APIProof{
+		Validator: validator,
+		Allowance: validators[validator],
+		StateRoot: hex.EncodeToString(served.bc.GetStateRoot()),
+		Proof:     steps,
+	})
+}
+
+// writes the chain's genesis file, or its genesis block in a raw encoding
+func apiGenesis(w http.ResponseWriter, req *http.Request, served *served_chain_t) {
+	if !allowMethods(w, req, http.MethodGet, http.MethodHead) {
+		return
+	}
+	served.lock.RLock()
+	defer served.lock.RUnlock()
+	genesis := served.bc.GetGenesisBlock()
+	w.Header().Set(GENESIS_HEADER, hex.EncodeToString(genesis.GetHash()))
+	if media := acceptedMedia(req); media != MEDIA_JSON {
+		writeRaw(w, media, genesis.Marshal())
+		return
+	}
+	gf, err := chain.GenesisFileFromBlock(genesis)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ERROR_INTERNAL, err.Error())
+		return
+	}
+	writeData(w, http.StatusOK, served.bc.GetTipHash(), gf)
+}
+
+// returns the json encoding of a block
+func newAPIBlock(blk block.Block, height int) APIBlock {
+	info := APIBlock{Height: height, Info: blk.Info()}
+	if blk.IsPruned() {
+		info.Raw = hex.EncodeToString(blk.MarshalHeader())
+	} else {
+		info.Raw = hex.EncodeToString(blk.Marshal())
+	}
+	return info
+}
+
+// writes the block with the hash or height given in the query string
+// in a raw encoding, the block's height is reported in X-Block-Height,
+// and only the header of a pruned block is written, marked by X-Block-Status
+func apiBlock(w http.ResponseWriter, req *http.Request, served *served_chain_t) {
+	if !allowMethods(w, req, http.MethodGet, http.MethodHead) {
+		return
+	}
+	var blk block.Block
+	var height int
+	var err error
+	query := req.URL.Query()
+	served.lock.RLock()
+	defer served.lock.RUnlock()
+	if query.Has("height") {
+		height, err = strconv.Atoi(query.Get("height"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ERROR_BAD_REQUEST, "invalid height")
+			return
+		}
+		blk, err = served.bc.GetBlockAt(height)
+	} else {
+		var hash []byte
+		hash, err = hex.DecodeString(query.Get("hash"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ERROR_BAD_REQUEST, "invalid hash")
+			return
+		}
+		blk, height, err = served.bc.GetBlock(hash)
+	}
+	if err != nil {
+		writeError(w, http.StatusNotFound, ERROR_NOT_FOUND, err.Error())
+		return
+	}
+
+	media := acceptedMedia(req)
+	if media == MEDIA_JSON {
+		writeData(w, http.StatusOK, served.bc.GetTipHash(), newAPIBlock(blk, height))
+		return
+	}
+	w.Header().Set("X-Block-Height", strconv.Itoa(height))
+	if blk.IsPruned() {
+		w.Header().Set("X-Block-Status", "pruned")
+		writeRaw(w, media, blk.MarshalHeader())
+		return
+	}
+	writeRaw(w, media, blk.Marshal())
+}
+
+// writes the blocks starting at the height given by from
+// at most count blocks are written, up to BLOCKS_MAX_COUNT
+func apiBlocks(w http.ResponseWriter, req *http.Request, served *served_chain_t) {
+	if !allowMethods(w, req, http.MethodGet, http.MethodHead) {
+		return
+	}
+	query := req.URL.Query()
+	from, err := strconv.Atoi(query.Get("from"))
+	if err != nil || from < 0 {
+		writeError(w, http.StatusBadRequest, ERROR_BAD_REQUEST, "invalid from")
+		return
+	}
+	count := BLOCKS_MAX_COUNT
+	if query.Has("count") {
+		count, err = strconv.Atoi(query.Get("count"))
+		if err != nil || count < 0 {
+			writeError(w, http.StatusBadRequest, ERROR_BAD_REQUEST, "invalid count")
+			return
+		}
+		count = min(count, BLOCKS_MAX_COUNT)
+	}
+
+	served.lock.RLock()
+	defer served.lock.RUnlock()
+	list := []APIBlock{}
+	for i := from; i < from+count && i <= served.bc.Height(); i++ {
+		blk, _ := served.bc.GetBlockAt(i)
+		list = append(list, newAPIBlock(blk, i))
+	}
+	writeData(w, http.StatusOK, served.bc.GetTipHash(), list)
+}
+
+// appends a block to the chain and saves it
+// the block is sent as raw bytes with MEDIA_BINARY, as an APISubmission with MEDIA_JSON, or hex-encoded otherwise
+// the response's data is a SubmitVerdict, and a rejected block fails with the verdict's code
+func apiSubmit(w http.ResponseWriter, req *http.Request, served *served_chain_t) {
+	if !allowMethods(w, req, http.MethodPost) {
+		return
+	}
+
+	b, err := io.ReadAll(http.MaxBytesReader(w, req.Body, served.max_submit_size))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, ERROR_TOO_LARGE, err.Error())
+		return
+	}
+	media, _, _ := strings.Cut(req.Header.Get("Content-Type"), ";")
+	var block_data []byte
+	switch strings.TrimSpace(media) {
+	case MEDIA_BINARY:
+		block_data = b
+	case MEDIA_JSON:
+		var submission APISubmission
+		if err = json.Unmarshal(b, &submission); err == nil {
+			block_data, err = hex.DecodeString(submission.Block)
+		}
+	default:
+		block_data, err = hex.DecodeString(strings.TrimSpace(string(b)))
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, SUBMIT_MALFORMED, err.Error())
+		return
+	}
+	blk, err := block.Unmarshal(block_data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, SUBMIT_MALFORMED, err.Error())
+		return
+	}
+
+	status, verdict := submitBlock(served, blk)
+	data, _ := json.Marshal(verdict)
+	resp := APIResponse{OK: verdict.Code == SUBMIT_ACCEPTED, Tip: verdict.Tip, Data: data}
+	if !resp.OK {
+		resp.Error = &APIError{Code: verdict.Code, Message: verdict.Error}
+	}
+	writeResponse(w, status, resp)
+}
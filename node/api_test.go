@@ -0,0 +1,213 @@
+package node
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"reddchain/block"
+	"reddchain/chain"
+	"reddchain/chain/chaintest"
+	"reddchain/identity"
+	"reddchain/identity/identitytest"
+	"reddchain/transaction"
+)
+
+// makes an api request and returns the response and its body
+func testAPIRequest(t *testing.T, method string, url string, header map[string]string, body []byte) (*http.Response, []byte) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("error requesting %s (%s)", url, err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return resp, b
+}
+
+// decodes an api envelope, and its data into v
+func decodeAPIResponse(t *testing.T, body []byte, v any) APIResponse {
+	var envelope APIResponse
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		t.Fatalf("response isn't an api envelope (%s): %s", err, body)
+	}
+	if v != nil && envelope.OK {
+		if err := json.Unmarshal(envelope.Data, v); err != nil {
+			t.Fatalf("error decoding data (%s): %s", err, envelope.Data)
+		}
+	}
+	return envelope
+}
+
+func TestAPIReads(t *testing.T) {
+	id := identitytest.Identity("main")
+	bc := chaintest.NewChain(t, "api", id)
+	blk := chaintest.NewBlock(t, &bc, transaction.NewTx_Entry([]byte("hello")), id)
+	if _, err := bc.AppendBlock(blk); err != nil {
+		t.Fatalf("error appending block (%s)", err)
+	}
+	server := newTestServer(t, map[string]chain.Blockchain{"api": bc})
+	base := server.URL + API_PREFIX + "/chains/api"
+	tip := hex.EncodeToString(bc.GetTipHash())
+
+	var info APITip
+	_, body := testAPIRequest(t, http.MethodGet, base+"/tip", nil, nil)
+	envelope := decodeAPIResponse(t, body, &info)
+	if !envelope.OK || envelope.Tip != tip || info.Hash != tip || info.Height != 1 {
+		t.Errorf("wrong tip %s", body)
+	}
+	_, body = testAPIRequest(t, http.MethodGet, base+"/tip", map[string]string{"Accept": MEDIA_HEX}, nil)
+	if strings.TrimSpace(string(body)) != tip {
+		t.Errorf("hex tip was %s", body)
+	}
+
+	// blocks in json and in their raw encodings
+	var encoded APIBlock
+	_, body = testAPIRequest(t, http.MethodGet, base+"/block?height=1", nil, nil)
+	decodeAPIResponse(t, body, &encoded)
+	if encoded.Hash != tip || encoded.Tx == nil || encoded.Tx.Type != "entry" || encoded.Tx.Description != `"hello"` || encoded.Raw != hex.EncodeToString(blk.Marshal()) {
+		t.Errorf("wrong json block %s", body)
+	}
+	resp, body := testAPIRequest(t, http.MethodGet, base+"/block?hash="+tip, map[string]string{"Accept": MEDIA_BINARY}, nil)
+	if !bytes.Equal(body, blk.Marshal()) || resp.Header.Get("X-Block-Height") != "1" || resp.Header.Get("Content-Type") != MEDIA_BINARY {
+		t.Errorf("wrong binary block")
+	}
+	var list []APIBlock
+	_, body = testAPIRequest(t, http.MethodGet, base+"/blocks?from=0", nil, nil)
+	decodeAPIResponse(t, body, &list)
+	if len(list) != 2 || list[1].Hash != tip {
+		t.Errorf("wrong block list %s", body)
+	}
+
+	// failures carry an error code
+	cases := []struct {
+		method string
+		url    string
+		status int
+		code   string
+	}{
+		{http.MethodGet, base + "/block?height=5", http.StatusNotFound, ERROR_NOT_FOUND},
+		{http.MethodGet, base + "/block?height=x", http.StatusBadRequest, ERROR_BAD_REQUEST},
+		{http.MethodGet, base + "/unknown", http.StatusNotFound, ERROR_NOT_FOUND},
+		{http.MethodGet, server.URL + API_PREFIX + "/chains/none/tip", http.StatusNotFound, ERROR_NOT_FOUND},
+		{http.MethodPost, base + "/tip", http.StatusMethodNotAllowed, ERROR_METHOD_NOT_ALLOWED},
+		{http.MethodGet, base + "/submit", http.StatusMethodNotAllowed, ERROR_METHOD_NOT_ALLOWED},
+	}
+	for _, c := range cases {
+		resp, body := testAPIRequest(t, c.method, c.url, nil, nil)
+		envelope := decodeAPIResponse(t, body, nil)
+		if resp.StatusCode != c.status || envelope.OK || envelope.Error == nil || envelope.Error.Code != c.code {
+			t.Errorf("%s %s returned %d %s", c.method, c.url, resp.StatusCode, body)
+		}
+	}
+
+	other := chaintest.NewChain(t, "api", id)
+	resp, body = testAPIRequest(t, http.MethodGet, base+"/tip", map[string]string{GENESIS_HEADER: hex.EncodeToString(other.GetGenesisHash())}, nil)
+	envelope = decodeAPIResponse(t, body, nil)
+	if resp.StatusCode != http.StatusConflict || envelope.Error == nil || envelope.Error.Code != ERROR_GENESIS_MISMATCH {
+		t.Errorf("genesis mismatch returned %d %s", resp.StatusCode, body)
+	}
+
+	var chains []APIChain
+	_, body = testAPIRequest(t, http.MethodGet, server.URL+API_PREFIX+"/chains", nil, nil)
+	decodeAPIResponse(t, body, &chains)
+	if len(chains) != 1 || chains[0].Label != "api" || chains[0].Tip != tip {
+		t.Errorf("wrong chains %s", body)
+	}
+}
+
+func TestAPISubmit(t *testing.T) {
+	id := identitytest.Identity("main")
+	bc := chaintest.NewChain(t, "api-submit", id)
+	server := newTestServer(t, map[string]chain.Blockchain{"api-submit": bc})
+	url := server.URL + API_PREFIX + "/chains/api-submit/submit"
+
+	// each encoding of a block is accepted
+	next := bc
+	for _, media := range []string{MEDIA_BINARY, MEDIA_JSON, MEDIA_HEX} {
+		blk := chaintest.NewBlock(t, &next, transaction.NewTx_Entry([]byte(media)), id)
+		if _, err := next.AppendBlock(blk); err != nil {
+			t.Fatalf("error appending block (%s)", err)
+		}
+		body := blk.Marshal()
+		if media == MEDIA_JSON {
+			body, _ = json.Marshal(APISubmission{Block: hex.EncodeToString(body)})
+		} else if media == MEDIA_HEX {
+			body = []byte(hex.EncodeToString(body) + "\n")
+		}
+		resp, b := testAPIRequest(t, http.MethodPost, url, map[string]string{"Content-Type": media}, body)
+		var verdict SubmitVerdict
+		envelope := decodeAPIResponse(t, b, &verdict)
+		if resp.StatusCode != http.StatusOK || !verdict.Accepted || envelope.Tip != hex.EncodeToString(blk.GetHash()) {
+			t.Errorf("%s submission returned %d %s", media, resp.StatusCode, b)
+		}
+	}
+
+	// a stale block is rejected with its verdict
+	stale := chaintest.NewBlock(t, &bc, transaction.NewTx_Entry([]byte("stale")), id)
+	resp, b := testAPIRequest(t, http.MethodPost, url, map[string]string{"Content-Type": MEDIA_BINARY}, stale.Marshal())
+	var verdict SubmitVerdict
+	envelope := decodeAPIResponse(t, b, nil)
+	json.Unmarshal(envelope.Data, &verdict)
+	if resp.StatusCode != http.StatusConflict || envelope.OK || envelope.Error.Code != SUBMIT_STALE_TIP || verdict.Code != SUBMIT_STALE_TIP {
+		t.Errorf("stale submission returned %d %s", resp.StatusCode, b)
+	}
+
+	// an invalid block is rejected with the reason
+	tip := next.GetTipHash()
+	for signer, code := range map[identity.Signer]string{identitytest.Identity("stranger"): SUBMIT_NOT_AUTHORIZED, id: SUBMIT_WRONG_STATE_ROOT} {
+		blk, err := block.NewBlock(block.GetCurrentTimestamp(), tip, make([]byte, block.HASH_SIZE), transaction.NewTx_Entry([]byte("invalid")), signer)
+		if err != nil {
+			t.Fatalf("error creating block (%s)", err)
+		}
+		resp, b = testAPIRequest(t, http.MethodPost, url, map[string]string{"Content-Type": MEDIA_BINARY}, blk.Marshal())
+		envelope = decodeAPIResponse(t, b, nil)
+		if resp.StatusCode != http.StatusUnprocessableEntity || envelope.Error == nil || envelope.Error.Code != code {
+			t.Errorf("invalid submission returned %d %s, expected %s", resp.StatusCode, b, code)
+		}
+	}
+
+	resp, b = testAPIRequest(t, http.MethodPost, url, nil, []byte("not hex"))
+	envelope = decodeAPIResponse(t, b, nil)
+	if resp.StatusCode != http.StatusBadRequest || envelope.Error == nil || envelope.Error.Code != SUBMIT_MALFORMED {
+		t.Errorf("malformed submission returned %d %s", resp.StatusCode, b)
+	}
+
+	// bodies up to the limit are read, one byte more is refused
+	for size, status := range map[int64]int{DEFAULT_MAX_SUBMIT_SIZE: http.StatusBadRequest, DEFAULT_MAX_SUBMIT_SIZE + 1: http.StatusRequestEntityTooLarge} {
+		resp, b = testAPIRequest(t, http.MethodPost, url, nil, bytes.Repeat([]byte("a"), int(size)))
+		if resp.StatusCode != status {
+			t.Errorf("submission of %d bytes returned %d %s", size, resp.StatusCode, b)
+		}
+	}
+}
+
+func TestAPIBlobSize(t *testing.T) {
+	server := newTestServer(t, map[string]chain.Blockchain{"api-blob": chaintest.NewChain(t, "api-blob", identitytest.Identity("main"))})
+	content := []byte("a small blob")
+	hash := sha256.Sum256(content)
+	url := fmt.Sprintf("%s%s/chains/api-blob/blob?hash=%x&offset=0&size=", server.URL, API_PREFIX, hash)
+
+	// a blob declared larger than the node accepts is refused before anything is written
+	resp, b := testAPIRequest(t, http.MethodPut, url+strconv.FormatInt(DEFAULT_MAX_BLOB_SIZE+1, 10), nil, content)
+	if resp.StatusCode != http.StatusRequestEntityTooLarge || resp.Header.Get("X-Blob-Offset") != "" {
+		t.Errorf("oversized blob returned %d %s", resp.StatusCode, b)
+	}
+	resp, b = testAPIRequest(t, http.MethodPut, url+strconv.Itoa(len(content)), nil, content)
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("blob upload returned %d %s", resp.StatusCode, b)
+	}
+}
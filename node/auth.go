@@ -0,0 +1,179 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"reddchain/identity"
+)
+
+// a signed request carries its signer's key, the time it was signed, a nonce and the signature in these headers
+// the signature is over RequestDigest, by a keystore identity, remote signer or multisig signer
+const (
+	AUTH_KEY_HEADER       string = "X-Auth-Key"       // hex-encoded public key or multisig identifier of the signer
+	AUTH_TIMESTAMP_HEADER string = "X-Auth-Timestamp" // unix time in seconds
+	AUTH_NONCE_HEADER     string = "X-Auth-Nonce"     // hex string of at most AUTH_NONCE_MAX_SIZE characters, used once
+	AUTH_SIGNATURE_HEADER string = "X-Auth-Signature" // hex-encoded signature
+)
+
+const (
+	AUTH_MAX_SKEW       time.Duration = 5 * time.Minute // how far a request's timestamp may be from the node's clock
+	AUTH_NONCE_MAX_SIZE int           = 64
+)
+
+// the ways a node can treat unsigned requests, as reported by the node endpoint
+const (
+	AUTH_OFF    string = "off"    // unsigned requests are served, signed ones are still checked
+	AUTH_WRITES string = "writes" // only GET and HEAD requests are served unsigned
+	AUTH_ALL    string = "all"    // every request must be signed
+)
+
+// returns the digest a client signs to authenticate a request
+// uri is the request's path with its query, as sent on the wire
+func RequestDigest(method string, uri string, body []byte, timestamp int64, nonce string) []byte {
+	body_hash := sha256.Sum256(body)
+	digest := sha256.Sum256(fmt.Appendf(nil, "reddchain request\n%s\n%s\n%x\n%d\n%s", method, uri, body_hash, timestamp, nonce))
+	return digest[:]
+}
+
+// signs a request whose body is body, setting the AUTH_* headers
+func SignRequest(req *http.Request, body []byte, signer identity.Signer) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	timestamp := time.Now().Unix()
+	sig, err := signer.Sign(RequestDigest(req.Method, req.URL.RequestURI(), body, timestamp, hex.EncodeToString(nonce)))
+	if err != nil {
+		return fmt.Errorf("signing request: %w", err)
+	}
+	req.Header.Set(AUTH_KEY_HEADER, hex.EncodeToString(signer.GetPubBytes()))
+	req.Header.Set(AUTH_TIMESTAMP_HEADER, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(AUTH_NONCE_HEADER, hex.EncodeToString(nonce))
+	req.Header.Set(AUTH_SIGNATURE_HEADER, hex.EncodeToString(sig))
+	return nil
+}
+
+// the nonces of recent signed requests, so a request can't be replayed while its timestamp is valid
+type nonce_cache_t struct {
+	lock   sync.Mutex
+	seen   map[string]time.Time // key and nonce -> when the entry can be forgotten
+	pruned time.Time
+}
+
+// records a nonce, returning false if it was already used with the same key
+func (c *nonce_cache_t) use(key []byte, nonce string, now time.Time) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.seen == nil {
+		c.seen = make(map[string]time.Time)
+	}
+	if now.Sub(c.pruned) > AUTH_MAX_SKEW {
+		for entry, expiry := range c.seen {
+			if now.After(expiry) {
+				delete(c.seen, entry)
+			}
+		}
+		c.pruned = now
+	}
+	entry := string(key) + "/" + nonce
+	if _, ok := c.seen[entry]; ok {
+		return false
+	}
+	// a timestamp can be AUTH_MAX_SKEW in the future, and stays valid AUTH_MAX_SKEW after that
+	c.seen[entry] = now.Add(2 * AUTH_MAX_SKEW)
+	return true
+}
+
+// returns how the node treats unsigned requests, one of the AUTH_* modes
+func (n *Node) AuthMode() string {
+	if !n.config.RequireAuth {
+		return AUTH_OFF
+	}
+	if n.config.PublicReads {
+		return AUTH_WRITES
+	}
+	return AUTH_ALL
+}
+
+// checks the signature of signed requests, and refuses unsigned requests the node's configuration requires to be signed
+// the signer must be known to the chain the request is for, as for mutual tls, and must be the client certificate's identity if there is one
+func (n *Node) authenticate(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get(AUTH_SIGNATURE_HEADER) == "" {
+			read_only := req.Method == http.MethodGet || req.Method == http.MethodHead
+			if mode := n.AuthMode(); mode == AUTH_ALL || (mode == AUTH_WRITES && !read_only) {
+				writeError(w, http.StatusUnauthorized, ERROR_UNAUTHORIZED, "the request must be signed by a known identity")
+				return
+			}
+			handler.ServeHTTP(w, req)
+			return
+		}
+
+		// the body was limited to maxBodySize by limitClients
+		body, err := io.ReadAll(req.Body)
+		var too_large *http.MaxBytesError
+		if errors.As(err, &too_large) {
+			writeError(w, http.StatusRequestEntityTooLarge, ERROR_TOO_LARGE, err.Error())
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ERROR_BAD_REQUEST, "error reading body: "+err.Error())
+			return
+		}
+		key, err := n.verifyRequest(req, body, time.Now())
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, ERROR_UNAUTHORIZED, err.Error())
+			return
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		handler.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), client_key_t{}, key)))
+	})
+}
+
+// checks the AUTH_* headers of a request against its body, returning the signer's key
+func (n *Node) verifyRequest(req *http.Request, body []byte, now time.Time) ([]byte, error) {
+	key, err := hex.DecodeString(req.Header.Get(AUTH_KEY_HEADER))
+	if err != nil || len(key) == 0 {
+		return nil, errors.New("invalid " + AUTH_KEY_HEADER)
+	}
+	timestamp, err := strconv.ParseInt(req.Header.Get(AUTH_TIMESTAMP_HEADER), 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid " + AUTH_TIMESTAMP_HEADER)
+	}
+	if skew := now.Sub(time.Unix(timestamp, 0)); skew > AUTH_MAX_SKEW || skew < -AUTH_MAX_SKEW {
+		return nil, fmt.Errorf("the request was signed at %d, more than %s from the node's clock", timestamp, AUTH_MAX_SKEW)
+	}
+	nonce := req.Header.Get(AUTH_NONCE_HEADER)
+	if _, err := hex.DecodeString(nonce); err != nil || nonce == "" || len(nonce) > AUTH_NONCE_MAX_SIZE {
+		return nil, errors.New("invalid " + AUTH_NONCE_HEADER)
+	}
+	sig, err := hex.DecodeString(req.Header.Get(AUTH_SIGNATURE_HEADER))
+	if err != nil {
+		return nil, errors.New("invalid " + AUTH_SIGNATURE_HEADER)
+	}
+
+	if err := identity.VerifyValidatorSignature(key, RequestDigest(req.Method, req.URL.RequestURI(), body, timestamp, nonce), sig); err != nil {
+		return nil, fmt.Errorf("request signature: %w", err)
+	}
+	if label := requestChain(req); !n.knownIdentity(key, label) {
+		return nil, fmt.Errorf("the request is signed by %s, which isn't an identity known to chain %s", identity.Fingerprint(key), label)
+	}
+	if cert_key := ClientKey(req); cert_key != nil && !bytes.Equal(cert_key, key) {
+		return nil, errors.New("the request is signed by a different identity than the client certificate's")
+	}
+	if !n.nonces.use(key, nonce, now) {
+		return nil, errors.New("the request's nonce was already used")
+	}
+	return key, nil
+}
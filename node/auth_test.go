@@ -0,0 +1,166 @@
+package node
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"reddchain/chain/chaintest"
+	"reddchain/identity"
+	"reddchain/identity/identitytest"
+	"reddchain/transaction"
+)
+
+// creates a request signed by signer
+func signedTestRequest(t *testing.T, method string, url string, body []byte, signer identity.Signer) *http.Request {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SignRequest(req, body, signer); err != nil {
+		t.Fatalf("error signing request (%s)", err)
+	}
+	return req
+}
+
+// sends a request and returns the status and error code of the response
+func sendTestRequest(t *testing.T, req *http.Request) (int, string) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("error requesting %s (%s)", req.URL, err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	if envelope := decodeAPIResponse(t, b, nil); envelope.Error != nil {
+		return resp.StatusCode, envelope.Error.Code
+	}
+	return resp.StatusCode, ""
+}
+
+func TestAuthRequests(t *testing.T) {
+	id := identitytest.Identity("main")
+	bc := chaintest.NewChain(t, "auth", id)
+	n := New()
+	n.setConfig(testConfig(t))
+	n.config.RequireAuth, n.config.PublicReads = true, true
+	if err := n.Add("auth", bc); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(n.Handler())
+	t.Cleanup(server.Close)
+	base := server.URL + API_PREFIX + "/chains/auth"
+
+	// reads are public, writes must be signed
+	if status, body := testGet(t, base+"/tip"); status != http.StatusOK {
+		t.Errorf("unsigned read returned %d %s", status, body)
+	}
+	blk := chaintest.NewBlock(t, &bc, transaction.NewTx_Entry([]byte("signed")), id)
+	req, _ := http.NewRequest(http.MethodPost, base+"/submit", bytes.NewReader(blk.Marshal()))
+	req.Header.Set("Content-Type", MEDIA_BINARY)
+	if status, code := sendTestRequest(t, req); status != http.StatusUnauthorized || code != ERROR_UNAUTHORIZED {
+		t.Errorf("unsigned submission returned %d %s", status, code)
+	}
+
+	// the signature covers the body, and can't be replayed
+	req = signedTestRequest(t, http.MethodPost, base+"/submit", []byte("other body"), id)
+	req.Body, req.ContentLength = http.NoBody, 0
+	if status, _ := sendTestRequest(t, req); status != http.StatusUnauthorized {
+		t.Errorf("request with a different body returned %d", status)
+	}
+	req = signedTestRequest(t, http.MethodPost, base+"/submit", blk.Marshal(), id)
+	req.Header.Set("Content-Type", MEDIA_BINARY)
+	if status, code := sendTestRequest(t, req); status != http.StatusOK {
+		t.Errorf("signed submission returned %d %s", status, code)
+	}
+	replay, _ := http.NewRequest(http.MethodPost, base+"/submit", bytes.NewReader(blk.Marshal()))
+	replay.Header = req.Header.Clone()
+	if status, code := sendTestRequest(t, replay); status != http.StatusUnauthorized || code != ERROR_UNAUTHORIZED {
+		t.Errorf("replayed submission returned %d %s", status, code)
+	}
+
+	// the signer must be a known identity
+	req = signedTestRequest(t, http.MethodGet, base+"/tip", nil, identitytest.Identity("stranger"))
+	if status, _ := sendTestRequest(t, req); status != http.StatusUnauthorized {
+		t.Errorf("request signed by a stranger returned %d", status)
+	}
+
+	// every request must be signed without public reads
+	n.config.PublicReads = false
+	if status, _ := testGet(t, base+"/tip"); status != http.StatusUnauthorized {
+		t.Errorf("unsigned read returned %d without public reads", status)
+	}
+	if status, code := sendTestRequest(t, signedTestRequest(t, http.MethodGet, base+"/tip", nil, id)); status != http.StatusOK {
+		t.Errorf("signed read returned %d %s", status, code)
+	}
+}
+
+func TestAuthTimestamp(t *testing.T) {
+	id := identitytest.Identity("main")
+	n := New()
+	n.setConfig(testConfig(t))
+	if err := n.Add("auth", chaintest.NewChain(t, "auth", id)); err != nil {
+		t.Fatal(err)
+	}
+	req := signedTestRequest(t, http.MethodGet, "http://node"+API_PREFIX+"/chains/auth/tip", nil, id)
+	for _, now := range []time.Time{time.Now().Add(-2 * AUTH_MAX_SKEW), time.Now().Add(2 * AUTH_MAX_SKEW)} {
+		if _, err := n.verifyRequest(req, nil, now); err == nil || !strings.Contains(err.Error(), "clock") {
+			t.Errorf("request signed %s away from the node's clock was accepted (%v)", time.Until(now).Round(time.Minute), err)
+		}
+	}
+	if _, err := n.verifyRequest(req, nil, time.Now()); err != nil {
+		t.Errorf("request was refused (%s)", err)
+	}
+}
+
+func TestAuthKnownIdentity(t *testing.T) {
+	main, bar, other, client := identitytest.Identity("main"), identitytest.Identity("bar"), identitytest.Identity("other"), identitytest.Identity("client")
+	bc_a := chaintest.NewChain(t, "known-a", main, transaction.NewTx_Permission(1, bar.GetPubBytes()))
+	n := New()
+	n.setConfig(testConfig(t))
+	n.config.RequireAuth = true
+	n.client_keys = [][]byte{client.GetPubBytes()}
+	if err := n.Add("known-a", bc_a); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Add("known-b", chaintest.NewChain(t, "known-b", other)); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(n.Handler())
+	t.Cleanup(server.Close)
+	url := func(label string) string { return server.URL + API_PREFIX + "/chains/" + label + "/tip" }
+
+	// validators are only known to their own chain, client identities to every chain
+	cases := []struct {
+		signer identity.Signer
+		label  string
+		status int
+	}{
+		{main, "known-a", http.StatusOK},
+		{main, "known-b", http.StatusUnauthorized},
+		{other, "known-b", http.StatusOK},
+		{other, "known-a", http.StatusUnauthorized},
+		{bar, "known-a", http.StatusOK},
+		{client, "known-a", http.StatusOK},
+		{client, "known-b", http.StatusOK},
+	}
+	for _, c := range cases {
+		if status, code := sendTestRequest(t, signedTestRequest(t, http.MethodGet, url(c.label), nil, c.signer)); status != c.status {
+			t.Errorf("request to %s signed by %s returned %d %s, expected %d", c.label, c.signer.(identity.Identity).Label(), status, code, c.status)
+		}
+	}
+
+	// a validator whose allowance ran out isn't known anymore
+	next := chaintest.NewBlock(t, &bc_a, transaction.NewTx_Entry([]byte("last")), bar)
+	req := signedTestRequest(t, http.MethodPost, server.URL+API_PREFIX+"/chains/known-a/submit", next.Marshal(), bar)
+	req.Header.Set("Content-Type", MEDIA_BINARY)
+	if status, code := sendTestRequest(t, req); status != http.StatusOK {
+		t.Fatalf("submission by bar returned %d %s", status, code)
+	}
+	if status, _ := sendTestRequest(t, signedTestRequest(t, http.MethodGet, url("known-a"), nil, bar)); status != http.StatusUnauthorized {
+		t.Errorf("validator without an allowance was accepted (%d)", status)
+	}
+}
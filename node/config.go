@@ -0,0 +1,239 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"reddchain/block"
+	"reddchain/chain"
+	"reddchain/identity"
+)
+
+// defaults for a node's configuration
+const (
+	DEFAULT_LISTEN_ADDR   string        = ":8090"
+	DEFAULT_DATA_DIR      string        = "data"
+	DEFAULT_READ_TIMEOUT  time.Duration = 30 * time.Second
+	DEFAULT_WRITE_TIMEOUT time.Duration = time.Minute
+	DEFAULT_IDLE_TIMEOUT  time.Duration = 2 * time.Minute
+	DEFAULT_LOG_LEVEL     string        = "info"
+	DEFAULT_RATE_BURST    int           = 20
+	DEFAULT_MAX_BLOB_SIZE int64         = 1 << 30
+
+	// a submitted block is at most twice the largest block once hex-encoded,
+	// with some room for the json envelope and whitespace around it
+	DEFAULT_MAX_SUBMIT_SIZE int64 = 2*int64(block.BLOCK_MAX_SIZE) + 1024
+)
+
+// the log levels a node can be configured with
+var LOG_LEVELS = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// a node's configuration, read from a json file and overridden by the flags of the serve command
+// fields left out of the file keep their defaults
+type Config struct {
+	Listen        string   `json:"listen"`             // address to listen on, host:port
+	DataDir       string   `json:"data_dir"`           // directory holding the keystore, chains, blocks and blobs
+	Chains        []string `json:"chains"`             // labels of the chains to serve
+	Identity      string   `json:"identity,omitempty"` // keystore identity or PEM public key file the node is known by
+	Peers         []string `json:"peers,omitempty"`    // base urls of the other nodes of the network
+	MaxSubmitSize int64    `json:"max_submit_size"`    // largest body of a submit request, in bytes
+	MaxBlobSize   int64    `json:"max_blob_size"`      // largest blob that can be uploaded, in bytes
+	ReadTimeout   Duration `json:"read_timeout"`       // zero means no timeout
+	WriteTimeout  Duration `json:"write_timeout"`
+	IdleTimeout   Duration `json:"idle_timeout"`
+	LogLevel      string   `json:"log_level"` // one of LOG_LEVELS
+
+	// tls is off unless a certificate is given, and mutual tls is off unless a client CA is given
+	// clients must then present a certificate from the CA for the key of an identity known to the chain a request is for:
+	// the node's identity, one of the client identities, or a validator with an allowance left on that chain
+	TLSCert          string   `json:"tls_cert,omitempty"`          // PEM certificate chain of the node
+	TLSKey           string   `json:"tls_key,omitempty"`           // PEM private key of the certificate
+	ClientCA         string   `json:"client_ca,omitempty"`         // PEM bundle of the CAs client certificates are issued by
+	ClientIdentities []string `json:"client_identities,omitempty"` // identities or PEM public key files allowed besides the validators
+
+	// requests signed with the key of a known identity are always checked, unsigned requests are refused
+	// if authentication is required, except for GET and HEAD requests if reads are public
+	RequireAuth bool `json:"require_auth,omitempty"`
+	PublicReads bool `json:"public_reads,omitempty"`
+
+	// requests over a rate limit are refused with a 429, a rate of zero means no limit
+	RateLimit         float64 `json:"rate_limit,omitempty"`          // requests per second from each client address
+	IdentityRateLimit float64 `json:"identity_rate_limit,omitempty"` // requests per second from each identity
+	RateBurst         int     `json:"rate_burst"`                    // requests a client or identity can make at once
+}
+
+// a time.Duration written as a string such as "30s" in config files
+// it's also a flag.Value, so it can be set by a command line flag
+type Duration time.Duration
+
+func (d *Duration) String() string {
+	return time.Duration(*d).String()
+}
+
+func (d *Duration) Set(s string) error {
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return errors.New("durations are strings such as \"30s\"")
+	}
+	return d.Set(s)
+}
+
+// returns the configuration of a node serving the main chain from ./data
+func DefaultConfig() Config {
+	return Config{
+		Listen:        DEFAULT_LISTEN_ADDR,
+		DataDir:       DEFAULT_DATA_DIR,
+		Chains:        []string{chain.MAIN_CHAIN_NAME},
+		MaxSubmitSize: DEFAULT_MAX_SUBMIT_SIZE,
+		MaxBlobSize:   DEFAULT_MAX_BLOB_SIZE,
+		ReadTimeout:   Duration(DEFAULT_READ_TIMEOUT),
+		WriteTimeout:  Duration(DEFAULT_WRITE_TIMEOUT),
+		IdleTimeout:   Duration(DEFAULT_IDLE_TIMEOUT),
+		LogLevel:      DEFAULT_LOG_LEVEL,
+		RateBurst:     DEFAULT_RATE_BURST,
+	}
+}
+
+// reads a config file over cfg, usually DefaultConfig()
+// the configuration isn't validated, so flags can still override it
+func ReadConfig(fname string, cfg Config) (Config, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return cfg, err
+	}
+	defer f.Close()
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("config file %s: %w", fname, err)
+	}
+	return cfg, nil
+}
+
+// checks that the configuration can be used to run a node
+func (cfg *Config) Validate() error {
+	host, port, err := net.SplitHostPort(cfg.Listen)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %q: %w", cfg.Listen, err)
+	}
+	if _, err := net.LookupPort("tcp", port); err != nil || strings.ContainsAny(host, "/ ") {
+		return fmt.Errorf("invalid listen address %q", cfg.Listen)
+	}
+	if cfg.DataDir == "" {
+		return errors.New("the data directory can't be empty")
+	}
+
+	if len(cfg.Chains) == 0 {
+		return errors.New("at least one chain must be served")
+	}
+	seen := make(map[string]bool)
+	for _, label := range cfg.Chains {
+		if !chain.ValidChainLabel(label) {
+			return fmt.Errorf("invalid chain label %q", label)
+		}
+		if seen[label] {
+			return fmt.Errorf("chain %s is listed twice", label)
+		}
+		seen[label] = true
+	}
+
+	for _, peer := range cfg.Peers {
+		u, err := url.Parse(peer)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid peer url %q", peer)
+		}
+	}
+
+	if cfg.MaxSubmitSize <= 0 {
+		return errors.New("the largest submit request must be positive")
+	}
+	if cfg.MaxBlobSize <= 0 {
+		return errors.New("the largest blob must be positive")
+	}
+	if cfg.ReadTimeout < 0 || cfg.WriteTimeout < 0 || cfg.IdleTimeout < 0 {
+		return errors.New("timeouts can't be negative")
+	}
+	if _, ok := LOG_LEVELS[cfg.LogLevel]; !ok {
+		return fmt.Errorf("invalid log level %q, use debug, info, warn or error", cfg.LogLevel)
+	}
+
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return errors.New("a tls certificate and its key must be given together")
+	}
+	if cfg.ClientCA != "" && cfg.TLSCert == "" {
+		return errors.New("mutual tls needs a tls certificate for the node")
+	}
+	if cfg.RateLimit < 0 || cfg.IdentityRateLimit < 0 || math.IsNaN(cfg.RateLimit) || math.IsNaN(cfg.IdentityRateLimit) {
+		return errors.New("rate limits can't be negative")
+	}
+	if cfg.RateBurst < 1 {
+		return errors.New("the rate burst must be at least 1")
+	}
+	if cfg.PublicReads && !cfg.RequireAuth {
+		return errors.New("public reads only apply when authentication is required")
+	}
+	return nil
+}
+
+// creates a node from its configuration, loading the node's identity and chains from its data directory
+func NewFromConfig(cfg Config) (*Node, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	keystore := identity.NewKeystore(cfg.DataDir)
+	n := New()
+	n.setConfig(cfg)
+	n.logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: LOG_LEVELS[cfg.LogLevel]}))
+	if cfg.Identity != "" {
+		pub, err := keystore.ResolvePublicKey(cfg.Identity)
+		if err != nil {
+			return nil, fmt.Errorf("node identity: %w", err)
+		}
+		n.identity = pub
+	}
+	for _, name := range cfg.ClientIdentities {
+		pub, err := keystore.ResolvePublicKey(name)
+		if err != nil {
+			return nil, fmt.Errorf("client identity %s: %w", name, err)
+		}
+		n.client_keys = append(n.client_keys, pub)
+	}
+	tls_config, err := loadTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	n.tls_config = tls_config
+	for _, label := range cfg.Chains {
+		if err := n.Load(label); err != nil {
+			return nil, fmt.Errorf("chain %s: %w", label, err)
+		}
+	}
+	return n, nil
+}
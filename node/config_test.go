@@ -0,0 +1,179 @@
+package node
+
+import (
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"reddchain/chain"
+	"reddchain/chain/chaintest"
+	"reddchain/identity/identitytest"
+	"reddchain/transaction"
+)
+
+func TestConfigFile(t *testing.T) {
+	fname := path.Join(t.TempDir(), "node.json")
+	data := `{"listen": "127.0.0.1:9100", "chains": ["foo", "bar"], "read_timeout": "5s", "log_level": "debug"}`
+	if err := os.WriteFile(fname, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := ReadConfig(fname, DefaultConfig())
+	if err != nil {
+		t.Fatalf("error reading config (%s)", err)
+	}
+	if cfg.Listen != "127.0.0.1:9100" || len(cfg.Chains) != 2 || time.Duration(cfg.ReadTimeout) != 5*time.Second || cfg.LogLevel != "debug" {
+		t.Errorf("config file wasn't read: %+v", cfg)
+	}
+	if cfg.DataDir != DEFAULT_DATA_DIR || cfg.MaxSubmitSize != DEFAULT_MAX_SUBMIT_SIZE || time.Duration(cfg.IdleTimeout) != DEFAULT_IDLE_TIMEOUT {
+		t.Errorf("fields left out of the config file lost their defaults: %+v", cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("valid config was refused (%s)", err)
+	}
+
+	for _, data := range []string{`{"listen": ":8090", "port": 8090}`, `{"read_timeout": 5}`, `{"read_timeout": "soon"}`} {
+		if err := os.WriteFile(fname, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadConfig(fname, DefaultConfig()); err == nil {
+			t.Errorf("config file %s was read", data)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	cases := map[string]func(cfg *Config){
+		"listen address":  func(cfg *Config) { cfg.Listen = "8090" },
+		"listen port":     func(cfg *Config) { cfg.Listen = ":http-ish" },
+		"data dir":        func(cfg *Config) { cfg.DataDir = "" },
+		"no chains":       func(cfg *Config) { cfg.Chains = nil },
+		"chain label":     func(cfg *Config) { cfg.Chains = []string{"Main"} },
+		"duplicate chain": func(cfg *Config) { cfg.Chains = []string{"main", "main"} },
+		"peer url":        func(cfg *Config) { cfg.Peers = []string{"localhost:8090"} },
+		"submit size":     func(cfg *Config) { cfg.MaxSubmitSize = 0 },
+		"blob size":       func(cfg *Config) { cfg.MaxBlobSize = 0 },
+		"timeout":         func(cfg *Config) { cfg.WriteTimeout = Duration(-time.Second) },
+		"log level":       func(cfg *Config) { cfg.LogLevel = "verbose" },
+		"tls key":         func(cfg *Config) { cfg.TLSCert = "node.pem" },
+		"tls certificate": func(cfg *Config) { cfg.ClientCA = "ca.pem" },
+		"public reads":    func(cfg *Config) { cfg.PublicReads = true },
+		"rate limit":      func(cfg *Config) { cfg.IdentityRateLimit = -1 },
+		"rate burst":      func(cfg *Config) { cfg.RateBurst = 0 },
+	}
+	for name, change := range cases {
+		cfg := DefaultConfig()
+		change(&cfg)
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("config with an invalid %s was accepted", name)
+		}
+	}
+}
+
+// starts a node from its configuration on a free port, returning its base url
+func startTestNode(t *testing.T, cfg Config) (*Node, string) {
+	n, err := NewFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("error creating node (%s)", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := n.Server(ln.Addr().String())
+	go server.Serve(ln)
+	t.Cleanup(func() { server.Close() })
+	return n, "http://" + ln.Addr().String()
+}
+
+// saves the genesis file of a new chain in the data directory dir
+func saveTestChain(t *testing.T, dir string, label string) {
+	gf := chaintest.Genesis(t, label, identitytest.Identity("main"))
+	if err := gf.Save(dir); err != nil {
+		t.Fatalf("error saving genesis file (%s)", err)
+	}
+}
+
+func TestConfigSideBySide(t *testing.T) {
+	dir_a, dir_b := t.TempDir(), t.TempDir()
+
+	// both data directories have a chain named shared, with different genesis blocks
+	saveTestChain(t, dir_a, "shared")
+	saveTestChain(t, dir_a, "alpha")
+	saveTestChain(t, dir_b, "shared")
+
+	cfg := DefaultConfig()
+	cfg.Listen, cfg.DataDir, cfg.Chains = "127.0.0.1:0", dir_a, []string{"alpha", "shared"}
+	a, url_a := startTestNode(t, cfg)
+	cfg.DataDir, cfg.Chains, cfg.Peers = dir_b, []string{"shared"}, []string{url_a}
+	b, url_b := startTestNode(t, cfg)
+	if _, err := os.Stat(path.Join(dir_b, "blockchains", "shared.json")); err != nil {
+		t.Errorf("chain wasn't created in the node's data directory (%s)", err)
+	}
+
+	// each node serves its own chains
+	status, body := testGet(t, url_a+API_PREFIX+"/chains/alpha/tip")
+	if status != http.StatusOK {
+		t.Errorf("first node didn't serve alpha (%d %s)", status, body)
+	}
+	status, _ = testGet(t, url_b+API_PREFIX+"/chains/alpha/tip")
+	if status != http.StatusNotFound {
+		t.Errorf("second node served alpha (%d)", status)
+	}
+	var info APINode
+	_, body = testGet(t, url_b+API_PREFIX+"/node")
+	decodeAPIResponse(t, []byte(body), &info)
+	if len(info.Peers) != 1 || info.Peers[0] != url_a || len(info.Chains) != 1 {
+		t.Errorf("second node reported %s", body)
+	}
+
+	// a block submitted to each node is saved in that node's data directory only
+	for dir, url := range map[string]string{dir_a: url_a, dir_b: url_b} {
+		bc, err := chain.LoadChain(dir, "shared")
+		if err != nil {
+			t.Fatalf("error loading chain from %s (%s)", dir, err)
+		}
+		blk := chaintest.NewBlock(t, &bc, transaction.NewTx_Entry([]byte(dir)), identitytest.Identity("main"))
+		resp, body := testAPIRequest(t, http.MethodPost, url+API_PREFIX+"/chains/shared/submit", map[string]string{"Content-Type": MEDIA_BINARY}, blk.Marshal())
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("error submitting block to %s (%d %s)", url, resp.StatusCode, body)
+		}
+		fname := hex.EncodeToString(blk.GetHash()) + ".dat"
+		for _, other := range []string{dir_a, dir_b} {
+			_, err := os.Stat(path.Join(other, chain.BLOCKS_DIR, fname))
+			if other == dir && err != nil {
+				t.Errorf("block submitted to %s wasn't saved in its data directory (%s)", url, err)
+			} else if other != dir && err == nil {
+				t.Errorf("block submitted to %s was saved in %s", url, other)
+			}
+		}
+		if loaded, err := chain.LoadChain(dir, "shared"); err != nil || loaded.Height() != 1 {
+			t.Errorf("chain in %s wasn't saved with the submitted block (%v)", dir, err)
+		}
+	}
+
+	// the peers don't agree on the genesis of their shared chain, so the second node refuses the first
+	http_client := &http.Client{Timeout: PEER_TIMEOUT}
+	if _, err := b.checkPeer(http_client, url_a); !errors.Is(err, ErrPeerGenesisMismatch) || !strings.Contains(err.Error(), "shared") {
+		t.Errorf("peer with a different genesis passed the check (%v)", err)
+	}
+	b.checkPeers()
+	info = APINode{}
+	_, body = testGet(t, url_b+API_PREFIX+"/node")
+	decodeAPIResponse(t, []byte(body), &info)
+	if len(info.Peers) != 0 || len(info.RefusedPeers) != 1 || info.RefusedPeers[0] != url_a || len(b.Peers()) != 0 {
+		t.Errorf("second node didn't refuse the first, reported %s", body)
+	}
+	shared, err := a.checkPeer(http_client, url_a)
+	if err != nil || len(shared) != 2 {
+		t.Errorf("node checking itself returned %v %v", shared, err)
+	}
+	if _, err := a.checkPeer(http_client, "http://127.0.0.1:1"); err == nil {
+		t.Errorf("unreachable peer passed the check")
+	}
+}
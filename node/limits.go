@@ -0,0 +1,214 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	"reddchain/blob"
+)
+
+// a token bucket of a client or identity, refilled at the limiter's rate
+type bucket_t struct {
+	tokens  float64
+	updated time.Time
+}
+
+// limits the rate of requests from each client address or identity
+// a rate of zero means no limit
+type rate_limiter_t struct {
+	lock    sync.Mutex
+	rate    float64 // requests per second
+	burst   float64 // requests that can be made at once
+	buckets map[string]*bucket_t
+	pruned  time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rate_limiter_t {
+	return &rate_limiter_t{rate: rate, burst: float64(burst), buckets: make(map[string]*bucket_t)}
+}
+
+// takes a token for a request from key
+// returns zero if the request is allowed, or how long until it would be
+func (l *rate_limiter_t) take(key string, now time.Time) time.Duration {
+	if l.rate <= 0 {
+		return 0
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	// buckets that have refilled are the same as new ones, so they are forgotten
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.pruned) > refill {
+		for k, b := range l.buckets {
+			if now.Sub(b.updated) > refill {
+				delete(l.buckets, k)
+			}
+		}
+		l.pruned = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket_t{tokens: l.burst, updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	b.updated = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return 0
+}
+
+// counts the requests a node served and the ones it rejected
+type metrics_t struct {
+	lock         sync.Mutex
+	requests     uint64
+	rejected     map[int]uint64    // by http status
+	rate_limited map[string]uint64 // by the limit that was hit, "client" or "identity"
+	panics       uint64
+}
+
+// the counts of the metrics endpoint
+type APIMetrics struct {
+	Requests    uint64            `json:"requests"`
+	Rejected    map[string]uint64 `json:"rejected"`     // requests answered with a 4xx or 5xx status, by status
+	RateLimited map[string]uint64 `json:"rate_limited"` // requests refused by the client or identity rate limit
+	Panics      uint64            `json:"panics"`       // requests whose handler panicked
+}
+
+// records a served request and its status
+func (m *metrics_t) record(status int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.requests++
+	if status >= 400 {
+		if m.rejected == nil {
+			m.rejected = make(map[int]uint64)
+		}
+		m.rejected[status]++
+	}
+}
+
+func (m *metrics_t) recordRateLimited(limit string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.rate_limited == nil {
+		m.rate_limited = make(map[string]uint64)
+	}
+	m.rate_limited[limit]++
+}
+
+func (m *metrics_t) recordPanic() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.panics++
+}
+
+// returns a copy of the counts
+func (m *metrics_t) snapshot() APIMetrics {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	snapshot := APIMetrics{Requests: m.requests, Rejected: make(map[string]uint64), RateLimited: make(map[string]uint64), Panics: m.panics}
+	for status, count := range m.rejected {
+		snapshot.Rejected[strconv.Itoa(status)] = count
+	}
+	for limit, count := range m.rate_limited {
+		snapshot.RateLimited[limit] = count
+	}
+	return snapshot
+}
+
+// writes the node's request metrics
+func (n *Node) apiMetrics(w http.ResponseWriter, req *http.Request) {
+	if !allowMethods(w, req, http.MethodGet, http.MethodHead) {
+		return
+	}
+	writeData(w, http.StatusOK, nil, n.metrics.snapshot())
+}
+
+// the largest body of a request the node accepts: a submitted block, which is at most DEFAULT_MAX_SUBMIT_SIZE by default, or a blob chunk
+func (n *Node) maxBodySize() int64 {
+	return max(n.config.MaxSubmitSize, blob.BLOB_CHUNK_SIZE)
+}
+
+// refuses a request that is over a rate limit, returning false
+func (n *Node) checkRate(w http.ResponseWriter, limiter *rate_limiter_t, limit string, key string) bool {
+	wait := limiter.take(key, time.Now())
+	if wait == 0 {
+		return true
+	}
+	n.metrics.recordRateLimited(limit)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	writeError(w, http.StatusTooManyRequests, ERROR_RATE_LIMITED, fmt.Sprintf("too many requests from this %s, retry in %s", limit, wait.Round(time.Millisecond)))
+	return false
+}
+
+// refuses requests from client addresses over the rate limit, and bodies larger than any request needs
+// the body is limited before it's read, so a large body is refused without reading it whole
+func (n *Node) limitClients(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		host, _, err := net.SplitHostPort(req.RemoteAddr)
+		if err != nil {
+			host = req.RemoteAddr
+		}
+		if !n.checkRate(w, n.client_limiter, "client", host) {
+			return
+		}
+		if req.ContentLength > n.maxBodySize() {
+			writeError(w, http.StatusRequestEntityTooLarge, ERROR_TOO_LARGE, fmt.Sprintf("body is larger than %d bytes", n.maxBodySize()))
+			return
+		}
+		req.Body = http.MaxBytesReader(w, req.Body, n.maxBodySize())
+		handler.ServeHTTP(w, req)
+	})
+}
+
+// refuses requests from identities over the rate limit
+// requests come from an identity when they are signed or made with a client certificate
+func (n *Node) limitIdentities(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if key := ClientKey(req); key != nil && !n.checkRate(w, n.identity_limiter, "identity", string(key)) {
+			return
+		}
+		handler.ServeHTTP(w, req)
+	})
+}
+
+// turns a panic in a handler into an error response, so a bad request can't bring the node down
+// a body over the size limit is a 413, anything else is a 500
+func (n *Node) recoverPanics(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		sw := &status_writer_t{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			n.metrics.recordPanic()
+			n.logger.Error("panic serving request", "method", req.Method, "path", req.URL.Path, "panic", v, "stack", string(debug.Stack()))
+			if sw.status != 0 {
+				// the response has started, so the connection is dropped instead
+				panic(http.ErrAbortHandler)
+			}
+			var too_large *http.MaxBytesError
+			if err, ok := v.(error); ok && errors.As(err, &too_large) {
+				writeError(sw, http.StatusRequestEntityTooLarge, ERROR_TOO_LARGE, err.Error())
+				return
+			}
+			writeError(sw, http.StatusInternalServerError, ERROR_INTERNAL, "the node failed to serve the request")
+		}()
+		handler.ServeHTTP(sw, req)
+	})
+}
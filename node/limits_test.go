@@ -0,0 +1,115 @@
+package node
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"reddchain/chain/chaintest"
+	"reddchain/identity/identitytest"
+	"reddchain/transaction"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(2, 3)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if wait := l.take("a", now); wait != 0 {
+			t.Fatalf("request %d of the burst had to wait %s", i, wait)
+		}
+	}
+	if wait := l.take("a", now); wait != 500*time.Millisecond {
+		t.Errorf("request after the burst had to wait %s", wait)
+	}
+	if wait := l.take("b", now); wait != 0 {
+		t.Errorf("another key had to wait %s", wait)
+	}
+	if wait := l.take("a", now.Add(500*time.Millisecond)); wait != 0 {
+		t.Errorf("refilled bucket had to wait %s", wait)
+	}
+	if wait := newRateLimiter(0, 1).take("a", now); wait != 0 {
+		t.Errorf("unlimited rate had to wait %s", wait)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	id := identitytest.Identity("main")
+	bc := chaintest.NewChain(t, "limits", id)
+	n := New()
+	cfg := testConfig(t)
+	cfg.RateLimit, cfg.IdentityRateLimit, cfg.RateBurst = 0.001, 0.001, 2
+	n.setConfig(cfg)
+	n.logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	if err := n.Add("limits", bc); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(n.Handler())
+	t.Cleanup(server.Close)
+	base := server.URL + API_PREFIX + "/chains/limits"
+
+	// bodies over the limit are refused before they are read
+	big := bytes.Repeat([]byte("a"), int(n.maxBodySize())+1)
+	req, _ := http.NewRequest(http.MethodPost, base+"/submit", bytes.NewReader(big))
+	if status, code := sendTestRequest(t, req); status != http.StatusRequestEntityTooLarge || code != ERROR_TOO_LARGE {
+		t.Errorf("large body returned %d %s", status, code)
+	}
+
+	// the burst is used up by the first two requests
+	if resp, _ := testAPIRequest(t, http.MethodGet, base+"/tip", nil, nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("request within the burst returned %d", resp.StatusCode)
+	}
+	resp, _ := testAPIRequest(t, http.MethodGet, base+"/tip", nil, nil)
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("request over the client rate limit returned %d", resp.StatusCode)
+	}
+
+	// identities are limited separately from their addresses
+	n.client_limiter = newRateLimiter(0, 1)
+	blk := chaintest.NewBlock(t, &bc, transaction.NewTx_Entry([]byte("limited")), id)
+	for i, status := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		req := signedTestRequest(t, http.MethodGet, base+"/tip", nil, id)
+		if i == 1 {
+			req = signedTestRequest(t, http.MethodPost, base+"/submit", blk.Marshal(), id)
+			req.Header.Set("Content-Type", MEDIA_BINARY)
+		}
+		if got, code := sendTestRequest(t, req); got != status {
+			t.Errorf("signed request %d returned %d %s, expected %d", i, got, code, status)
+		}
+	}
+
+	var metrics APIMetrics
+	_, body := testAPIRequest(t, http.MethodGet, server.URL+API_PREFIX+"/metrics", nil, nil)
+	decodeAPIResponse(t, body, &metrics)
+	if metrics.Requests != 6 || metrics.Rejected["413"] != 1 || metrics.Rejected["429"] != 2 || metrics.RateLimited["client"] != 1 || metrics.RateLimited["identity"] != 1 {
+		t.Errorf("wrong metrics %s", body)
+	}
+}
+
+func TestRecoverPanics(t *testing.T) {
+	n := New()
+	n.logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	handler := n.recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/large" {
+			io.ReadAll(http.MaxBytesReader(w, req.Body, 1))
+			var err error = &http.MaxBytesError{Limit: 1}
+			panic(err)
+		}
+		var b []byte
+		_ = b[len(req.URL.Path)]
+	}))
+	for path, status := range map[string]int{"/index": http.StatusInternalServerError, "/large": http.StatusRequestEntityTooLarge} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewReader([]byte("body"))))
+		envelope := decodeAPIResponse(t, w.Body.Bytes(), nil)
+		if w.Code != status || envelope.Error == nil {
+			t.Errorf("panic on %s returned %d %s", path, w.Code, w.Body)
+		}
+	}
+	if metrics := n.metrics.snapshot(); metrics.Panics != 2 {
+		t.Errorf("counted %d panics", metrics.Panics)
+	}
+}
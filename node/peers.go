@@ -0,0 +1,102 @@
+package node
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// how long a node waits for a peer when checking it
+const PEER_TIMEOUT time.Duration = 5 * time.Second
+
+// a peer serving one of the node's chains with a different genesis block is refused
+var ErrPeerGenesisMismatch = errors.New("peer has a different genesis block")
+
+// returns the base urls of the node's peers, leaving out the ones that were refused
+func (n *Node) Peers() []string {
+	n.peers_lock.Lock()
+	defer n.peers_lock.Unlock()
+	peers := []string{}
+	for _, peer := range n.config.Peers {
+		if _, refused := n.refused_peers[peer]; !refused {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
+
+// returns the base urls of the peers the node refused, sorted
+func (n *Node) RefusedPeers() []string {
+	n.peers_lock.Lock()
+	defer n.peers_lock.Unlock()
+	refused := []string{}
+	for peer := range n.refused_peers {
+		refused = append(refused, peer)
+	}
+	sort.Strings(refused)
+	return refused
+}
+
+// checks that each peer serves the node's chains with the same genesis blocks, refusing the ones that don't
+// peers may start after the node, so a peer that can't be reached only produces a warning
+func (n *Node) checkPeers() {
+	http_client := &http.Client{Timeout: PEER_TIMEOUT}
+	for _, peer := range n.config.Peers {
+		shared, err := n.checkPeer(http_client, peer)
+		if errors.Is(err, ErrPeerGenesisMismatch) {
+			n.logger.Error("refusing peer", "peer", peer, "err", err)
+			n.peers_lock.Lock()
+			if n.refused_peers == nil {
+				n.refused_peers = make(map[string]error)
+			}
+			n.refused_peers[peer] = err
+			n.peers_lock.Unlock()
+		} else if err != nil {
+			n.logger.Warn("peer check failed", "peer", peer, "err", err)
+		} else {
+			n.logger.Info("peer checked", "peer", peer, "shared_chains", shared)
+		}
+	}
+}
+
+// checks the genesis blocks of the chains a peer shares with the node
+// returns the labels of the shared chains
+func (n *Node) checkPeer(http_client *http.Client, peer string) ([]string, error) {
+	resp, err := http_client.Get(strings.TrimRight(peer, "/") + API_PREFIX + "/chains")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var envelope APIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return nil, fmt.Errorf("peer returned %d without an api response", resp.StatusCode)
+	}
+	if envelope.Error != nil {
+		return nil, envelope.Error
+	}
+	var list []APIChain
+	if err := json.Unmarshal(envelope.Data, &list); err != nil {
+		return nil, err
+	}
+
+	shared := []string{}
+	for _, info := range list {
+		served, ok := n.chains[info.Label]
+		if !ok {
+			continue
+		}
+		served.lock.RLock()
+		genesis := hex.EncodeToString(served.bc.GetGenesisHash())
+		served.lock.RUnlock()
+		if !strings.EqualFold(info.Genesis, genesis) {
+			return shared, fmt.Errorf("%w: peer's chain %s has genesis %s, this node's has %s", ErrPeerGenesisMismatch, info.Label, info.Genesis, genesis)
+		}
+		shared = append(shared, info.Label)
+	}
+	return shared, nil
+}
@@ -0,0 +1,691 @@
+// Package node serves chains over HTTP.
+// A Node can be run on its own by the command binary, or embedded in another program through Handler.
+package node
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"reddchain/blob"
+	"reddchain/block"
+	"reddchain/chain"
+)
+
+const (
+	GENESIS_HEADER string = "X-Genesis-Hash" // the genesis block a request expects
+	TIP_HEADER     string = "X-Tip-Hash"     // the tip a response belongs to
+)
+
+// a node serving one or more chains
+type Node struct {
+	chains   map[string]*served_chain_t
+	config   Config
+	logger   *slog.Logger
+	identity []byte      // public key the node is known by, nil if it wasn't configured
+	blobs    *blob.Store // the blob store of the data directory
+
+	tls_config  *tls.Config // nil if the node serves plain http
+	client_keys [][]byte    // public keys allowed to connect with mutual tls or sign requests besides the validators
+	nonces      nonce_cache_t
+
+	peers_lock    sync.Mutex
+	refused_peers map[string]error // peers that failed the genesis check, by base url
+
+	client_limiter   *rate_limiter_t // requests from each client address
+	identity_limiter *rate_limiter_t // requests from each identity
+	metrics          metrics_t
+}
+
+// a chain served by a node
+// requests are served concurrently, so handlers must hold the lock while using the chain
+type served_chain_t struct {
+	lock            sync.RWMutex
+	bc              chain.Blockchain
+	max_submit_size int64
+	appended        chan struct{} // closed and replaced when a block is appended, to wake subscriptions
+}
+
+// handles a request for a particular chain
+type chainHandlerFunc func(w http.ResponseWriter, req *http.Request, served *served_chain_t)
+
+// endpoints available under /chains/<label>/
+var chainHandlers = map[string]chainHandlerFunc{
+	"tip":        tip,
+	"submit":     submit,
+	"state":      state,
+	"validators": validators,
+	"proof":      proof,
+	"block":      getBlock,
+	"blocks":     blocks,
+	"genesis":    genesis,
+}
+
+// creates a node that doesn't serve any chains yet, with the default configuration
+func New() *Node {
+	n := &Node{chains: make(map[string]*served_chain_t), logger: slog.Default()}
+	n.setConfig(DefaultConfig())
+	return n
+}
+
+// sets the configuration of a node and the limits that come with it
+func (n *Node) setConfig(cfg Config) {
+	n.config = cfg
+	n.blobs = blob.NewStore(cfg.DataDir, uint64(cfg.MaxBlobSize))
+	n.client_limiter = newRateLimiter(cfg.RateLimit, cfg.RateBurst)
+	n.identity_limiter = newRateLimiter(cfg.IdentityRateLimit, cfg.RateBurst)
+}
+
+// adds a chain that is already in memory to the chains served by the node
+// a chain that hasn't been saved yet is saved to the node's data directory, where appended blocks are saved too
+// chains must be added before the node starts serving requests
+func (n *Node) Add(label string, bc chain.Blockchain) error {
+	if !chain.ValidChainLabel(label) {
+		return fmt.Errorf("invalid chain label %q", label)
+	}
+	if _, ok := n.chains[label]; ok {
+		return fmt.Errorf("chain %s is already served", label)
+	}
+	if bc.Dir() == "" {
+		if err := bc.Save(n.config.DataDir); err != nil {
+			return err
+		}
+	}
+	n.chains[label] = &served_chain_t{bc: bc, max_submit_size: n.config.MaxSubmitSize, appended: make(chan struct{})}
+	return nil
+}
+
+// loads a chain from disk and adds it to the chains served by the node
+// a chain that doesn't exist yet is created from its genesis file
+// if the chain exists and has a genesis file, the two must have the same genesis block
+func (n *Node) Load(label string) error {
+	if !chain.ValidChainLabel(label) {
+		return fmt.Errorf("invalid chain label %q", label)
+	}
+
+	gf, gf_err := chain.LoadGenesisFile(n.config.DataDir, label)
+	if gf_err != nil && !errors.Is(gf_err, os.ErrNotExist) {
+		return gf_err
+	}
+
+	fname := path.Join(n.config.DataDir, chain.BLOCKCHAIN_DIR, label+".json")
+	if _, err := os.Stat(fname); errors.Is(err, os.ErrNotExist) {
+		if gf_err != nil {
+			return fmt.Errorf("chain %s has no genesis file, create one with bootstrap or copy it to %s", label, path.Join(n.config.DataDir, chain.GENESIS_DIR))
+		}
+		bc, err := chain.NewChainFromGenesis(n.config.DataDir, gf)
+		if err != nil {
+			return err
+		}
+		return n.Add(label, bc)
+	}
+
+	bc, err := chain.LoadChain(n.config.DataDir, label)
+	if err != nil {
+		return err
+	}
+	if gf_err == nil {
+		genesis, err := gf.Block()
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(bc.GetGenesisHash(), genesis.GetHash()) {
+			return fmt.Errorf("chain %s doesn't start with the block in its genesis file", label)
+		}
+	}
+	return n.Add(label, bc)
+}
+
+// returns the labels of the chains served by the node
+func (n *Node) Labels() []string {
+	labels := make([]string, 0, len(n.chains))
+	for label := range n.chains {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// serves the node's chains on addr until the server fails
+// the peers of the node are checked, and stale blob uploads expired, in the background
+func (n *Node) ListenAndServe(addr string) error {
+	n.logger.Info("serving", "addr", addr, "chains", n.Labels(), "data_dir", n.config.DataDir, "tls", n.TLSMode())
+	go n.checkPeers()
+	go n.expireUploads()
+	server := n.Server(addr)
+	if server.TLSConfig != nil {
+		return server.ListenAndServeTLS("", "")
+	}
+	return server.ListenAndServe()
+}
+
+// returns "off" if the node serves plain http, "mutual" if clients must present a certificate, "on" otherwise
+func (n *Node) TLSMode() string {
+	if n.tls_config == nil {
+		return "off"
+	}
+	if n.tls_config.ClientCAs != nil {
+		return "mutual"
+	}
+	return "on"
+}
+
+// returns a server for the node's chains on addr, with the timeouts and tls configuration of the node's configuration
+// a server with a TLSConfig must be started with ListenAndServeTLS or ServeTLS, without certificate files
+func (n *Node) Server(addr string) *http.Server {
+	server := &http.Server{
+		Addr:         addr,
+		Handler:      n.Handler(),
+		ReadTimeout:  time.Duration(n.config.ReadTimeout),
+		WriteTimeout: time.Duration(n.config.WriteTimeout),
+		IdleTimeout:  time.Duration(n.config.IdleTimeout),
+		ErrorLog:     slog.NewLogLogger(n.logger.Handler(), slog.LevelWarn),
+	}
+	if n.tls_config != nil {
+		server.TLSConfig = n.tls_config.Clone()
+	}
+	return server
+}
+
+// routes requests to the handlers for the node's chains
+// each chain is served under /chains/<label>/, and the main chain is also served at the root
+// the versioned json api is served the same way under API_PREFIX, the unversioned endpoints are kept for older clients
+func (n *Node) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", welcome)
+	mux.HandleFunc("/headers", headers)
+	mux.HandleFunc("/blob", n.serveBlob)
+	mux.HandleFunc("/chains", n.listChains)
+	mux.HandleFunc("/chains/", n.routeChain)
+	mux.HandleFunc(API_PREFIX+"/", n.routeAPI)
+	if _, ok := n.chains[chain.MAIN_CHAIN_NAME]; ok {
+		for endpoint, handler := range chainHandlers {
+			mux.HandleFunc("/"+endpoint, n.mainChainHandler(handler))
+		}
+	}
+	return n.logRequests(n.recoverPanics(n.limitClients(n.checkClientCert(n.authenticate(n.limitIdentities(mux))))))
+}
+
+// records the status of a response for the request log
+type status_writer_t struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *status_writer_t) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *status_writer_t) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// lets http.ResponseController reach the underlying writer
+func (w *status_writer_t) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// logs each request at the debug level, with its status and how long it took, and counts it in the node's metrics
+func (n *Node) logRequests(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		sw := &status_writer_t{ResponseWriter: w}
+		handler.ServeHTTP(sw, req)
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		n.metrics.record(sw.status)
+		n.logger.Debug("request", "method", req.Method, "path", req.URL.Path, "remote", req.RemoteAddr, "status", sw.status, "duration", time.Since(start))
+	})
+}
+
+// serves an endpoint of the main chain, for clients that don't name a chain
+func (n *Node) mainChainHandler(handler chainHandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		served := n.chains[chain.MAIN_CHAIN_NAME]
+		if !checkGenesisHeader(w, req, served) {
+			return
+		}
+		handler(w, req, served)
+	}
+}
+
+// routes /chains/<label>/<endpoint> to the handler for that endpoint
+// the blob store is shared by every chain, so /chains/<label>/blob is the same as /blob
+func (n *Node) routeChain(w http.ResponseWriter, req *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/chains/"), "/")
+	if len(parts) == 1 && parts[0] == "" {
+		n.listChains(w, req)
+		return
+	}
+	if len(parts) != 2 {
+		http.NotFound(w, req)
+		return
+	}
+
+	served, ok := n.chains[parts[0]]
+	if !ok {
+		http.Error(w, "unknown chain "+parts[0], http.StatusNotFound)
+		return
+	}
+	if parts[1] == "blob" {
+		n.serveBlob(w, req)
+		return
+	}
+	handler, ok := chainHandlers[parts[1]]
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	if !checkGenesisHeader(w, req, served) {
+		return
+	}
+	handler(w, req, served)
+}
+
+// refuses requests from nodes and clients that expect a different genesis block
+// requests declare the genesis they expect with the hex-encoded hash in GENESIS_HEADER
+// returns false if the request was refused
+func checkGenesisHeader(w http.ResponseWriter, req *http.Request, served *served_chain_t) bool {
+	actual, ok := genesisMatches(req, served)
+	if !ok {
+		http.Error(w, "genesis mismatch, this chain's genesis is "+actual, http.StatusConflict)
+	}
+	return ok
+}
+
+// returns the hex-encoded genesis hash of the chain, and false if the request expects a different one
+func genesisMatches(req *http.Request, served *served_chain_t) (string, bool) {
+	expected := req.Header.Get(GENESIS_HEADER)
+	served.lock.RLock()
+	actual := hex.EncodeToString(served.bc.GetGenesisHash())
+	served.lock.RUnlock()
+	return actual, expected == "" || strings.EqualFold(expected, actual)
+}
+
+// writes the chains served by this node as a json object of label -> genesis and tip hashes
+func (n *Node) listChains(w http.ResponseWriter, req *http.Request) {
+	resp := make(map[string]map[string]string)
+	for label, served := range n.chains {
+		served.lock.RLock()
+		resp[label] = map[string]string{
+			"genesis": hex.EncodeToString(served.bc.GetGenesisHash()),
+			"tip":     hex.EncodeToString(served.bc.GetTipHash()),
+		}
+		served.lock.RUnlock()
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func welcome(w http.ResponseWriter, req *http.Request) {
+	fmt.Fprintf(w, "Welcome  to my permissioned blockchain!\n")
+}
+
+func headers(w http.ResponseWriter, req *http.Request) {
+	for name, headers := range req.Header {
+		for _, h := range headers {
+			fmt.Fprintf(w, "%v: %v\n", name, h)
+		}
+	}
+}
+
+func tip(w http.ResponseWriter, req *http.Request, served *served_chain_t) {
+	served.lock.RLock()
+	defer served.lock.RUnlock()
+	fmt.Fprintf(w, "%x\n", served.bc.GetTipHash())
+}
+
+// writes the validator state at the tip as a json object of validator -> allowance
+// the tip's hash is reported in TIP_HEADER, so clients can tell which tip the state belongs to
+func state(w http.ResponseWriter, req *http.Request, served *served_chain_t) {
+	served.lock.RLock()
+	defer served.lock.RUnlock()
+	w.Header().Set(TIP_HEADER, hex.EncodeToString(served.bc.GetTipHash()))
+	json.NewEncoder(w).Encode(served.bc.GetValidators())
+}
+
+// a validator as listed by the validators endpoint
+type ValidatorInfo = chain.ValidatorInfo
+
+// writes the validators with their fingerprints and aliases, sorted by public key
+func validators(w http.ResponseWriter, req *http.Request, served *served_chain_t) {
+	served.lock.RLock()
+	defer served.lock.RUnlock()
+	json.NewEncoder(w).Encode(served.bc.ValidatorInfos())
+}
+
+// writes a proof that a validator's allowance is included in the state root of the tip
+// the validator is given as a hex-encoded public key in the query string
+func proof(w http.ResponseWriter, req *http.Request, served *served_chain_t) {
+	served.lock.RLock()
+	defer served.lock.RUnlock()
+	validator := req.URL.Query().Get("validator")
+	validators := served.bc.GetValidators()
+	steps, err := chain.StateProof(validators, validator)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	resp := map[string]interface{}{
+		"block":      hex.EncodeToString(served.bc.GetTipHash()),
+		"state_root": hex.EncodeToString(served.bc.GetStateRoot()),
+		"validator":  validator,
+		"allowance":  validators[validator],
+		"proof":      steps,
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// writes the chain's genesis file, so peers can check they share a genesis block
+func genesis(w http.ResponseWriter, req *http.Request, served *served_chain_t) {
+	served.lock.RLock()
+	gf, err := chain.GenesisFileFromBlock(served.bc.GetGenesisBlock())
+	genesis_hash := hex.EncodeToString(served.bc.GetGenesisHash())
+	served.lock.RUnlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(GENESIS_HEADER, genesis_hash)
+	json.NewEncoder(w).Encode(gf)
+}
+
+// writes the hex-encoded block with the hash or height given in the query string
+// the block's height is reported in X-Block-Height
+// responds with 410 Gone if the block's payload has been pruned
+func getBlock(w http.ResponseWriter, req *http.Request, served *served_chain_t) {
+	var blk block.Block
+	var height int
+	var err error
+	query := req.URL.Query()
+	if query.Has("height") {
+		height, err = strconv.Atoi(query.Get("height"))
+		if err != nil {
+			http.Error(w, "invalid height", http.StatusBadRequest)
+			return
+		}
+		served.lock.RLock()
+		blk, err = served.bc.GetBlockAt(height)
+		served.lock.RUnlock()
+	} else {
+		var hash []byte
+		hash, err = hex.DecodeString(query.Get("hash"))
+		if err != nil {
+			http.Error(w, "invalid hash", http.StatusBadRequest)
+			return
+		}
+		served.lock.RLock()
+		blk, height, err = served.bc.GetBlock(hash)
+		served.lock.RUnlock()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("X-Block-Height", strconv.Itoa(height))
+	if blk.IsPruned() {
+		w.Header().Set("X-Block-Status", "pruned")
+		w.WriteHeader(http.StatusGone)
+		fmt.Fprintf(w, "pruned %x\n", blk.MarshalHeader())
+		return
+	}
+	fmt.Fprintf(w, "%x\n", blk.Marshal())
+}
+
+// the most blocks returned by one request to the blocks endpoint
+const BLOCKS_MAX_COUNT int = 100
+
+// a block as listed by the blocks endpoint
+type BlockInfo struct {
+	Height int    `json:"height"`
+	Hash   string `json:"hash"`
+	Pruned bool   `json:"pruned,omitempty"`
+	Block  string `json:"block"` // hex-encoded block, or its header if the block has been pruned
+}
+
+// writes the blocks starting at the height given by from as a json list
+// at most count blocks are written, up to BLOCKS_MAX_COUNT
+func blocks(w http.ResponseWriter, req *http.Request, served *served_chain_t) {
+	query := req.URL.Query()
+	from, err := strconv.Atoi(query.Get("from"))
+	if err != nil || from < 0 {
+		http.Error(w, "invalid from", http.StatusBadRequest)
+		return
+	}
+	count := BLOCKS_MAX_COUNT
+	if query.Has("count") {
+		count, err = strconv.Atoi(query.Get("count"))
+		if err != nil || count < 0 {
+			http.Error(w, "invalid count", http.StatusBadRequest)
+			return
+		}
+		count = min(count, BLOCKS_MAX_COUNT)
+	}
+
+	served.lock.RLock()
+	list := []BlockInfo{}
+	for i := from; i < from+count && i <= served.bc.Height(); i++ {
+		blk, _ := served.bc.GetBlockAt(i)
+		info := BlockInfo{Height: i, Hash: hex.EncodeToString(blk.GetHash()), Pruned: blk.IsPruned()}
+		if blk.IsPruned() {
+			info.Block = hex.EncodeToString(blk.MarshalHeader())
+		} else {
+			info.Block = hex.EncodeToString(blk.Marshal())
+		}
+		list = append(list, info)
+	}
+	served.lock.RUnlock()
+	json.NewEncoder(w).Encode(list)
+}
+
+// serves the blob store
+// GET and HEAD download a blob by its hash, with support for Range requests
+// PUT uploads a chunk of a blob, given its hash, total size and the offset of the chunk
+// X-Blob-Offset reports how many bytes of the blob the server has
+func (n *Node) serveBlob(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	hash, err := hex.DecodeString(query.Get("hash"))
+	if err != nil || len(hash) != int(block.HASH_SIZE) {
+		http.Error(w, "invalid hash", http.StatusBadRequest)
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		f, err := n.blobs.OpenBlob(hash)
+		if err != nil {
+			offset, _ := n.blobs.BlobUploadOffset(hash)
+			w.Header().Set("X-Blob-Offset", strconv.FormatInt(offset, 10))
+			http.Error(w, "blob not found", http.StatusNotFound)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("X-Blob-Offset", strconv.FormatInt(info.Size(), 10))
+		http.ServeContent(w, req, hex.EncodeToString(hash), info.ModTime(), f)
+	case http.MethodPut:
+		size, err := strconv.ParseUint(query.Get("size"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid size", http.StatusBadRequest)
+			return
+		}
+		offset, err := strconv.ParseInt(query.Get("offset"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid offset", http.StatusBadRequest)
+			return
+		}
+		body := http.MaxBytesReader(w, req.Body, blob.BLOB_CHUNK_SIZE)
+		complete, err := n.blobs.WriteBlobChunk(hash, size, offset, body)
+		if errors.Is(err, blob.ErrBlobTooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		uploaded, _ := n.blobs.BlobUploadOffset(hash)
+		w.Header().Set("X-Blob-Offset", strconv.FormatInt(uploaded, 10))
+		if complete {
+			w.WriteHeader(http.StatusCreated)
+		} else {
+			w.WriteHeader(http.StatusAccepted)
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// how often a serving node looks for expired blob uploads
+const BLOB_EXPIRY_INTERVAL time.Duration = time.Hour
+
+// removes the partial blob uploads that have expired, checking every BLOB_EXPIRY_INTERVAL
+func (n *Node) expireUploads() {
+	ticker := time.NewTicker(BLOB_EXPIRY_INTERVAL)
+	defer ticker.Stop()
+	for {
+		count, err := n.blobs.ExpireUploads(time.Now().Add(-blob.BLOB_UPLOAD_EXPIRY))
+		if err != nil {
+			n.logger.Warn("expiring blob uploads failed", "err", err)
+		} else if count > 0 {
+			n.logger.Info("expired blob uploads", "count", count)
+		}
+		<-ticker.C
+	}
+}
+
+// the outcome of submitting a block, as reported by the submit endpoint
+type SubmitVerdict struct {
+	Accepted bool   `json:"accepted"`
+	Code     string `json:"code"`             // one of the SUBMIT_* codes
+	Hash     string `json:"hash,omitempty"`   // hash of the submitted block, if it could be parsed
+	Height   int    `json:"height,omitempty"` // height of the block, if it was accepted
+	Tip      string `json:"tip"`              // hash of the chain's tip after the submission
+	Error    string `json:"error,omitempty"`  // why the block was rejected
+}
+
+// verdict codes reported by the submit endpoint
+const (
+	SUBMIT_ACCEPTED  string = "accepted"
+	SUBMIT_MALFORMED string = "malformed" // the block couldn't be decoded
+	SUBMIT_STALE_TIP string = "stale_tip" // the block doesn't build on the current tip, rebuild it and try again
+	SUBMIT_INTERNAL  string = "internal"  // the block is valid but couldn't be saved, so it wasn't appended
+
+	// the block is invalid for this chain, for the reason given by the code
+	SUBMIT_NOT_AUTHORIZED         string = "not_authorized"         // a signer isn't a validator of the chain
+	SUBMIT_INSUFFICIENT_ALLOWANCE string = "insufficient_allowance" // a signer can't delegate that many blocks
+	SUBMIT_DUPLICATE_ALIAS        string = "duplicate_alias"        // the alias is held by another validator
+	SUBMIT_REVOKED_CERTIFICATE    string = "revoked_certificate"    // a signer's certificate has been revoked
+	SUBMIT_INVALID_CERTIFICATE    string = "invalid_certificate"    // a signer has no valid certificate
+	SUBMIT_WRONG_STATE_ROOT       string = "wrong_state_root"       // the block commits to the wrong state
+	SUBMIT_TX_TOO_LARGE           string = "tx_too_large"           // the transaction is larger than the chain allows
+	SUBMIT_REJECTED               string = "rejected"               // the block is invalid for any other reason
+)
+
+// the codes of the errors a chain rejects a block with, checked in order
+// a revoked certificate is also invalid, so it comes first
+var rejectionCodes = []struct {
+	err  error
+	code string
+}{
+	{chain.ErrNotAuthorized, SUBMIT_NOT_AUTHORIZED},
+	{chain.ErrInsufficientAllowance, SUBMIT_INSUFFICIENT_ALLOWANCE},
+	{chain.ErrDuplicateAlias, SUBMIT_DUPLICATE_ALIAS},
+	{chain.ErrRevokedCertificate, SUBMIT_REVOKED_CERTIFICATE},
+	{chain.ErrInvalidCertificate, SUBMIT_INVALID_CERTIFICATE},
+	{chain.ErrWrongStateRoot, SUBMIT_WRONG_STATE_ROOT},
+	{chain.ErrTxTooLarge, SUBMIT_TX_TOO_LARGE},
+}
+
+// returns the verdict code of a block the chain rejected with err
+func rejectionCode(err error) string {
+	for _, r := range rejectionCodes {
+		if errors.Is(err, r.err) {
+			return r.code
+		}
+	}
+	return SUBMIT_REJECTED
+}
+
+// appends a hex-encoded block to the chain and saves it
+// responds with a json SubmitVerdict, with a status matching the verdict
+func submit(w http.ResponseWriter, req *http.Request, served *served_chain_t) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	respond := func(status int, verdict SubmitVerdict) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(verdict)
+	}
+
+	b, err := io.ReadAll(http.MaxBytesReader(w, req.Body, served.max_submit_size))
+	if err != nil {
+		respond(http.StatusRequestEntityTooLarge, SubmitVerdict{Code: SUBMIT_MALFORMED, Error: err.Error()})
+		return
+	}
+	block_data, err := hex.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		respond(http.StatusBadRequest, SubmitVerdict{Code: SUBMIT_MALFORMED, Error: err.Error()})
+		return
+	}
+	blk, err := block.Unmarshal(block_data)
+	if err != nil {
+		respond(http.StatusBadRequest, SubmitVerdict{Code: SUBMIT_MALFORMED, Error: err.Error()})
+		return
+	}
+
+	respond(submitBlock(served, blk))
+}
+
+// saves a block and appends it to the chain, waking the subscribers once it's saved
+// returns the verdict, and the http status matching it
+func submitBlock(served *served_chain_t, blk block.Block) (int, SubmitVerdict) {
+	served.lock.Lock()
+	defer served.lock.Unlock()
+	verdict := SubmitVerdict{Hash: hex.EncodeToString(blk.GetHash())}
+	_, err := served.bc.AppendAndSave(blk)
+	verdict.Tip = hex.EncodeToString(served.bc.GetTipHash())
+	if errors.Is(err, chain.ErrStaleTip) {
+		verdict.Code, verdict.Error = SUBMIT_STALE_TIP, err.Error()
+		return http.StatusConflict, verdict
+	}
+	if errors.Is(err, chain.ErrNotSaved) {
+		verdict.Code, verdict.Error = SUBMIT_INTERNAL, err.Error()
+		return http.StatusInternalServerError, verdict
+	}
+	if err != nil {
+		verdict.Code, verdict.Error = rejectionCode(err), err.Error()
+		return http.StatusUnprocessableEntity, verdict
+	}
+	verdict.Accepted, verdict.Height, verdict.Code = true, served.bc.Height(), SUBMIT_ACCEPTED
+	close(served.appended)
+	served.appended = make(chan struct{})
+	return http.StatusOK, verdict
+}
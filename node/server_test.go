@@ -0,0 +1,198 @@
+package node
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"reddchain/chain"
+	"reddchain/chain/chaintest"
+	"reddchain/identity"
+	"reddchain/identity/identitytest"
+	"reddchain/transaction"
+)
+
+// returns the default configuration with a temporary data directory
+func testConfig(t *testing.T) Config {
+	cfg := DefaultConfig()
+	cfg.DataDir = t.TempDir()
+	return cfg
+}
+
+// serves the given chains for the duration of a test
+func newTestServer(t *testing.T, served map[string]chain.Blockchain) *httptest.Server {
+	n := New()
+	n.setConfig(testConfig(t))
+	for label, bc := range served {
+		if err := n.Add(label, bc); err != nil {
+			t.Fatalf("error adding chain %s (%s)", label, err)
+		}
+	}
+	server := httptest.NewServer(n.Handler())
+	t.Cleanup(server.Close)
+	return server
+}
+
+// returns the base url of a chain on the test server
+func chainURL(server *httptest.Server, label string) string {
+	return server.URL + "/chains/" + label
+}
+
+// makes a GET request and returns the status and body
+func testGet(t *testing.T, url string) (int, string) {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("error requesting %s (%s)", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestServerMultipleChains(t *testing.T) {
+	id_foo := identitytest.Identity("foo")
+	id_bar := identitytest.Identity("bar")
+	foo := chaintest.NewChain(t, "foo", id_foo)
+	bar := chaintest.NewChain(t, "bar", id_bar)
+	server := newTestServer(t, map[string]chain.Blockchain{"foo": foo, "bar": bar})
+
+	status, body := testGet(t, chainURL(server, "foo")+"/tip")
+	if status != http.StatusOK || strings.TrimSpace(body) != hex.EncodeToString(foo.GetTipHash()) {
+		t.Errorf("foo tip was %d %s", status, body)
+	}
+	status, body = testGet(t, chainURL(server, "bar")+"/tip")
+	if status != http.StatusOK || strings.TrimSpace(body) != hex.EncodeToString(bar.GetTipHash()) {
+		t.Errorf("bar tip was %d %s", status, body)
+	}
+
+	// each chain has its own validators
+	status, body = testGet(t, chainURL(server, "foo")+"/state")
+	validators := make(map[string]uint32)
+	if err := json.Unmarshal([]byte(body), &validators); err != nil || status != http.StatusOK {
+		t.Fatalf("error reading foo state (%d %v)", status, err)
+	}
+	if _, ok := validators[hex.EncodeToString(id_bar.GetPubBytes())]; ok {
+		t.Errorf("bar's validator is in foo's state")
+	}
+
+	status, _ = testGet(t, chainURL(server, "baz")+"/tip")
+	if status != http.StatusNotFound {
+		t.Errorf("unknown chain returned %d", status)
+	}
+
+	// without a main chain, the unprefixed endpoints aren't served
+	status, body = testGet(t, server.URL+"/tip")
+	if strings.TrimSpace(body) == hex.EncodeToString(foo.GetTipHash()) || strings.TrimSpace(body) == hex.EncodeToString(bar.GetTipHash()) {
+		t.Errorf("unprefixed tip was served from another chain (%d)", status)
+	}
+
+	status, body = testGet(t, server.URL+"/chains")
+	listed := make(map[string]map[string]string)
+	if err := json.Unmarshal([]byte(body), &listed); err != nil || status != http.StatusOK {
+		t.Fatalf("error listing chains (%d %v)", status, err)
+	}
+	if len(listed) != 2 || listed["foo"]["genesis"] != hex.EncodeToString(foo.GetGenesisHash()) {
+		t.Errorf("chains were listed as %v", listed)
+	}
+}
+
+func TestServerSubmitNotSaved(t *testing.T) {
+	id := identitytest.Identity("main")
+	n := New()
+	n.setConfig(testConfig(t))
+	if err := n.Add("unsaved", chaintest.NewChain(t, "unsaved", id)); err != nil {
+		t.Fatal(err)
+	}
+	served := n.chains["unsaved"]
+	appended := served.appended
+
+	// a block that can't be written is neither appended nor announced
+	blocks_dir := path.Join(n.config.DataDir, chain.BLOCKS_DIR)
+	if err := os.Rename(blocks_dir, blocks_dir+".saved"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(blocks_dir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	blk := chaintest.NewBlock(t, &served.bc, transaction.NewTx_Entry([]byte("unsaved")), id)
+	status, verdict := submitBlock(served, blk)
+	if status != http.StatusInternalServerError || verdict.Accepted || verdict.Code != SUBMIT_INTERNAL || served.bc.Height() != 0 {
+		t.Errorf("block that couldn't be saved returned %d %+v at height %d", status, verdict, served.bc.Height())
+	}
+	select {
+	case <-appended:
+		t.Errorf("subscribers were woken for a block that couldn't be saved")
+	default:
+	}
+
+	// the same block is accepted once it can be written, and the saved chain loads
+	if err := os.Remove(blocks_dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(blocks_dir+".saved", blocks_dir); err != nil {
+		t.Fatal(err)
+	}
+	if status, verdict := submitBlock(served, blk); status != http.StatusOK || !verdict.Accepted {
+		t.Fatalf("block was refused once it could be saved (%d %+v)", status, verdict)
+	}
+	if _, err := chain.LoadChain(n.config.DataDir, "unsaved"); err != nil {
+		t.Errorf("error loading the saved chain (%s)", err)
+	}
+}
+
+func TestServerGenesisMismatch(t *testing.T) {
+	id := identitytest.Identity("main")
+	foo := chaintest.NewChain(t, "foo", id)
+	other := chaintest.NewChain(t, "foo", id) // same id, different timestamp or signature
+	server := newTestServer(t, map[string]chain.Blockchain{"foo": foo})
+
+	request := func(genesis []byte) int {
+		req, _ := http.NewRequest(http.MethodGet, chainURL(server, "foo")+"/tip", nil)
+		req.Header.Set(GENESIS_HEADER, hex.EncodeToString(genesis))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("error requesting tip (%s)", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := request(foo.GetGenesisHash()); status != http.StatusOK {
+		t.Errorf("request with the right genesis returned %d", status)
+	}
+	if status := request(other.GetGenesisHash()); status != http.StatusConflict {
+		t.Errorf("request with the wrong genesis returned %d", status)
+	}
+
+	status, body := testGet(t, chainURL(server, "foo")+"/genesis")
+	var gf chain.GenesisFile
+	if err := json.Unmarshal([]byte(body), &gf); err != nil || status != http.StatusOK {
+		t.Fatalf("error reading genesis file (%d %v)", status, err)
+	}
+	genesis, err := gf.Block()
+	if err != nil || !bytes.Equal(genesis.GetHash(), foo.GetGenesisHash()) {
+		t.Errorf("served genesis file doesn't match the chain (%v)", err)
+	}
+}
+
+func TestServerValidators(t *testing.T) {
+	id := identitytest.Identity("main")
+	bc := chaintest.NewChain(t, "validators", id, transaction.NewTx_Alias("main-node"))
+	server := newTestServer(t, map[string]chain.Blockchain{"validators": bc})
+
+	status, body := testGet(t, chainURL(server, "validators")+"/validators")
+	var list []ValidatorInfo
+	if err := json.Unmarshal([]byte(body), &list); err != nil || status != http.StatusOK {
+		t.Fatalf("error reading validators (%d %v)", status, err)
+	}
+	if len(list) != 1 || list[0].Alias != "main-node" || list[0].Fingerprint != identity.Fingerprint(id.GetPubBytes()) || !list[0].Unlimited {
+		t.Errorf("wrong validators %+v", list)
+	}
+}
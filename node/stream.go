@@ -0,0 +1,183 @@
+package node
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"reddchain/block"
+	"reddchain/chain"
+	"reddchain/transaction"
+)
+
+// the subscribe endpoint streams blocks as server-sent events
+const MEDIA_EVENT_STREAM string = "text/event-stream"
+
+// how often a stream with no new blocks sends a comment, so proxies and clients don't time it out
+const STREAM_HEARTBEAT time.Duration = 15 * time.Second
+
+// the blocks a subscription is interested in
+type stream_filter_t struct {
+	validators []string // fingerprints, aliases or hex-encoded keys
+	types      []string // transaction type names
+	headers    bool     // only headers are sent
+}
+
+// reads a subscription's filter from its query string
+// validator and type can be repeated or given as comma-separated lists, and match any of their values
+func parseStreamFilter(req *http.Request) (filter stream_filter_t, err error) {
+	query := req.URL.Query()
+	list := func(name string) (values []string) {
+		for _, v := range query[name] {
+			for _, part := range strings.Split(v, ",") {
+				if part = strings.TrimSpace(part); part != "" {
+					values = append(values, part)
+				}
+			}
+		}
+		return values
+	}
+	filter.validators = list("validator")
+	filter.types = list("type")
+	for _, name := range filter.types {
+		if _, err := transaction.ParseType(name); err != nil {
+			return filter, err
+		}
+	}
+	if query.Has("headers") {
+		filter.headers, err = strconv.ParseBool(query.Get("headers"))
+		if err != nil {
+			return filter, fmt.Errorf("invalid headers %q", query.Get("headers"))
+		}
+	}
+	return filter, nil
+}
+
+// whether a block of the chain passes the filter
+// aliases are looked up in the chain's current state, so the chain's lock must be held
+func (filter *stream_filter_t) matches(bc *chain.Blockchain, info *block.Info) bool {
+	if len(filter.types) > 0 && !contains(filter.types, info.TxType) {
+		return false
+	}
+	if len(filter.validators) == 0 {
+		return true
+	}
+	alias := bc.GetAlias(info.Validator)
+	for _, v := range filter.validators {
+		if strings.EqualFold(v, info.Fingerprint) || strings.EqualFold(v, info.Validator) || (alias != "" && v == alias) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the encoding of a block sent to a subscription
+// with only headers, the block's transaction is left out and Raw holds the encoded header
+func (filter *stream_filter_t) encode(blk block.Block, height int) APIBlock {
+	if !filter.headers {
+		return newAPIBlock(blk, height)
+	}
+	info := APIBlock{Height: height, Info: blk.Info(), Raw: hex.EncodeToString(blk.MarshalHeader())}
+	info.Tx = nil
+	return info
+}
+
+// streams the blocks of the chain as server-sent events, each an APIBlock whose event id is its height
+// blocks are sent from the height given by from, or after the height in the Last-Event-ID header
+// of a reconnecting client, and otherwise from the next block to be appended
+// the stream stays open, sending each block that passes the filter as soon as it's appended
+func apiSubscribe(w http.ResponseWriter, req *http.Request, served *served_chain_t) {
+	if !allowMethods(w, req, http.MethodGet) {
+		return
+	}
+	filter, err := parseStreamFilter(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ERROR_BAD_REQUEST, err.Error())
+		return
+	}
+	served.lock.RLock()
+	next := served.bc.Height() + 1
+	served.lock.RUnlock()
+	if last := req.Header.Get("Last-Event-ID"); last != "" {
+		height, err := strconv.Atoi(last)
+		if err != nil || height < 0 {
+			writeError(w, http.StatusBadRequest, ERROR_BAD_REQUEST, "invalid Last-Event-ID")
+			return
+		}
+		next = height + 1
+	} else if req.URL.Query().Has("from") {
+		next, err = strconv.Atoi(req.URL.Query().Get("from"))
+		if err != nil || next < 0 {
+			writeError(w, http.StatusBadRequest, ERROR_BAD_REQUEST, "invalid from")
+			return
+		}
+	}
+
+	// the stream outlives the server's write timeout
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", MEDIA_EVENT_STREAM)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(STREAM_HEARTBEAT)
+	defer heartbeat.Stop()
+	for {
+		// blocks are read in batches, so a subscription catching up doesn't hold the lock for long
+		served.lock.RLock()
+		height, appended := served.bc.Height(), served.appended
+		var batch []APIBlock
+		for end := min(height, next+BLOCKS_MAX_COUNT-1); next <= end; next++ {
+			blk, err := served.bc.GetBlockAt(next)
+			if err != nil {
+				served.lock.RUnlock()
+				return
+			}
+			if info := blk.Info(); filter.matches(&served.bc, &info) {
+				batch = append(batch, filter.encode(blk, next))
+			}
+		}
+		served.lock.RUnlock()
+
+		for _, info := range batch {
+			data, _ := json.Marshal(info)
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: block\ndata: %s\n\n", info.Height, data); err != nil {
+				return
+			}
+		}
+		if len(batch) > 0 {
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+		if next <= height {
+			continue
+		}
+
+		select {
+		case <-appended:
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil || rc.Flush() != nil {
+				return
+			}
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
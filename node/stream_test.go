@@ -0,0 +1,116 @@
+package node
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"reddchain/chain"
+	"reddchain/chain/chaintest"
+	"reddchain/identity"
+	"reddchain/identity/identitytest"
+	"reddchain/transaction"
+)
+
+// opens a stream of blocks, returning a reader for its events
+func openTestStream(t *testing.T, url string, last_id string) *bufio.Reader {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if last_id != "" {
+		req.Header.Set("Last-Event-ID", last_id)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("error opening stream %s (%s)", url, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != MEDIA_EVENT_STREAM {
+		t.Fatalf("stream %s returned %d %s", url, resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+// reads the next block event of a stream
+func readTestEvent(t *testing.T, r *bufio.Reader) (string, APIBlock) {
+	var id string
+	var info APIBlock
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("error reading stream (%s)", err)
+		}
+		line = strings.TrimSpace(line)
+		if value, ok := strings.CutPrefix(line, "id: "); ok {
+			id = value
+		} else if value, ok := strings.CutPrefix(line, "data: "); ok {
+			if err := json.Unmarshal([]byte(value), &info); err != nil {
+				t.Fatalf("invalid event data (%s): %s", err, value)
+			}
+		} else if line == "" && id != "" {
+			return id, info
+		}
+	}
+}
+
+// submits a block with tx signed by signer to the test server
+func submitTestBlock(t *testing.T, url string, bc *chain.Blockchain, tx transaction.Transaction, signer identity.Signer) {
+	blk := chaintest.NewBlock(t, bc, tx, signer)
+	if _, err := bc.AppendBlock(blk); err != nil {
+		t.Fatalf("error appending block (%s)", err)
+	}
+	resp, body := testAPIRequest(t, http.MethodPost, url+"/submit", map[string]string{"Content-Type": MEDIA_BINARY}, blk.Marshal())
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("error submitting block (%d %s)", resp.StatusCode, body)
+	}
+}
+
+func TestStream(t *testing.T) {
+	id, bar := identitytest.Identity("main"), identitytest.Identity("bar")
+	bc := chaintest.NewChain(t, "stream", id)
+	server := newTestServer(t, map[string]chain.Blockchain{"stream": bc})
+	base := server.URL + API_PREFIX + "/chains/stream"
+	submitTestBlock(t, base, &bc, transaction.NewTx_Entry([]byte("before")), id)
+
+	// a stream from the start catches up, then follows the chain
+	all := openTestStream(t, base+"/subscribe?from=0", "")
+	live := openTestStream(t, base+"/subscribe", "")
+	entries := openTestStream(t, base+"/subscribe?from=1&type=entry&validator="+identity.Fingerprint(bar.GetPubBytes())+"&headers=true", "")
+	for height, want := range []string{"entry", "entry"} {
+		if event_id, info := readTestEvent(t, all); info.Height != height || event_id != strconv.Itoa(height) || info.TxType != want {
+			t.Errorf("stream from the start sent %s %+v", event_id, info)
+		}
+	}
+
+	submitTestBlock(t, base, &bc, transaction.NewTx_Permission(5, bar.GetPubBytes()), id)
+	submitTestBlock(t, base, &bc, transaction.NewTx_Entry([]byte("from bar")), bar)
+	for height := 2; height <= 3; height++ {
+		if _, info := readTestEvent(t, all); info.Height != height {
+			t.Errorf("stream sent height %d, expected %d", info.Height, height)
+		}
+		if _, info := readTestEvent(t, live); info.Height != height || info.Tx == nil {
+			t.Errorf("live stream sent height %d, expected %d", info.Height, height)
+		}
+	}
+	if _, info := readTestEvent(t, entries); info.Height != 3 || info.Tx != nil || info.Fingerprint != identity.Fingerprint(bar.GetPubBytes()) {
+		t.Errorf("filtered stream sent %+v", info)
+	}
+
+	// a reconnecting client resumes after its last event
+	if _, info := readTestEvent(t, openTestStream(t, base+"/subscribe?from=0", "2")); info.Height != 3 || info.Tx == nil || info.Tx.Data != hex.EncodeToString([]byte("from bar")) {
+		t.Errorf("resumed stream sent %+v", info)
+	}
+
+	for _, query := range []string{"from=x", "type=transfer", "headers=maybe"} {
+		resp, body := testAPIRequest(t, http.MethodGet, base+"/subscribe?"+query, nil, nil)
+		if envelope := decodeAPIResponse(t, body, nil); resp.StatusCode != http.StatusBadRequest || envelope.Error == nil {
+			t.Errorf("subscription with %s returned %d %s", query, resp.StatusCode, body)
+		}
+	}
+}
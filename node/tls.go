@@ -0,0 +1,120 @@
+package node
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"reddchain/chain"
+	"reddchain/identity"
+)
+
+// the context key holding the public key of a request's client certificate
+type client_key_t struct{}
+
+// reads a PEM bundle of CA certificates
+func LoadCABundle(fname string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s doesn't hold any PEM certificates", fname)
+	}
+	return pool, nil
+}
+
+// builds the tls configuration of a node from the files named in its configuration
+// returns nil if the node serves plain http
+func loadTLSConfig(cfg Config) (*tls.Config, error) {
+	if cfg.TLSCert == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("tls certificate: %w", err)
+	}
+	tls_config := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if cfg.ClientCA != "" {
+		pool, err := LoadCABundle(cfg.ClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("client CA: %w", err)
+		}
+		tls_config.ClientCAs = pool
+		tls_config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tls_config, nil
+}
+
+// returns the key of the identity that made a request: the signer of a signed request, or the client certificate's key
+// returns nil if the request wasn't signed and the client didn't present a certificate
+func ClientKey(req *http.Request) []byte {
+	pub, _ := req.Context().Value(client_key_t{}).([]byte)
+	return pub
+}
+
+// returns the label of the chain a request is for, the main chain unless the path names another
+// the blob store, the list of chains and the node's status are reached through the main chain too
+func requestChain(req *http.Request) string {
+	path := strings.TrimPrefix(req.URL.Path, API_PREFIX)
+	if rest, ok := strings.CutPrefix(path, "/chains/"); ok {
+		if label, _, _ := strings.Cut(rest, "/"); label != "" {
+			return label
+		}
+	}
+	return chain.MAIN_CHAIN_NAME
+}
+
+// whether a public key belongs to an identity the node accepts a request for the chain label from:
+// the node's own, one of its configured client identities, or a validator with an allowance left on that chain
+// a validator of one chain isn't known to the node's other chains, and one whose allowance ran out or was revoked isn't known at all
+func (n *Node) knownIdentity(pub []byte, label string) bool {
+	for _, key := range append([][]byte{n.identity}, n.client_keys...) {
+		if key != nil && string(key) == string(pub) {
+			return true
+		}
+	}
+	served, ok := n.chains[label]
+	if !ok {
+		return false
+	}
+	served.lock.RLock()
+	allowance := served.bc.GetValidators()[hex.EncodeToString(pub)]
+	served.lock.RUnlock()
+	return allowance != 0
+}
+
+// with mutual tls, refuses requests whose client certificate doesn't belong to an identity known to the chain they are for
+// the chain's validators are checked on each request, so clients gain and lose access with the chain's state
+func (n *Node) checkClientCert(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+			if n.tls_config != nil && n.tls_config.ClientCAs != nil {
+				writeError(w, http.StatusForbidden, ERROR_FORBIDDEN, "a client certificate is required")
+				return
+			}
+			handler.ServeHTTP(w, req)
+			return
+		}
+
+		pub, err := x509.MarshalPKIXPublicKey(req.TLS.PeerCertificates[0].PublicKey)
+		if err == nil {
+			_, err = identity.ParsePublicKey(pub)
+		}
+		if err != nil {
+			writeError(w, http.StatusForbidden, ERROR_FORBIDDEN, fmt.Sprintf("client certificate key: %s", err))
+			return
+		}
+		if !n.knownIdentity(pub, requestChain(req)) {
+			writeError(w, http.StatusForbidden, ERROR_FORBIDDEN, "client certificate doesn't belong to an identity known to chain "+requestChain(req)+", its key's fingerprint is "+identity.Fingerprint(pub))
+			return
+		}
+		handler.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), client_key_t{}, pub)))
+	})
+}
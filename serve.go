@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"reddchain/node"
+)
+
+// a flag holding a list, given several times or once with a comma-separated list
+// the first use of the flag replaces the list it was created with
+type list_flag_t struct {
+	list *[]string
+	set  bool
+}
+
+func (l *list_flag_t) String() string {
+	if l.list == nil {
+		return ""
+	}
+	return strings.Join(*l.list, ",")
+}
+
+func (l *list_flag_t) Set(value string) error {
+	if !l.set {
+		*l.list, l.set = nil, true
+	}
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l.list = append(*l.list, v)
+		}
+	}
+	return nil
+}
+
+// creates the flags of the serve command, setting the fields of cfg
+// the flags default to the values already in cfg
+func serveFlags(cfg *node.Config, config_file *string, output io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.StringVar(config_file, "config", "", "json config file, overridden by the other flags")
+	fs.StringVar(&cfg.Listen, "listen", cfg.Listen, "address to listen on")
+	fs.StringVar(&cfg.DataDir, "data", cfg.DataDir, "directory holding the keystore, chains, blocks and blobs")
+	fs.Var(&list_flag_t{list: &cfg.Chains}, "chain", "chain to serve, may be repeated")
+	fs.StringVar(&cfg.Identity, "identity", cfg.Identity, "identity or PEM public key file the node is known by")
+	fs.Var(&list_flag_t{list: &cfg.Peers}, "peer", "base url of another node of the network, may be repeated")
+	fs.Int64Var(&cfg.MaxSubmitSize, "max-submit-size", cfg.MaxSubmitSize, "largest body of a submit request, in bytes")
+	fs.Int64Var(&cfg.MaxBlobSize, "max-blob-size", cfg.MaxBlobSize, "largest blob that can be uploaded, in bytes")
+	fs.Var(&cfg.ReadTimeout, "read-timeout", "time allowed to read a request, 0 for none")
+	fs.Var(&cfg.WriteTimeout, "write-timeout", "time allowed to write a response, 0 for none")
+	fs.Var(&cfg.IdleTimeout, "idle-timeout", "time an idle connection is kept open, 0 for none")
+	fs.StringVar(&cfg.LogLevel, "log-level", cfg.LogLevel, "debug, info, warn or error")
+	fs.StringVar(&cfg.TLSCert, "tls-cert", cfg.TLSCert, "PEM certificate chain to serve https with")
+	fs.StringVar(&cfg.TLSKey, "tls-key", cfg.TLSKey, "PEM private key of the tls certificate")
+	fs.StringVar(&cfg.ClientCA, "client-ca", cfg.ClientCA, "PEM bundle of the CAs clients must present a certificate from, for mutual tls")
+	fs.Var(&list_flag_t{list: &cfg.ClientIdentities}, "client-identity", "identity or PEM public key file allowed to connect or sign requests besides the validators, may be repeated")
+	fs.BoolVar(&cfg.RequireAuth, "require-auth", cfg.RequireAuth, "refuse requests that aren't signed by a known identity")
+	fs.Float64Var(&cfg.RateLimit, "rate-limit", cfg.RateLimit, "requests per second allowed from each client address, 0 for no limit")
+	fs.Float64Var(&cfg.IdentityRateLimit, "identity-rate-limit", cfg.IdentityRateLimit, "requests per second allowed from each identity, 0 for no limit")
+	fs.IntVar(&cfg.RateBurst, "rate-burst", cfg.RateBurst, "requests a client or identity can make at once before it's rate limited")
+	fs.BoolVar(&cfg.PublicReads, "public-reads", cfg.PublicReads, "with -require-auth, serve GET and HEAD requests without a signature")
+	return fs
+}
+
+// reads the configuration of the serve command from its arguments
+// flags override the file given by -config, which overrides $DATA_DIR_ENV and the defaults
+// chains can also be given as arguments after the flags
+func serveConfig(args []string) (cfg node.Config, err error) {
+	// the config file is read first, so the flags are parsed again on top of it
+	var config_file string
+	scratch := node.DefaultConfig()
+	if err := serveFlags(&scratch, &config_file, io.Discard).Parse(args); err != nil {
+		return cfg, err
+	}
+	cfg = node.DefaultConfig()
+	cfg.DataDir = dataDir()
+	if config_file != "" {
+		cfg, err = node.ReadConfig(config_file, cfg)
+		if err != nil {
+			return cfg, err
+		}
+	}
+
+	fs := serveFlags(&cfg, &config_file, io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+	if fs.NArg() > 0 {
+		cfg.Chains = fs.Args()
+	}
+	return cfg, cfg.Validate()
+}
+
+// prints the flags of the serve command and their defaults
+func printServeFlags() {
+	var b strings.Builder
+	var config_file string
+	cfg := node.DefaultConfig()
+	serveFlags(&cfg, &config_file, &b).PrintDefaults()
+	for _, line := range strings.Split(strings.TrimRight(b.String(), "\n"), "\n") {
+		fmt.Println("   " + line)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"reddchain/node"
+)
+
+func TestServeConfig(t *testing.T) {
+	fname := path.Join(t.TempDir(), "node.json")
+	data := `{"listen": "127.0.0.1:9100", "data_dir": "node-a", "chains": ["foo"], "log_level": "debug"}`
+	if err := os.WriteFile(fname, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// flags override the config file, which overrides the defaults
+	cfg, err := serveConfig([]string{"-config", fname, "-listen", ":9200", "-peer", "http://a:1,http://b:2", "-read-timeout", "3s"})
+	if err != nil {
+		t.Fatalf("error reading serve configuration (%s)", err)
+	}
+	if cfg.Listen != ":9200" || cfg.DataDir != "node-a" || len(cfg.Chains) != 1 || cfg.Chains[0] != "foo" || cfg.LogLevel != "debug" {
+		t.Errorf("wrong precedence of flags and config file: %+v", cfg)
+	}
+	if len(cfg.Peers) != 2 || time.Duration(cfg.ReadTimeout) != 3*time.Second || cfg.MaxSubmitSize != node.DEFAULT_MAX_SUBMIT_SIZE {
+		t.Errorf("wrong flag values: %+v", cfg)
+	}
+
+	// chains given as flags or arguments replace the default
+	cfg, err = serveConfig([]string{"-chain", "foo", "-chain", "bar"})
+	if err != nil || len(cfg.Chains) != 2 || cfg.Chains[0] != "foo" {
+		t.Errorf("chain flags gave %v (%v)", cfg.Chains, err)
+	}
+	cfg, err = serveConfig([]string{"baz"})
+	if err != nil || len(cfg.Chains) != 1 || cfg.Chains[0] != "baz" {
+		t.Errorf("chain arguments gave %v (%v)", cfg.Chains, err)
+	}
+
+	for _, args := range [][]string{{"-unknown"}, {"-log-level", "loud"}, {"-listen", "nowhere"}, {"-config", fname + ".missing"}} {
+		if _, err := serveConfig(args); err == nil {
+			t.Errorf("serve accepted %v", args)
+		}
+	}
+}
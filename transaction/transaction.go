@@ -0,0 +1,269 @@
+// Package transaction defines the transactions a block can carry and their encodings.
+package transaction
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"reddchain/identity"
+)
+
+type Type byte
+
+const (
+	Entry       Type = 0 // add arbitrary data to the chain
+	Permission  Type = 1 // allows others to add to blockchain
+	Blob        Type = 2 // commits to a blob stored off-chain
+	Multisig    Type = 3 // registers a multisig validator
+	Alias       Type = 4 // registers a human-readable name for the validator
+	Certificate Type = 5 // registers a validator's certificate in a certificate-bound chain
+	Revocation  Type = 6 // revokes certificates with a CRL signed by a trusted CA
+)
+
+// the names of the transaction types, as shown by inspect
+var type_names = map[Type]string{
+	Entry:       "entry",
+	Permission:  "permission",
+	Blob:        "blob",
+	Multisig:    "multisig",
+	Alias:       "alias",
+	Certificate: "certificate",
+	Revocation:  "revocation",
+}
+
+func (t Type) String() string {
+	if name, ok := type_names[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown (%d)", byte(t))
+}
+
+// returns the transaction type with the given name
+func ParseType(name string) (Type, error) {
+	for t, type_name := range type_names {
+		if type_name == name {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown transaction type %q", name)
+}
+
+// size of the data in a blob transaction: the blob's hash followed by its size
+const BLOB_TX_SIZE int = sha256.Size + 8
+
+// the largest encoded transaction a block can hold
+const TX_MAX_SIZE uint32 = 1048577 // 1 MB limit
+
+type Transaction struct {
+	txtype Type
+	data   []byte
+}
+
+// creates a transaction of any type from its data
+func New(txtype Type, data []byte) (tx Transaction) {
+	tx.txtype = txtype
+	tx.data = data
+	return tx
+}
+
+// returns the transaction's type
+func (tx *Transaction) Type() Type {
+	return tx.txtype
+}
+
+// returns the transaction's data
+func (tx *Transaction) Data() []byte {
+	return tx.data
+}
+
+func (tx *Transaction) Marshal() (b []byte) {
+	b = append(b, byte(tx.txtype))
+	b = append(b, tx.data...)
+	return b
+}
+
+func (tx *Transaction) Unmarshal(b []byte) error {
+	if len(b) == 0 {
+		return errors.New("transaction is empty")
+	}
+	tx.txtype = Type(b[0])
+	tx.data = b[1:]
+	if len(tx.data) != len(b)-1 {
+		return errors.New("unmarshaling unsuccessful")
+	}
+	return nil
+}
+
+func NewTx_Entry(data []byte) (tx Transaction) {
+	tx.txtype = Entry
+	tx.data = data
+	return tx
+}
+
+func NewTx_Permission(n uint32, pubKey []byte) (tx Transaction) {
+	tx.txtype = Permission
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, n)
+	tx.data = append(tx.data, b...)
+	tx.data = append(tx.data, pubKey...)
+	return tx
+}
+
+func (tx *Transaction) ParseTx_Permission() (n uint32, validator []byte, err error) {
+	if tx.txtype != Permission {
+		return 0, []byte(""), errors.New("not a permission transaction")
+	}
+	if len(tx.data) < 4 {
+		return 0, []byte(""), errors.New("permission transaction too short")
+	}
+	return binary.BigEndian.Uint32(tx.data[0:4]), tx.data[4:], nil
+}
+
+func NewTx_Blob(hash []byte, size uint64) (tx Transaction) {
+	tx.txtype = Blob
+	tx.data = append(tx.data, hash...)
+	tx.data = binary.BigEndian.AppendUint64(tx.data, size)
+	return tx
+}
+
+func (tx *Transaction) ParseTx_Blob() (hash []byte, size uint64, err error) {
+	if tx.txtype != Blob {
+		return []byte(""), 0, errors.New("not a blob transaction")
+	}
+	if len(tx.data) != BLOB_TX_SIZE {
+		return []byte(""), 0, errors.New("blob transaction has the wrong length")
+	}
+	return tx.data[:sha256.Size], binary.BigEndian.Uint64(tx.data[sha256.Size:]), nil
+}
+
+func NewTx_Multisig(policy identity.MultisigPolicy) (tx Transaction) {
+	tx.txtype = Multisig
+	tx.data = policy.Marshal()
+	return tx
+}
+
+func (tx *Transaction) ParseTx_Multisig() (policy identity.MultisigPolicy, err error) {
+	if tx.txtype != Multisig {
+		return policy, errors.New("not a multisig transaction")
+	}
+	return identity.ParseMultisigPolicy(tx.data)
+}
+
+func NewTx_Alias(alias string) (tx Transaction) {
+	tx.txtype = Alias
+	tx.data = []byte(alias)
+	return tx
+}
+
+func (tx *Transaction) ParseTx_Alias() (alias string, err error) {
+	if tx.txtype != Alias {
+		return "", errors.New("not an alias transaction")
+	}
+	alias = string(tx.data)
+	return alias, identity.ValidAlias(alias)
+}
+
+func NewTx_Certificate(chain []*x509.Certificate) (tx Transaction) {
+	tx.txtype = Certificate
+	for _, c := range chain {
+		tx.data = append(tx.data, c.Raw...)
+	}
+	return tx
+}
+
+// returns the certificate chain, leaf first
+func (tx *Transaction) ParseTx_Certificate() ([]*x509.Certificate, error) {
+	if tx.txtype != Certificate {
+		return nil, errors.New("not a certificate transaction")
+	}
+	chain, err := x509.ParseCertificates(tx.data)
+	if err != nil {
+		return nil, err
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("certificate transaction is empty")
+	}
+	return chain, nil
+}
+
+func NewTx_Revocation(crl []byte) (tx Transaction) {
+	tx.txtype = Revocation
+	tx.data = crl
+	return tx
+}
+
+func (tx *Transaction) ParseTx_Revocation() (*x509.RevocationList, error) {
+	if tx.txtype != Revocation {
+		return nil, errors.New("not a revocation transaction")
+	}
+	return x509.ParseRevocationList(tx.data)
+}
+
+// a transaction as encoded in json
+type Info struct {
+	Type        string `json:"type"`
+	Data        string `json:"data"` // hex-encoded
+	Description string `json:"description"`
+}
+
+// returns the json encoding of the transaction
+func (tx *Transaction) Info() Info {
+	return Info{Type: tx.txtype.String(), Data: hex.EncodeToString(tx.data), Description: tx.Describe()}
+}
+
+// returns a short human-readable description of the transaction's data
+// data that can't be parsed is described by the error instead
+func (tx *Transaction) Describe() string {
+	switch tx.txtype {
+	case Entry:
+		s := string(tx.data)
+		printable := strings.IndexFunc(s, func(r rune) bool { return !unicode.IsPrint(r) }) < 0
+		if printable {
+			return fmt.Sprintf("%q", s)
+		}
+		return fmt.Sprintf("%d bytes of binary data", len(tx.data))
+	case Permission:
+		n, validator, err := tx.ParseTx_Permission()
+		if err != nil {
+			return "invalid: " + err.Error()
+		}
+		return fmt.Sprintf("%d blocks to %s", n, identity.Fingerprint(validator))
+	case Blob:
+		hash, size, err := tx.ParseTx_Blob()
+		if err != nil {
+			return "invalid: " + err.Error()
+		}
+		return fmt.Sprintf("blob %x of %d bytes", hash, size)
+	case Multisig:
+		policy, err := tx.ParseTx_Multisig()
+		if err != nil {
+			return "invalid: " + err.Error()
+		}
+		return fmt.Sprintf("validator %s signed by %d of %d keys", identity.Fingerprint(policy.ID()), policy.Threshold(), len(policy.Keys()))
+	case Alias:
+		alias, err := tx.ParseTx_Alias()
+		if err != nil {
+			return "invalid: " + err.Error()
+		}
+		return alias
+	case Certificate:
+		certs, err := tx.ParseTx_Certificate()
+		if err != nil {
+			return "invalid: " + err.Error()
+		}
+		return fmt.Sprintf("%s issued by %s", certs[0].Subject, certs[0].Issuer)
+	case Revocation:
+		crl, err := tx.ParseTx_Revocation()
+		if err != nil {
+			return "invalid: " + err.Error()
+		}
+		return fmt.Sprintf("%d certificates revoked by %s", len(crl.RevokedCertificateEntries), crl.Issuer)
+	}
+	return fmt.Sprintf("%d bytes", len(tx.data))
+}